@@ -0,0 +1,93 @@
+// Package admin holds the maintenance tasks operators run with the
+// subcommands of the server binary. They work on the database directly,
+// across every ledger, without going through the API.
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/migration"
+	"github.com/brown-kaew/assessment/seed"
+	"github.com/lib/pq"
+)
+
+// RequireMigrated fails unless every migration has been applied, so tasks
+// don't run against a schema they don't know.
+func RequireMigrated(ctx context.Context, db *sql.DB) error {
+	status, err := migration.CurrentStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	if !status.UpToDate() {
+		return fmt.Errorf("database is at version %d of %d, run migrate first", status.Current, status.Latest)
+	}
+	return nil
+}
+
+// Record is an expense as Export writes it and Seed reads it, one JSON
+// object per line.
+type Record struct {
+	expense.Expense
+	LedgerId *int `json:"ledger_id,omitempty"`
+}
+
+// Export writes every expense of every ledger to w in id order and returns
+// how many it wrote.
+func Export(ctx context.Context, db *sql.DB, w io.Writer) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT id, title, amount, note, tags, ledger_id
+	FROM expenses
+	ORDER BY id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	encoder := json.NewEncoder(w)
+	n := 0
+	for rows.Next() {
+		var r Record
+		var ledgerId sql.NullInt64
+		if err := rows.Scan(&r.Id, &r.Title, &r.Amount, &r.Note, pq.Array(&r.Tags), &ledgerId); err != nil {
+			return n, err
+		}
+		if ledgerId.Valid {
+			id := int(ledgerId.Int64)
+			r.LedgerId = &id
+		}
+		if err := encoder.Encode(r); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// Seed inserts every record read from r, each with its first version valid
+// from now, in one transaction, and returns how many it inserted. Records
+// get new ids; their ledgers must exist. No events are published for them.
+func Seed(ctx context.Context, db *sql.DB, r io.Reader) (int, error) {
+	now := time.Now()
+	var expenses []seed.Expense
+	decoder := json.NewDecoder(r)
+	for {
+		var record Record
+		if err := decoder.Decode(&record); err == io.EOF {
+			break
+		} else if err != nil {
+			return 0, fmt.Errorf("record %d: %w", len(expenses)+1, err)
+		}
+		expenses = append(expenses, seed.Expense{Expense: record.Expense, LedgerId: record.LedgerId, At: now})
+	}
+	if err := seed.Insert(ctx, db, expenses); err != nil {
+		return 0, err
+	}
+	return len(expenses), nil
+}
@@ -0,0 +1,145 @@
+//go:build unit
+
+package admin
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	return db, mock, func() { db.Close() }
+}
+
+func TestExport_ShouldWriteOneRecordPerLine(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, title, amount, note, tags, ledger_id FROM expenses").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags", "ledger_id"}).
+			AddRow(1, "apple", 10, "", "{food}", nil).
+			AddRow(2, "rent", 900, "march", "{home}", 7))
+	var out bytes.Buffer
+
+	// Act
+	n, err := Export(context.Background(), db, &out)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.Equal(t, `{"id":1,"title":"apple","amount":10,"note":"","tags":["food"]}
+{"id":2,"title":"rent","amount":900,"note":"march","tags":["home"],"ledger_id":7}
+`, out.String())
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_ShouldCopyEveryRecordWithItsFirstVersion(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	in := strings.NewReader(`{"id":1,"title":"apple","amount":10,"note":"","tags":["food"]}
+{"id":2,"title":"rent","amount":900,"note":"march","tags":["home"],"ledger_id":7}
+`)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT nextval").WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(31).AddRow(32))
+	copyExpenses := mock.ExpectPrepare(`COPY "expenses"`)
+	copyExpenses.ExpectExec().WithArgs(31, "apple", 10.0, "", `{"food"}`, nil).WillReturnResult(driver.RowsAffected(1))
+	copyExpenses.ExpectExec().WithArgs(32, "rent", 900.0, "march", `{"home"}`, 7).WillReturnResult(driver.RowsAffected(1))
+	copyExpenses.ExpectExec().WithArgs().WillReturnResult(driver.RowsAffected(0))
+	copyVersions := mock.ExpectPrepare(`COPY "expense_versions"`)
+	copyVersions.ExpectExec().WithArgs(31, 1, "apple", 10.0, "", `{"food"}`, sqlmock.AnyArg()).WillReturnResult(driver.RowsAffected(1))
+	copyVersions.ExpectExec().WithArgs(32, 1, "rent", 900.0, "march", `{"home"}`, sqlmock.AnyArg()).WillReturnResult(driver.RowsAffected(1))
+	copyVersions.ExpectExec().WithArgs().WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectCommit()
+
+	// Act
+	n, err := Seed(context.Background(), db, in)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSeed_InvalidRecord_ShouldInsertNothing(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	in := strings.NewReader(`{"title":"apple","amount":10}
+{"title":"rent","amount":"a lot"}
+`)
+
+	// Act
+	n, err := Seed(context.Background(), db, in)
+
+	// Assert
+	assert.ErrorContains(t, err, "record 2")
+	assert.Equal(t, 0, n)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReindex_ShouldRebuildEveryTable(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	mock.ExpectQuery("SELECT tablename FROM pg_tables").
+		WillReturnRows(sqlmock.NewRows([]string{"tablename"}).AddRow("expenses").AddRow("outbox"))
+	mock.ExpectExec(`REINDEX TABLE CONCURRENTLY "expenses"`).WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(`REINDEX TABLE CONCURRENTLY "outbox"`).WillReturnResult(driver.RowsAffected(0))
+
+	// Act
+	tables, err := Reindex(context.Background(), db, true)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"expenses", "outbox"}, tables)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestVacuumDeleted_ShouldVacuumTablesWithDeletedRows(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	retention := int64((24 * time.Hour).Milliseconds())
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM idempotency_keys").WillReturnResult(driver.RowsAffected(3))
+	mock.ExpectExec("DELETE FROM ledger_invitations").WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec("DELETE FROM webhook_deliveries").WithArgs(retention).WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec("DELETE FROM outbox").WithArgs(retention).WillReturnResult(driver.RowsAffected(5))
+	mock.ExpectExec("DELETE FROM rate_limit_buckets").WithArgs(retention).WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectCommit()
+	mock.ExpectExec(`VACUUM \(ANALYZE\) "idempotency_keys"`).WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec(`VACUUM \(ANALYZE\) "outbox"`).WillReturnResult(driver.RowsAffected(0))
+
+	// Act
+	purged, err := VacuumDeleted(context.Background(), db, 24*time.Hour)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []Purge{
+		{"idempotency_keys", 3},
+		{"ledger_invitations", 0},
+		{"webhook_deliveries", 0},
+		{"outbox", 5},
+		{"rate_limit_buckets", 0},
+	}, purged)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,123 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Reindex rebuilds the indexes of every table of the current schema and
+// returns the tables. Concurrently doesn't block writes while it runs, but
+// takes longer.
+func Reindex(ctx context.Context, db *sql.DB, concurrently bool) ([]string, error) {
+	tables, err := tables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	reindex := "REINDEX TABLE "
+	if concurrently {
+		reindex = "REINDEX TABLE CONCURRENTLY "
+	}
+	for _, table := range tables {
+		if _, err := db.ExecContext(ctx, reindex+pq.QuoteIdentifier(table)); err != nil {
+			return nil, err
+		}
+	}
+	return tables, nil
+}
+
+func tables(ctx context.Context, db *sql.DB) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT tablename
+	FROM pg_tables
+	WHERE schemaname = current_schema()
+	ORDER BY tablename
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// Purge is how many rows of a table VacuumDeleted deleted.
+type Purge struct {
+	Table string
+	Rows  int64
+}
+
+// purges delete the rows the API no longer reads, in an order that keeps
+// foreign keys satisfied. Rows kept for troubleshooting are only deleted
+// once older than the retention, $1 in milliseconds.
+var purges = []struct {
+	table    string
+	retained bool
+	sql      string
+}{
+	{"idempotency_keys", false, `DELETE FROM idempotency_keys WHERE expires_at <= now()`},
+	{"ledger_invitations", false, `DELETE FROM ledger_invitations WHERE accepted_at IS NULL AND expires_at <= now()`},
+	{"webhook_deliveries", true, `
+	DELETE FROM webhook_deliveries
+	WHERE COALESCE(delivered_at, failed_at) <= now() - $1 * interval '1 millisecond'
+	`},
+	{"outbox", true, `
+	DELETE FROM outbox o
+	WHERE dispatched_at <= now() - $1 * interval '1 millisecond'
+		AND NOT EXISTS (SELECT 1 FROM webhook_deliveries d WHERE d.event_id = o.id)
+	`},
+	{"rate_limit_buckets", true, `DELETE FROM rate_limit_buckets WHERE updated_at <= now() - $1 * interval '1 millisecond'`},
+}
+
+// VacuumDeleted deletes the rows the API has retired: expired idempotency
+// keys and invitations, and finished webhook deliveries, dispatched events
+// and idle rate limit buckets older than retention. It then vacuums the
+// tables it deleted from so their space can be reused.
+func VacuumDeleted(ctx context.Context, db *sql.DB, retention time.Duration) ([]Purge, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var purged []Purge
+	for _, p := range purges {
+		var args []any
+		if p.retained {
+			args = append(args, retention.Milliseconds())
+		}
+		result, err := tx.ExecContext(ctx, p.sql, args...)
+		if err != nil {
+			return nil, err
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		purged = append(purged, Purge{Table: p.table, Rows: rows})
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// VACUUM can't run in a transaction.
+	for _, p := range purged {
+		if p.Rows == 0 {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, "VACUUM (ANALYZE) "+pq.QuoteIdentifier(p.Table)); err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
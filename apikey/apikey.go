@@ -0,0 +1,60 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+)
+
+// keyPrefix marks API keys so they are easy to spot, e.g. by secret
+// scanners, and prefixLength is how much of a key is kept to tell keys apart.
+const (
+	keyPrefix    = "exp_"
+	prefixLength = len(keyPrefix) + 8
+)
+
+type ApiKey struct {
+	Id         int        `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Key        string     `json:"key,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+// Validate checks that k has a name and only known scopes.
+func (k ApiKey) Validate() error {
+	if k.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(k.Scopes) == 0 {
+		return errors.New("at least one scope is required")
+	}
+	for _, scope := range k.Scopes {
+		if !slices.Contains(auth.Scopes, scope) {
+			return errors.New("unknown scope " + scope)
+		}
+	}
+	return nil
+}
+
+func newKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return keyPrefix + hex.EncodeToString(b), nil
+}
+
+// hash returns the digest stored in place of a key. Keys are long and random,
+// so a fast unsalted hash is enough to make a leaked table useless.
+func hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,67 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/lib/pq"
+)
+
+// Authenticator checks API keys for auth.Middleware.
+type Authenticator struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewAuthenticator(db *sql.DB, conf config.Config) *Authenticator {
+	return &Authenticator{
+		db:           db,
+		queryTimeout: conf.QueryTimeout,
+	}
+}
+
+// lastUsedResolution is how stale last_used_at may get. Recording every use
+// would turn each authenticated request into a write.
+const lastUsedResolution = time.Minute
+
+// AuthenticateKey looks key up by its hash and records that it was used,
+// at most once per lastUsedResolution.
+func (a *Authenticator) AuthenticateKey(ctx context.Context, key string) (auth.Principal, error) {
+	ctx, cancel := database.WithTimeout(ctx, a.queryTimeout)
+	defer cancel()
+	row := a.db.QueryRowContext(ctx, `
+	SELECT id, scopes, last_used_at
+	FROM api_keys
+	WHERE key_hash=$1
+	`, hash(key))
+
+	var id int
+	var scopes []string
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&id, pq.Array(&scopes), &lastUsedAt)
+	if err == sql.ErrNoRows {
+		return auth.Principal{}, auth.ErrInvalidKey
+	}
+	if err != nil {
+		return auth.Principal{}, database.HTTPError(ctx, err, "Cannot check API key")
+	}
+
+	if !lastUsedAt.Valid || time.Since(lastUsedAt.Time) >= lastUsedResolution {
+		_, err := a.db.ExecContext(ctx, `
+		UPDATE api_keys
+		SET last_used_at=now()
+		WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < now() - $2 * interval '1 millisecond')
+		`, id, lastUsedResolution.Milliseconds())
+		if err != nil {
+			// The key is valid all the same.
+			logging.FromContext(ctx).Warn("can't record API key use", "api_key_id", id, "error", err)
+		}
+	}
+	return auth.Principal{Subject: "api-key:" + strconv.Itoa(id), Scopes: scopes}, nil
+}
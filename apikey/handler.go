@@ -0,0 +1,158 @@
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+type Handler interface {
+	CreateApiKey(ctx context.Context, key *ApiKey) error
+	GetAllApiKeys(ctx context.Context) ([]ApiKey, error)
+	DeleteApiKeyById(ctx context.Context, id int) error
+}
+
+type handler struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewHandler(db *sql.DB, g *echo.Group, conf config.Config) Handler {
+	handler := &handler{
+		db:           db,
+		queryTimeout: conf.QueryTimeout,
+	}
+	handler.initRoutes(g)
+	return handler
+}
+
+func (h *handler) initRoutes(g *echo.Group) {
+	g.POST("/api-keys", h.createApiKeyHandler())
+	g.GET("/api-keys", h.getAllApiKeysHandler())
+	g.DELETE("/api-keys/:id", h.deleteApiKeyHandler())
+}
+
+func (h *handler) createApiKeyHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var key ApiKey
+		err := c.Bind(&key)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if err := key.Validate(); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
+		err = h.CreateApiKey(c.Request().Context(), &key)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, key)
+	}
+}
+
+func (h *handler) getAllApiKeysHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		keys, err := h.GetAllApiKeys(c.Request().Context())
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, keys)
+	}
+}
+
+func (h *handler) deleteApiKeyHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid Id")
+		}
+		err = h.DeleteApiKeyById(c.Request().Context(), id)
+		if err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// CreateApiKey issues a new key. Only its hash is stored, so the key itself
+// is returned here and never again.
+func (h *handler) CreateApiKey(ctx context.Context, key *ApiKey) error {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	if err := Create(ctx, h.db, key); err != nil {
+		return database.HTTPError(ctx, err, "Cannot create API key")
+	}
+	return nil
+}
+
+// Create issues a new key as CreateApiKey does, for use outside the API,
+// e.g. to create the first admin key of a new deployment.
+func Create(ctx context.Context, db *sql.DB, key *ApiKey) error {
+	secret, err := newKey()
+	if err != nil {
+		return err
+	}
+	key.Key = secret
+	key.Prefix = secret[:prefixLength]
+	key.LastUsedAt = nil
+
+	sql := `
+	INSERT INTO
+		api_keys (name, prefix, key_hash, scopes)
+	VALUES
+		($1, $2, $3, $4)
+	RETURNING id, created_at;
+	`
+	row := db.QueryRowContext(ctx, sql, key.Name, key.Prefix, hash(secret), pq.Array(&key.Scopes))
+	return row.Scan(&key.Id, &key.CreatedAt)
+}
+
+func (h *handler) GetAllApiKeys(ctx context.Context) ([]ApiKey, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, "SELECT id, name, prefix, scopes, created_at, last_used_at FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all API keys: "+err.Error())
+	}
+	defer rows.Close()
+
+	keys := []ApiKey{}
+	for rows.Next() {
+		var key ApiKey
+		err = rows.Scan(&key.Id, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt)
+		if err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan API key: "+err.Error())
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all API keys: "+err.Error())
+	}
+	return keys, nil
+}
+
+func (h *handler) DeleteApiKeyById(ctx context.Context, id int) error {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	res, err := h.db.ExecContext(ctx, "DELETE FROM api_keys WHERE id=$1", id)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot delete API key: "+err.Error())
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot delete API key: "+err.Error())
+	}
+	if row == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "API key not found")
+	}
+	return nil
+}
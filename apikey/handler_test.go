@@ -0,0 +1,200 @@
+//go:build unit
+
+package apikey
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	return db, mock, func() { db.Close() }
+}
+
+func TestCreateApiKey_ShouldStoreOnlyHash(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	var storedHash string
+	mock.ExpectQuery("INSERT INTO api_keys").
+		WithArgs("importer", sqlmock.AnyArg(), hashArg{&storedHash}, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+	key := &ApiKey{Name: "importer", Scopes: []string{auth.ScopeExpensesWrite}}
+
+	// Act
+	err := handler.CreateApiKey(context.Background(), key)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, key.Id)
+	assert.True(t, strings.HasPrefix(key.Key, "exp_"))
+	assert.Len(t, key.Key, 52)
+	assert.Equal(t, key.Key[:12], key.Prefix)
+	assert.Equal(t, hash(key.Key), storedHash)
+	assert.NotContains(t, storedHash, key.Key)
+}
+
+// hashArg captures the hash argument of a query.
+type hashArg struct{ value *string }
+
+func (a hashArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*a.value = s
+	return ok
+}
+
+func TestCreateApiKeyHandler_UnknownScope_ShouldGetBadRequest(t *testing.T) {
+	db, _, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{})
+
+	// Arrange
+	req := httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(`{"name":"importer","scopes":["expenses:delete"]}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "unknown scope expenses:delete")
+}
+
+func TestGetAllApiKeys_ShouldNotExposeKeys(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT id, name, prefix, scopes, created_at, last_used_at FROM api_keys").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "prefix", "scopes", "created_at", "last_used_at"}).
+			AddRow(1, "importer", "exp_0123abcd", `{"expenses:write"}`, createdAt, createdAt).
+			AddRow(2, "reporting", "exp_4567ef01", `{"expenses:read"}`, createdAt, nil))
+
+	// Act
+	keys, err := handler.GetAllApiKeys(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Len(t, keys, 2)
+	assert.Empty(t, keys[0].Key)
+	assert.Equal(t, []string{auth.ScopeExpensesWrite}, keys[0].Scopes)
+	assert.Equal(t, createdAt, *keys[0].LastUsedAt)
+	assert.Nil(t, keys[1].LastUsedAt)
+}
+
+func TestDeleteApiKeyById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	mock.ExpectExec("DELETE FROM api_keys").WithArgs(999).WillReturnResult(driver.RowsAffected(0))
+
+	// Act
+	err := handler.DeleteApiKeyById(context.Background(), 999)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, err.(*echo.HTTPError).Code)
+}
+
+func TestAuthenticateKey_ShouldRecordUse(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	authenticator := NewAuthenticator(db, config.Config{})
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, scopes, last_used_at FROM api_keys WHERE key_hash=\\$1").WithArgs(hash("exp_secret")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "last_used_at"}).AddRow(7, `{"expenses:read"}`, nil))
+	mock.ExpectExec("UPDATE api_keys SET last_used_at=now\\(\\)").WithArgs(7, time.Minute.Milliseconds()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	principal, err := authenticator.AuthenticateKey(context.Background(), "exp_secret")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "api-key:7", principal.Subject)
+	assert.Equal(t, []string{auth.ScopeExpensesRead}, principal.Scopes)
+}
+
+func TestAuthenticateKey_RecentlyUsed_ShouldOnlyRead(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	authenticator := NewAuthenticator(db, config.Config{})
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, scopes, last_used_at FROM api_keys").WithArgs(hash("exp_secret")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "last_used_at"}).
+			AddRow(7, `{"expenses:read"}`, time.Now().Add(-10*time.Second)))
+
+	// Act
+	principal, err := authenticator.AuthenticateKey(context.Background(), "exp_secret")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "api-key:7", principal.Subject)
+}
+
+func TestAuthenticateKey_RecordUseFailure_ShouldStillAuthenticate(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	authenticator := NewAuthenticator(db, config.Config{})
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, scopes, last_used_at FROM api_keys").WithArgs(hash("exp_secret")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "last_used_at"}).
+			AddRow(7, `{"expenses:read"}`, time.Now().Add(-time.Hour)))
+	mock.ExpectExec("UPDATE api_keys").WillReturnError(errors.New("cannot execute UPDATE in a read-only transaction"))
+
+	// Act
+	principal, err := authenticator.AuthenticateKey(context.Background(), "exp_secret")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, "api-key:7", principal.Subject)
+}
+
+func TestAuthenticateKey_UnknownKey_ShouldFail(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	authenticator := NewAuthenticator(db, config.Config{})
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, scopes, last_used_at FROM api_keys").WithArgs(hash("exp_revoked")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "scopes", "last_used_at"}))
+
+	// Act
+	_, err := authenticator.AuthenticateKey(context.Background(), "exp_revoked")
+
+	// Assert
+	assert.Equal(t, auth.ErrInvalidKey, err)
+}
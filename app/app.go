@@ -0,0 +1,304 @@
+// Package app wires the expense API together: its database, background
+// workers and servers, started and stopped in order.
+package app
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/graphqlapi"
+	"github.com/brown-kaew/assessment/grpcapi"
+	"github.com/brown-kaew/assessment/health"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/brown-kaew/assessment/metrics"
+	"github.com/brown-kaew/assessment/openapi"
+	"github.com/brown-kaew/assessment/ratelimit"
+	"github.com/brown-kaew/assessment/tlsserver"
+	"github.com/brown-kaew/assessment/tracing"
+	"github.com/brown-kaew/assessment/webhook"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"golang.org/x/net/http2"
+)
+
+// App is the expense API. New opens its database, Run starts its
+// background workers and then its servers, and Shutdown stops them in
+// reverse.
+type App struct {
+	conf            config.Config
+	logger          *slog.Logger
+	db              *sql.DB
+	echo            *echo.Echo
+	probes          *health.Handler
+	certs           *tlsserver.Certificates
+	broker          *expense.Broker
+	metricsServer   *http.Server
+	redirectServer  *http.Server
+	shutdownTracing func(context.Context) error
+
+	background     context.Context
+	stopBackground context.CancelFunc
+	workers        sync.WaitGroup
+	stopping       chan struct{}
+	stopOnce       sync.Once
+}
+
+type options struct {
+	openapi openapi.Options
+}
+
+// Option customizes an App.
+type Option func(*options)
+
+// WithOpenAPIOptions sets how requests, and responses, are checked against
+// the OpenAPI document.
+func WithOpenAPIOptions(o openapi.Options) Option {
+	return func(opts *options) {
+		opts.openapi = o
+	}
+}
+
+// New connects to and migrates the database of conf, and registers every
+// route. It doesn't listen on any port until Run.
+func New(conf config.Config, opts ...Option) (a *App, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	a = &App{
+		conf:     conf,
+		logger:   slog.Default(),
+		stopping: make(chan struct{}),
+	}
+	a.background, a.stopBackground = context.WithCancel(context.Background())
+
+	a.shutdownTracing, err = tracing.Init(context.Background(), conf)
+	if err != nil {
+		return nil, fmt.Errorf("can't initialize tracing: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			a.shutdownTracing(context.Background())
+		}
+	}()
+	if conf.TLS.Enabled() {
+		if a.certs, err = tlsserver.Load(conf.TLS); err != nil {
+			return nil, fmt.Errorf("can't load tls certificates: %w", err)
+		}
+	}
+	doc, err := openapi.Load()
+	if err != nil {
+		return nil, fmt.Errorf("can't load the openapi document: %w", err)
+	}
+	if a.db, err = expense.OpenDB(conf); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			a.db.Close()
+		}
+	}()
+
+	expenses, webhooks := a.routes(doc, o)
+	defer func() {
+		if err != nil {
+			a.broker.Close()
+		}
+	}()
+	if err := expenses.Prepare(context.Background()); err != nil {
+		return nil, fmt.Errorf("can't prepare expense statements: %w", err)
+	}
+	if err := webhooks.Prepare(context.Background()); err != nil {
+		return nil, fmt.Errorf("can't prepare webhook statements: %w", err)
+	}
+
+	metrics.TrackTags(conf.MetricsTags)
+	a.metricsServer = metrics.NewServer(conf.MetricsPort, metrics.NewRegistry(a.db))
+	if conf.TLS.RedirectPort != "" {
+		a.redirectServer = tlsserver.NewRedirectServer(conf.TLS, conf.Port)
+	}
+	return a, nil
+}
+
+func (a *App) routes(doc *openapi3.T, o options) (expense.Handler, webhook.Handler) {
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.Use(otelecho.Middleware(tracing.ServiceName))
+	e.Use(middleware.RequestID())
+	e.Use(logging.Middleware(a.logger))
+	e.Use(middleware.RecoverWithConfig(middleware.RecoverConfig{LogErrorFunc: logging.RecoverLogger}))
+
+	e.GET("/health", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, "OK")
+	})
+	a.probes = health.NewHandler(a.db, e, a.conf.ReadyTimeout)
+	openapi.NewHandler(e)
+
+	g := e.Group("")
+	g.Use(grpcapi.Middleware())
+	g.Use(metrics.Middleware())
+	limits := ratelimit.NewStore(a.conf.RateLimit, a.db)
+	// Limiting addresses before auth bounds the key lookups of clients
+	// with invalid keys, which the per-client limit after it never sees.
+	g.Use(ratelimit.Middleware(limits, config.RateLimit{Default: a.conf.RateLimit.PerIP}, ratelimit.IPKey))
+	g.Use(auth.ClientCertificate(a.conf.TLS.ClientIdentities))
+	g.Use(auth.Middleware(apikey.NewAuthenticator(a.db, a.conf)))
+	g.Use(ledger.Middleware(ledger.NewMemberships(a.db, a.conf)))
+	g.Use(ratelimit.Middleware(limits, a.conf.RateLimit, ratelimit.ClientKey,
+		ratelimit.WithAliases(grpcapi.RESTRoutes())))
+	g.Use(openapi.Middleware(doc, o.openapi))
+	a.broker = expense.NewBroker(a.conf)
+	expenses := expense.NewHandler(a.db, g, a.conf)
+	grpcapi.NewHandler(expenses, g)
+	graphqlapi.NewHandler(a.db, expenses, g, a.conf)
+	expense.NewStreamHandler(a.db, a.broker, g, a.conf)
+	webhooks := webhook.NewHandler(a.db, g, a.conf)
+	apikey.NewHandler(a.db, g, a.conf)
+	ledger.NewHandler(a.db, g, a.conf)
+
+	a.echo = e
+	return expenses, webhooks
+}
+
+// DB returns the database of the app.
+func (a *App) DB() *sql.DB {
+	return a.db
+}
+
+// Addr returns the address the API server listens on, nil until Run has
+// started listening. It tells which port was picked for a port of 0.
+func (a *App) Addr() net.Addr {
+	if a.certs != nil {
+		return a.echo.TLSListenerAddr()
+	}
+	return a.echo.ListenerAddr()
+}
+
+// Run starts the background workers, then the servers, and serves until
+// ctx is done or Shutdown is called, or fails when any server does.
+// Run doesn't stop anything itself; call Shutdown after it returns.
+func (a *App) Run(ctx context.Context) error {
+	a.goWorker(a.broker.Run)
+	a.goWorker(webhook.NewDispatcher(a.db).Run)
+	if a.certs != nil {
+		a.goWorker(a.certs.Watch)
+	}
+
+	// Each server reports at most one error, so none of them blocks.
+	failed := make(chan error, 3)
+	go func() {
+		a.logger.Info("starting server", "port", a.conf.Port, "tls", a.certs != nil)
+		var err error
+		if a.certs != nil {
+			a.echo.TLSServer.Addr = a.conf.Port
+			a.echo.TLSServer.TLSConfig = a.certs.Config()
+			err = a.echo.StartServer(a.echo.TLSServer)
+		} else {
+			// h2c lets gRPC clients reach the same port without TLS.
+			err = a.echo.StartH2CServer(a.conf.Port, &http2.Server{})
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+	go func() {
+		a.logger.Info("starting metrics server", "port", a.conf.MetricsPort)
+		if err := a.metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			failed <- fmt.Errorf("can't start metrics server: %w", err)
+		}
+	}()
+	if a.redirectServer != nil {
+		go func() {
+			a.logger.Info("starting https redirect server", "port", a.conf.TLS.RedirectPort)
+			if err := a.redirectServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("can't start https redirect server: %w", err)
+			}
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-a.stopping:
+		return nil
+	case err := <-failed:
+		return err
+	}
+}
+
+func (a *App) goWorker(run func(context.Context)) {
+	a.workers.Add(1)
+	go func() {
+		defer a.workers.Done()
+		run(a.background)
+	}()
+}
+
+// Shutdown fails readiness and keeps serving for ShutdownDrain, so load
+// balancers notice before the servers stop accepting requests. It then
+// stops the servers once their requests are done, waits for the background
+// workers and closes the database. The workers are cancelled before the
+// servers all the same: the broker ending open event streams is what lets
+// the server finish them before ctx expires.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.probes.ShuttingDown()
+	a.stopOnce.Do(func() { close(a.stopping) })
+
+	var errs []error
+	if a.conf.ShutdownDrain > 0 {
+		drain := time.NewTimer(a.conf.ShutdownDrain)
+		select {
+		case <-drain.C:
+		case <-ctx.Done():
+			drain.Stop()
+			errs = append(errs, fmt.Errorf("can't drain before shutting down: %w", ctx.Err()))
+		}
+	}
+	a.stopBackground()
+
+	if err := a.echo.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("can't shut down the server: %w", err))
+	}
+	if err := a.metricsServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("can't shut down the metrics server: %w", err))
+	}
+	if a.redirectServer != nil {
+		if err := a.redirectServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("can't shut down the https redirect server: %w", err))
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		a.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("background workers didn't stop: %w", ctx.Err()))
+	}
+
+	if err := a.shutdownTracing(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("can't flush traces: %w", err))
+	}
+	if err := a.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("can't close the database: %w", err))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,145 @@
+//go:build integration
+
+package app_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/app"
+	"github.com/brown-kaew/assessment/pgtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+func TestApp_RunThenShutdown(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	conf, _ := pgtest.New(t)
+	conf.Port = ":0"
+	conf.MetricsPort = ":0"
+	conf.ShutdownDrain = 0
+	a, err := app.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan error, 1)
+	go func() {
+		ran <- a.Run(context.Background())
+	}()
+	for deadline := time.Now().Add(10 * time.Second); a.Addr() == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.Addr() == nil {
+		t.Fatal("the app didn't start listening")
+	}
+	url := "http://" + a.Addr().String() + "/readyz"
+	resp, err := http.Get(url)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = a.Shutdown(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, <-ran)
+	_, err = http.Get(url)
+	assert.Error(t, err)
+	assert.Error(t, a.DB().PingContext(ctx))
+}
+
+func TestApp_Shutdown_ShouldFailReadinessWhileDraining(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	conf, _ := pgtest.New(t)
+	conf.Port = ":0"
+	conf.MetricsPort = ":0"
+	conf.ShutdownDrain = time.Second
+	a, err := app.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ran := make(chan error, 1)
+	go func() {
+		ran <- a.Run(context.Background())
+	}()
+	for deadline := time.Now().Add(10 * time.Second); a.Addr() == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.Addr() == nil {
+		t.Fatal("the app didn't start listening")
+	}
+	base := "http://" + a.Addr().String()
+
+	// Act
+	start := time.Now()
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdown <- a.Shutdown(ctx)
+	}()
+	assert.NoError(t, <-ran)
+	ready, readyErr := http.Get(base + "/readyz")
+	live, liveErr := http.Get(base + "/livez")
+
+	// Assert
+	if assert.NoError(t, readyErr) {
+		ready.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, ready.StatusCode)
+	}
+	if assert.NoError(t, liveErr) {
+		live.Body.Close()
+		assert.Equal(t, http.StatusOK, live.StatusCode)
+	}
+	assert.NoError(t, <-shutdown)
+	assert.GreaterOrEqual(t, time.Since(start), conf.ShutdownDrain)
+	_, err = http.Get(base + "/livez")
+	assert.Error(t, err)
+}
+
+func TestApp_Run_MetricsPortInUse_ShouldFail(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	taken, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	conf, _ := pgtest.New(t)
+	conf.Port = ":0"
+	conf.MetricsPort = taken.Addr().String()
+	conf.ShutdownDrain = 0
+	a, err := app.New(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		a.Shutdown(ctx)
+	}()
+
+	// Act
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = a.Run(ctx)
+
+	// Assert
+	assert.ErrorContains(t, err, "can't start metrics server")
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	ScopeExpensesRead  = "expenses:read"
+	ScopeExpensesWrite = "expenses:write"
+	// ScopeAdmin grants every scope, and is the only one allowed to manage
+	// webhooks and API keys.
+	ScopeAdmin = "admin"
+
+	// SchemeApiKey prefixes API keys in the Authorization header.
+	SchemeApiKey = "ApiKey"
+)
+
+// Scopes lists every scope a credential can be granted.
+var Scopes = []string{ScopeExpensesRead, ScopeExpensesWrite, ScopeAdmin}
+
+// ErrInvalidKey is returned by a KeyAuthenticator for unknown keys.
+var ErrInvalidKey = errors.New("invalid API key")
+
+type contextKey struct{}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+// HasScope reports whether p was granted scope, directly or through admin.
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyAuthenticator resolves an API key to the principal it was issued to.
+type KeyAuthenticator interface {
+	AuthenticateKey(ctx context.Context, key string) (Principal, error)
+}
+
+// WithPrincipal returns a copy of ctx carrying p.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of the request ctx belongs to.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(Principal)
+	return p, ok
+}
+
+// ClientCertificate authenticates requests that present a verified TLS
+// client certificate whose subject is in identities, with the scopes listed
+// there. The principal is used by Middleware, which must run after it, for
+// requests without an Authorization header.
+func ClientCertificate(identities map[string][]string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			state := c.Request().TLS
+			if state == nil || len(state.VerifiedChains) == 0 {
+				return next(c)
+			}
+			subject := state.VerifiedChains[0][0].Subject.String()
+			scopes, ok := identities[subject]
+			if !ok {
+				return next(c)
+			}
+			principal := Principal{Subject: "cert:" + subject, Scopes: scopes}
+			c.SetRequest(c.Request().WithContext(WithPrincipal(c.Request().Context(), principal)))
+			return next(c)
+		}
+	}
+}
+
+// Middleware authenticates requests with `Authorization: ApiKey <key>` or a
+// client certificate accepted by ClientCertificate, and rejects those lacking
+// the scope their route requires.
+func Middleware(keys KeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			header := c.Request().Header.Get(echo.HeaderAuthorization)
+
+			var principal Principal
+			if scheme, key, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, SchemeApiKey) {
+				var err error
+				principal, err = keys.AuthenticateKey(ctx, key)
+				if err == ErrInvalidKey {
+					return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+				}
+				if err != nil {
+					return err
+				}
+			} else if p, ok := FromContext(ctx); ok && header == "" {
+				principal = p
+			} else {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
+			}
+
+			if scope := RequiredScope(c); !principal.HasScope(scope) {
+				return echo.NewHTTPError(http.StatusForbidden, "Missing scope "+scope)
+			}
+			c.SetRequest(c.Request().WithContext(WithPrincipal(ctx, principal)))
+			return next(c)
+		}
+	}
+}
+
+// grpcExpenseService prefixes the routes of the gRPC expense methods.
+const grpcExpenseService = "/expense.v1.ExpenseService/"
+
+// RequiredScope returns the scope needed for the route of c: reading
+// expenses and ledgers needs expenses:read, changing them expenses:write, and
+// everything else admin. What a principal may do within a ledger is further
+// limited by its role there.
+func RequiredScope(c echo.Context) string {
+	if method, ok := strings.CutPrefix(c.Path(), grpcExpenseService); ok {
+		// gRPC calls are all POSTs; the method name tells reads apart.
+		if strings.HasPrefix(method, "Get") || strings.HasPrefix(method, "List") {
+			return ScopeExpensesRead
+		}
+		return ScopeExpensesWrite
+	}
+	if c.Path() == "/graphql" {
+		// Queries and mutations share the route; mutations check for
+		// expenses:write themselves.
+		return ScopeExpensesRead
+	}
+	if !underAny(c.Path(), "/expenses", "/ledgers", "/invitations") {
+		return ScopeAdmin
+	}
+	switch c.Request().Method {
+	case http.MethodGet, http.MethodHead:
+		return ScopeExpensesRead
+	default:
+		return ScopeExpensesWrite
+	}
+}
+
+func underAny(path string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,128 @@
+//go:build unit
+
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type stubKeys map[string]Principal
+
+func (k stubKeys) AuthenticateKey(ctx context.Context, key string) (Principal, error) {
+	if key == "broken" {
+		return Principal{}, errors.New("connection refused")
+	}
+	principal, ok := k[key]
+	if !ok {
+		return Principal{}, ErrInvalidKey
+	}
+	return principal, nil
+}
+
+func newTestServer() *echo.Echo {
+	e := echo.New()
+	g := e.Group("", Middleware(stubKeys{
+		"reader": {Subject: "api-key:1", Scopes: []string{ScopeExpensesRead}},
+		"writer": {Subject: "api-key:2", Scopes: []string{ScopeExpensesRead, ScopeExpensesWrite}},
+		"admin":  {Subject: "api-key:3", Scopes: []string{ScopeAdmin}},
+	}))
+	whoami := func(c echo.Context) error {
+		principal, _ := FromContext(c.Request().Context())
+		return c.String(http.StatusOK, principal.Subject)
+	}
+	g.GET("/expenses", whoami)
+	g.POST("/expenses", whoami)
+	g.PUT("/expenses/:id", whoami)
+	g.POST("/webhooks", whoami)
+	g.POST("/expense.v1.ExpenseService/GetExpense", whoami)
+	g.POST("/expense.v1.ExpenseService/CreateExpense", whoami)
+	return e
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		target        string
+		authorization string
+		code          int
+		body          string
+	}{
+		{"api key with scope", http.MethodGet, "/expenses", "ApiKey reader", http.StatusOK, "api-key:1"},
+		{"scheme is case insensitive", http.MethodGet, "/expenses", "apikey reader", http.StatusOK, "api-key:1"},
+		{"read key can't create", http.MethodPost, "/expenses", "ApiKey reader", http.StatusForbidden, "Missing scope expenses:write"},
+		{"write key can update", http.MethodPut, "/expenses/1", "ApiKey writer", http.StatusOK, "api-key:2"},
+		{"write key can't manage webhooks", http.MethodPost, "/webhooks", "ApiKey writer", http.StatusForbidden, "Missing scope admin"},
+		{"read key can call gRPC get", http.MethodPost, "/expense.v1.ExpenseService/GetExpense", "ApiKey reader", http.StatusOK, "api-key:1"},
+		{"read key can't call gRPC create", http.MethodPost, "/expense.v1.ExpenseService/CreateExpense", "ApiKey reader", http.StatusForbidden, "Missing scope expenses:write"},
+		{"admin key can manage webhooks", http.MethodPost, "/webhooks", "ApiKey admin", http.StatusOK, "api-key:3"},
+		{"bare token", http.MethodPost, "/webhooks", "November 10, 2009", http.StatusUnauthorized, "Unauthorized"},
+		{"unknown key", http.MethodGet, "/expenses", "ApiKey nope", http.StatusUnauthorized, "Unauthorized"},
+		{"no credentials", http.MethodGet, "/expenses", "", http.StatusUnauthorized, "Unauthorized"},
+		{"store failure", http.MethodGet, "/expenses", "ApiKey broken", http.StatusInternalServerError, "Internal Server Error"},
+	}
+	e := newTestServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set(echo.HeaderAuthorization, tt.authorization)
+			rec := httptest.NewRecorder()
+
+			// Act
+			e.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.body)
+		})
+	}
+}
+
+func TestPrincipal_AdminHasEveryScope(t *testing.T) {
+	p := Principal{Scopes: []string{ScopeAdmin}}
+
+	assert.True(t, p.HasScope(ScopeExpensesRead))
+	assert.True(t, p.HasScope(ScopeExpensesWrite))
+}
+
+func TestMiddleware_CertificatePrincipal_ShouldBeUsedWithoutAuthorization(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	fromCertificate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := Principal{Subject: "cert:CN=reporting", Scopes: []string{ScopeExpensesRead}}
+			c.SetRequest(c.Request().WithContext(WithPrincipal(c.Request().Context(), principal)))
+			return next(c)
+		}
+	}
+	g := e.Group("", fromCertificate, Middleware(stubKeys{}))
+	g.GET("/expenses", func(c echo.Context) error {
+		principal, _ := FromContext(c.Request().Context())
+		return c.String(http.StatusOK, principal.Subject)
+	})
+	g.POST("/expenses", func(c echo.Context) error { return c.NoContent(http.StatusCreated) })
+	read := httptest.NewRecorder()
+	write := httptest.NewRecorder()
+	badKey := httptest.NewRecorder()
+	badKeyReq := httptest.NewRequest(http.MethodGet, "/expenses", nil)
+	badKeyReq.Header.Set(echo.HeaderAuthorization, "ApiKey nope")
+
+	// Act
+	e.ServeHTTP(read, httptest.NewRequest(http.MethodGet, "/expenses", nil))
+	e.ServeHTTP(write, httptest.NewRequest(http.MethodPost, "/expenses", nil))
+	e.ServeHTTP(badKey, badKeyReq)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, read.Code)
+	assert.Equal(t, "cert:CN=reporting", read.Body.String())
+	assert.Equal(t, http.StatusForbidden, write.Code)
+	assert.Equal(t, http.StatusUnauthorized, badKey.Code)
+}
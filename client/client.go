@@ -0,0 +1,262 @@
+// Package client is a typed Go client for the expense API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// The headers of the API the client sends. They are repeated here rather
+// than imported so the client doesn't depend on the server's packages.
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	HeaderLedgerId       = "X-Ledger-Id"
+
+	schemeApiKey = "ApiKey"
+)
+
+const (
+	defaultMaxRetries  = 3
+	defaultBaseBackoff = 100 * time.Millisecond
+	defaultMaxBackoff  = 5 * time.Second
+)
+
+// Client calls the expense API at one base URL. It is safe for concurrent
+// use.
+type Client struct {
+	baseURL       *url.URL
+	httpClient    *http.Client
+	authorization string
+	ledgerId      int
+	maxRetries    int
+	baseBackoff   time.Duration
+	maxBackoff    time.Duration
+}
+
+// Option configures a Client.
+type Option func(*Client)
+
+// WithApiKey authenticates every request with an API key.
+func WithApiKey(key string) Option {
+	return WithAuthorization(schemeApiKey + " " + key)
+}
+
+// WithAuthorization sends authorization as the Authorization header of
+// every request, for credentials WithApiKey doesn't cover.
+func WithAuthorization(authorization string) Option {
+	return func(c *Client) { c.authorization = authorization }
+}
+
+// WithLedger sends X-Ledger-Id with every request so that it runs in that
+// ledger.
+func WithLedger(id int) Option {
+	return func(c *Client) { c.ledgerId = id }
+}
+
+// WithHTTPClient sends requests with httpClient instead of a client with a
+// 30 second timeout, e.g. to present a TLS client certificate.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithRetries retries a failed request up to max times, waiting base before
+// the first retry and doubling the wait for each one after it. Zero max
+// disables retries.
+func WithRetries(max int, base time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = max
+		c.baseBackoff = base
+	}
+}
+
+// New returns a client of the API at baseURL, e.g. "https://localhost:2565".
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid base URL %q, expected scheme and host", baseURL)
+	}
+	c := &Client{
+		baseURL:     u,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		maxRetries:  defaultMaxRetries,
+		baseBackoff: defaultBaseBackoff,
+		maxBackoff:  defaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is a response with a status other than 2xx. Message and Errors are
+// read from its body; Errors lists the mismatches of requests rejected by
+// the API contract.
+type Error struct {
+	StatusCode int          `json:"-"`
+	Message    string       `json:"message"`
+	Errors     []FieldError `json:"errors"`
+}
+
+// FieldError is one way a request doesn't match the API contract. In is
+// body, path, query or header; Field is the parameter name, or a JSON
+// pointer into the body.
+type FieldError struct {
+	In     string `json:"in"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("expense API: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("expense API: %d %s", e.StatusCode, e.Message)
+}
+
+// request is one call to the API; it's rebuilt for every attempt so the
+// body can be sent again.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	header http.Header
+	body   any
+}
+
+// retryable reports whether req can be sent twice without doing its work
+// twice: POST only is, when the server deduplicates it by Idempotency-Key.
+func (r request) retryable() bool {
+	return r.method != http.MethodPost || r.header.Get(HeaderIdempotencyKey) != ""
+}
+
+// do sends req, retrying transport errors and the statuses retryStatus
+// lists, and decodes a 2xx response body into out unless it's nil. It
+// returns the final response's header.
+func (c *Client) do(ctx context.Context, req request, out any) (http.Header, error) {
+	var body []byte
+	if req.body != nil {
+		var err error
+		if body, err = json.Marshal(req.body); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.send(ctx, req, body)
+		retry := attempt < c.maxRetries && req.retryable() && ctx.Err() == nil
+		if err != nil {
+			if !retry {
+				return nil, err
+			}
+			if err := c.wait(ctx, c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+			defer resp.Body.Close()
+			if out != nil {
+				if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+					return nil, err
+				}
+			}
+			return resp.Header, nil
+		}
+
+		apiErr := readError(resp)
+		if !retry || !retryStatus[resp.StatusCode] {
+			return nil, apiErr
+		}
+		delay := c.backoff(attempt)
+		if after, ok := retryAfter(resp.Header); ok {
+			delay = after
+		}
+		if err := c.wait(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+var retryStatus = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+func (c *Client) send(ctx context.Context, req request, body []byte) (*http.Response, error) {
+	u := c.baseURL.JoinPath(req.path)
+	u.RawQuery = req.query.Encode()
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range req.header {
+		httpReq.Header[name] = values
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	httpReq.Header.Set("Accept", "application/json")
+	if c.authorization != "" {
+		httpReq.Header.Set("Authorization", c.authorization)
+	}
+	if c.ledgerId != 0 {
+		httpReq.Header.Set(HeaderLedgerId, strconv.Itoa(c.ledgerId))
+	}
+	return c.httpClient.Do(httpReq)
+}
+
+// readError reads the body of a failed response into an Error.
+func readError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(body, apiErr)
+	return apiErr
+}
+
+// backoff returns the delay before retrying after the given failed attempt,
+// counting from 0: baseBackoff doubled per attempt, capped at maxBackoff.
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.baseBackoff
+	for i := 0; i < attempt; i++ {
+		delay *= 2
+		if delay >= c.maxBackoff {
+			return c.maxBackoff
+		}
+	}
+	return delay
+}
+
+// retryAfter reads the Retry-After header, which the rate limiter sets in
+// seconds.
+func retryAfter(header http.Header) (time.Duration, bool) {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func (c *Client) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,290 @@
+//go:build unit
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/openapi"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc, opts ...Option) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	opts = append([]Option{WithRetries(3, time.Millisecond)}, opts...)
+	c, err := New(server.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestCreateExpense_ShouldSendCredentialsLedgerAndIdempotencyKey(t *testing.T) {
+	// Arrange
+	var got *http.Request
+	var body Expense
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		json.NewDecoder(r.Body).Decode(&body)
+		body.Id = 1
+		writeJSON(w, http.StatusCreated, body)
+	}, WithApiKey("secret"), WithLedger(7))
+	e := Expense{Title: "strawberry smoothie", Amount: 79, Tags: []string{"food"}}
+
+	// Act
+	created, err := c.CreateExpense(context.Background(), e)
+
+	// Assert
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.MethodPost, got.Method)
+		assert.Equal(t, "/expenses", got.URL.Path)
+		assert.Equal(t, "ApiKey secret", got.Header.Get("Authorization"))
+		assert.Equal(t, "7", got.Header.Get("X-Ledger-Id"))
+		assert.Len(t, got.Header.Get(HeaderIdempotencyKey), 32)
+		assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+		assert.Equal(t, e.Title, body.Title)
+		assert.Equal(t, 1, created.Id)
+	}
+}
+
+func TestGetAndUpdateExpense_ShouldUseExpensePath(t *testing.T) {
+	// Arrange
+	var requests []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		var e Expense
+		if r.Method == http.MethodPut {
+			json.NewDecoder(r.Body).Decode(&e)
+		} else {
+			e = Expense{Id: 3, Title: "apple"}
+		}
+		writeJSON(w, http.StatusOK, e)
+	})
+
+	// Act
+	got, getErr := c.GetExpense(context.Background(), 3)
+	updated, updateErr := c.UpdateExpense(context.Background(), Expense{Id: 3, Title: "pear"})
+
+	// Assert
+	assert.NoError(t, getErr)
+	assert.NoError(t, updateErr)
+	assert.Equal(t, []string{"GET /expenses/3", "PUT /expenses/3"}, requests)
+	assert.Equal(t, "apple", got.Title)
+	assert.Equal(t, "pear", updated.Title)
+}
+
+func TestGetExpense_ErrorResponse_ShouldReturnError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   any
+		want   Error
+	}{
+		{"not found", http.StatusNotFound, map[string]any{"message": "Expense not found"},
+			Error{StatusCode: http.StatusNotFound, Message: "Expense not found"}},
+		{"contract mismatch", http.StatusBadRequest, openapi.ValidationError{
+			Message: "Request doesn't match the API contract",
+			Errors:  []openapi.FieldError{{In: "path", Field: "id", Reason: "value must be an integer"}},
+		}, Error{StatusCode: http.StatusBadRequest, Message: "Request doesn't match the API contract",
+			Errors: []FieldError{{In: "path", Field: "id", Reason: "value must be an integer"}}}},
+		{"no body", http.StatusForbidden, nil, Error{StatusCode: http.StatusForbidden}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				writeJSON(w, tt.status, tt.body)
+			})
+
+			// Act
+			_, err := c.GetExpense(context.Background(), 1)
+
+			// Assert
+			var apiErr *Error
+			if assert.True(t, errors.As(err, &apiErr)) {
+				assert.Equal(t, tt.want, *apiErr)
+			}
+		})
+	}
+}
+
+func TestDo_ShouldRetryUnavailableWithSameIdempotencyKey(t *testing.T) {
+	// Arrange
+	var keys []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(HeaderIdempotencyKey))
+		if len(keys) < 3 {
+			w.Header().Set("Retry-After", "0")
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"message": "try later"})
+			return
+		}
+		writeJSON(w, http.StatusCreated, Expense{Id: 1})
+	})
+
+	// Act
+	created, err := c.CreateExpense(context.Background(), Expense{Title: "apple", Amount: 1})
+
+	// Assert
+	if assert.NoError(t, err) {
+		assert.Equal(t, 1, created.Id)
+		assert.Len(t, keys, 3)
+		assert.Equal(t, keys[0], keys[1])
+		assert.Equal(t, keys[0], keys[2])
+	}
+}
+
+func TestDo_ShouldGiveUpAfterMaxRetries(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		retries int
+		calls   int
+	}{
+		{"unavailable", http.StatusServiceUnavailable, 2, 3},
+		{"rate limited", http.StatusTooManyRequests, 1, 2},
+		{"retries disabled", http.StatusBadGateway, 0, 1},
+		{"not retryable", http.StatusInternalServerError, 3, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			calls := 0
+			c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				writeJSON(w, tt.status, nil)
+			}, WithRetries(tt.retries, time.Millisecond))
+
+			// Act
+			_, err := c.GetExpense(context.Background(), 1)
+
+			// Assert
+			var apiErr *Error
+			if assert.True(t, errors.As(err, &apiErr)) {
+				assert.Equal(t, tt.status, apiErr.StatusCode)
+			}
+			assert.Equal(t, tt.calls, calls)
+		})
+	}
+}
+
+func TestDo_CancelledWhileWaiting_ShouldReturnContextError(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		writeJSON(w, http.StatusServiceUnavailable, nil)
+	}, WithRetries(3, time.Hour))
+
+	// Act
+	_, err := c.GetExpense(ctx, 1)
+
+	// Assert
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+// pagedServer serves total expenses a page at a time, linking each full
+// page to the next like GET /expenses does.
+func pagedServer(total int, queries *[]string) http.HandlerFunc {
+	var mu sync.Mutex
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		*queries = append(*queries, r.URL.RawQuery)
+		mu.Unlock()
+		after, _ := strconv.Atoi(r.URL.Query().Get("after"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		page := []Expense{}
+		for id := after + 1; id <= total && len(page) < limit; id++ {
+			page = append(page, Expense{Id: id})
+		}
+		if len(page) == limit {
+			query := r.URL.Query()
+			query.Set("after", strconv.Itoa(page[len(page)-1].Id))
+			w.Header().Set("Link", fmt.Sprintf(`</expenses?%s>; rel="next"`, query.Encode()))
+		}
+		writeJSON(w, http.StatusOK, page)
+	}
+}
+
+func TestListExpenses_ShouldFollowNextLinks(t *testing.T) {
+	// Arrange
+	var queries []string
+	c := newTestClient(t, pagedServer(5, &queries))
+	asOf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Act
+	var ids []int
+	it := c.ListExpenses(ListOptions{PageSize: 2, AsOf: asOf})
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Expense().Id)
+	}
+
+	// Assert
+	assert.NoError(t, it.Err())
+	assert.Equal(t, []int{1, 2, 3, 4, 5}, ids)
+	assert.Equal(t, []string{
+		"as_of=2024-01-01T00%3A00%3A00Z&limit=2",
+		"after=2&as_of=2024-01-01T00%3A00%3A00Z&limit=2",
+		"after=4&as_of=2024-01-01T00%3A00%3A00Z&limit=2",
+	}, queries)
+}
+
+func TestListExpenses_FullLastPage_ShouldStopAtEmptyPage(t *testing.T) {
+	// Arrange
+	var queries []string
+	c := newTestClient(t, pagedServer(4, &queries))
+
+	// Act
+	count := 0
+	it := c.ListExpenses(ListOptions{PageSize: 2})
+	for it.Next(context.Background()) {
+		count++
+	}
+
+	// Assert
+	assert.NoError(t, it.Err())
+	assert.Equal(t, 4, count)
+	assert.Len(t, queries, 3)
+	assert.False(t, it.Next(context.Background()))
+}
+
+func TestListExpenses_Error_ShouldStopIteration(t *testing.T) {
+	// Arrange
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"message": "invalid key"})
+	})
+
+	// Act
+	it := c.ListExpenses(ListOptions{})
+	next := it.Next(context.Background())
+
+	// Assert
+	assert.False(t, next)
+	var apiErr *Error
+	if assert.True(t, errors.As(it.Err(), &apiErr)) {
+		assert.Equal(t, "invalid key", apiErr.Message)
+	}
+}
+
+func TestNew_InvalidBaseURL_ShouldFail(t *testing.T) {
+	// Act
+	_, err := New("localhost:2565")
+
+	// Assert
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const defaultPageSize = 100
+
+// Expense is an expense as the API sends and receives it.
+type Expense struct {
+	Id     int      `json:"id"`
+	Title  string   `json:"title"`
+	Amount float64  `json:"amount"`
+	Note   string   `json:"note"`
+	Tags   []string `json:"tags"`
+}
+
+// CreateExpense creates e and returns it with its Id. It is sent with a new
+// Idempotency-Key, so retrying it never creates the expense twice.
+func (c *Client) CreateExpense(ctx context.Context, e Expense) (*Expense, error) {
+	key, err := newIdempotencyKey()
+	if err != nil {
+		return nil, err
+	}
+	return c.CreateExpenseWithKey(ctx, key, e)
+}
+
+// CreateExpenseWithKey creates e with the given Idempotency-Key. Calling it
+// again with the same key, even from another process, returns the expense
+// the first call created instead of creating another.
+func (c *Client) CreateExpenseWithKey(ctx context.Context, key string, e Expense) (*Expense, error) {
+	var created Expense
+	_, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/expenses",
+		header: http.Header{HeaderIdempotencyKey: {key}},
+		body:   e,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// GetExpense returns the expense with id.
+func (c *Client) GetExpense(ctx context.Context, id int) (*Expense, error) {
+	var e Expense
+	_, err := c.do(ctx, request{method: http.MethodGet, path: "/expenses/" + strconv.Itoa(id)}, &e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// UpdateExpense replaces the expense with e.Id by e and returns it.
+func (c *Client) UpdateExpense(ctx context.Context, e Expense) (*Expense, error) {
+	var updated Expense
+	_, err := c.do(ctx, request{method: http.MethodPut, path: "/expenses/" + strconv.Itoa(e.Id), body: e}, &updated)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// ListOptions selects the expenses ListExpenses iterates over.
+type ListOptions struct {
+	// PageSize is how many expenses are fetched per request, 100 if zero.
+	PageSize int
+	// AsOf lists the expenses as they were at that time, unless it is zero.
+	AsOf time.Time
+}
+
+// ListExpenses iterates over the expenses in id order, fetching them a page
+// at a time as Next is called:
+//
+//	it := c.ListExpenses(opts)
+//	for it.Next(ctx) {
+//		e := it.Expense()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+func (c *Client) ListExpenses(opts ListOptions) *ExpenseIterator {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	query := url.Values{"limit": {strconv.Itoa(pageSize)}}
+	if !opts.AsOf.IsZero() {
+		query.Set("as_of", opts.AsOf.Format(time.RFC3339Nano))
+	}
+	return &ExpenseIterator{client: c, next: &request{method: http.MethodGet, path: "/expenses", query: query}}
+}
+
+// ExpenseIterator is the cursor ListExpenses returns. It follows the Link
+// header of each page to the next one until a page has none.
+type ExpenseIterator struct {
+	client  *Client
+	next    *request
+	page    []Expense
+	current Expense
+	err     error
+}
+
+// Next advances to the next expense, fetching the next page when the
+// current one is used up. It returns false at the end, or on an error that
+// Err then returns.
+func (it *ExpenseIterator) Next(ctx context.Context) bool {
+	for len(it.page) == 0 {
+		if it.err != nil || it.next == nil {
+			return false
+		}
+		var page []Expense
+		header, err := it.client.do(ctx, *it.next, &page)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.page = page
+		if it.next, err = nextPage(header); err != nil {
+			it.err = err
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Expense returns the expense Next advanced to.
+func (it *ExpenseIterator) Expense() Expense {
+	return it.current
+}
+
+// Err returns the error that ended the iteration, if any.
+func (it *ExpenseIterator) Err() error {
+	return it.err
+}
+
+var nextLink = regexp.MustCompile(`<([^>]*)>\s*;\s*rel="next"`)
+
+// nextPage reads the request for the next page from the Link header, or
+// returns nil when there is none.
+func nextPage(header http.Header) (*request, error) {
+	match := nextLink.FindStringSubmatch(header.Get("Link"))
+	if match == nil {
+		return nil, nil
+	}
+	u, err := url.Parse(match[1])
+	if err != nil {
+		return nil, err
+	}
+	return &request{method: http.MethodGet, path: u.Path, query: u.Query()}, nil
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brown-kaew/assessment/client"
+)
+
+// tagsFlag collects a flag given several times.
+type tagsFlag []string
+
+func (t *tagsFlag) String() string { return strings.Join(*t, ",") }
+
+func (t *tagsFlag) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+// asOfFlag reads a time like the as_of query parameter: an RFC 3339
+// timestamp, or a date meaning the end of that day in UTC.
+type asOfFlag struct{ time.Time }
+
+func (a *asOfFlag) Set(value string) error {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err == nil {
+		a.Time = t
+		return nil
+	}
+	if t, err = time.Parse("2006-01-02", value); err == nil {
+		a.Time = t.Add(24*time.Hour - time.Nanosecond)
+		return nil
+	}
+	return errors.New("expected RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+// newFlags returns the flag set of a command, with the -o output flag every
+// command accepts.
+func newFlags(name string, env *env) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&env.output, "o", env.output, "output format: table, json or csv")
+	return flags
+}
+
+// parse parses args allowing flags after the positional arguments, which it
+// returns.
+func parse(flags *flag.FlagSet, env *env, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := flags.Parse(args); err != nil {
+			fmt.Fprintln(env.stderr, err)
+			return nil, errUsage
+		}
+		if flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if !validFormat(env.output, formatTable, formatJSON, formatCSV) {
+		fmt.Fprintf(env.stderr, "invalid output %q, expected table, json or csv\n", env.output)
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+func parseId(arg string) (int, error) {
+	id, err := strconv.Atoi(arg)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid id %q, expected a positive integer", arg)
+	}
+	return id, nil
+}
+
+// expenseFlags registers the fields of an expense as flags of a command.
+func expenseFlags(flags *flag.FlagSet, e *client.Expense) *tagsFlag {
+	flags.StringVar(&e.Title, "title", e.Title, "title of the expense")
+	flags.Float64Var(&e.Amount, "amount", e.Amount, "amount of the expense")
+	flags.StringVar(&e.Note, "note", e.Note, "note on the expense")
+	tags := &tagsFlag{}
+	flags.Var(tags, "tag", "tag of the expense, repeat for several")
+	return tags
+}
+
+func addCommand(ctx context.Context, env *env, args []string) error {
+	flags := newFlags("add", env)
+	var e client.Expense
+	tags := expenseFlags(flags, &e)
+	positional, err := parse(flags, env, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 || e.Title == "" {
+		return errUsage
+	}
+	e.Tags = *tags
+
+	created, err := env.client.CreateExpense(ctx, e)
+	if err != nil {
+		return err
+	}
+	return writeExpense(env.stdout, env.output, *created)
+}
+
+func getCommand(ctx context.Context, env *env, args []string) error {
+	positional, err := parse(newFlags("get", env), env, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return errUsage
+	}
+	id, err := parseId(positional[0])
+	if err != nil {
+		return err
+	}
+
+	e, err := env.client.GetExpense(ctx, id)
+	if err != nil {
+		return err
+	}
+	return writeExpense(env.stdout, env.output, *e)
+}
+
+// updateCommand changes the fields given as flags, keeping the others. Tags
+// given replace all the tags.
+func updateCommand(ctx context.Context, env *env, args []string) error {
+	flags := newFlags("update", env)
+	var changes client.Expense
+	tags := expenseFlags(flags, &changes)
+	positional, err := parse(flags, env, args)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	delete(set, "o")
+	if len(positional) != 1 || len(set) == 0 {
+		return errUsage
+	}
+	id, err := parseId(positional[0])
+	if err != nil {
+		return err
+	}
+
+	e, err := env.client.GetExpense(ctx, id)
+	if err != nil {
+		return err
+	}
+	if set["title"] {
+		e.Title = changes.Title
+	}
+	if set["amount"] {
+		e.Amount = changes.Amount
+	}
+	if set["note"] {
+		e.Note = changes.Note
+	}
+	if set["tag"] {
+		e.Tags = *tags
+	}
+	updated, err := env.client.UpdateExpense(ctx, *e)
+	if err != nil {
+		return err
+	}
+	return writeExpense(env.stdout, env.output, *updated)
+}
+
+func listExpenses(ctx context.Context, c *client.Client, opts client.ListOptions) ([]client.Expense, error) {
+	expenses := []client.Expense{}
+	it := c.ListExpenses(opts)
+	for it.Next(ctx) {
+		expenses = append(expenses, it.Expense())
+	}
+	return expenses, it.Err()
+}
+
+func listCommand(ctx context.Context, env *env, args []string) error {
+	flags := newFlags("list", env)
+	var opts client.ListOptions
+	var asOf asOfFlag
+	flags.IntVar(&opts.PageSize, "page-size", 100, "expenses fetched per request")
+	flags.Var(&asOf, "as-of", "list the expenses as they were at this time")
+	positional, err := parse(flags, env, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 {
+		return errUsage
+	}
+	opts.AsOf = asOf.Time
+
+	expenses, err := listExpenses(ctx, env.client, opts)
+	if err != nil {
+		return err
+	}
+	return writeExpenses(env.stdout, env.output, expenses)
+}
+
+// fileFormat is format when given, else the format named by the extension of
+// file, else fallback when it is a file format, else CSV.
+func fileFormat(format, file, fallback string) string {
+	if format != "" {
+		return format
+	}
+	switch ext := filepath.Ext(file); {
+	case strings.EqualFold(ext, ".json"):
+		return formatJSON
+	case strings.EqualFold(ext, ".csv"):
+		return formatCSV
+	}
+	if fallback == formatJSON {
+		return formatJSON
+	}
+	return formatCSV
+}
+
+// importCommand creates every expense of a file written by export, or by
+// hand, in order. Their ids are ignored; they get new ones. Each is sent
+// with an Idempotency-Key derived from the file's content and its index, so
+// importing a file again after a failure creates only what's missing.
+func importCommand(ctx context.Context, env *env, args []string) error {
+	flags := newFlags("import", env)
+	format := flags.String("format", "", "format of the file, json or csv; from its extension by default")
+	positional, err := parse(flags, env, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 || !validFormat(*format, "", formatJSON, formatCSV) {
+		return errUsage
+	}
+
+	in := env.stdin
+	file := "-"
+	if len(positional) == 1 && positional[0] != "-" {
+		file = positional[0]
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	content, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	expenses, err := readExpenses(bytes.NewReader(content), fileFormat(*format, file, formatCSV))
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(content)
+	created := make([]client.Expense, 0, len(expenses))
+	for i, e := range expenses {
+		e.Id = 0
+		c, err := env.client.CreateExpenseWithKey(ctx, importKey(sum, i), e)
+		if err != nil {
+			writeExpenses(env.stdout, env.output, created)
+			return fmt.Errorf("expense %d of %d: %w", i+1, len(expenses), err)
+		}
+		created = append(created, *c)
+	}
+	return writeExpenses(env.stdout, env.output, created)
+}
+
+// importKey is the Idempotency-Key of the expense at index of a file whose
+// content hashes to sum.
+func importKey(sum [sha256.Size]byte, index int) string {
+	return "import-" + hex.EncodeToString(sum[:]) + "-" + strconv.Itoa(index)
+}
+
+func exportCommand(ctx context.Context, env *env, args []string) error {
+	flags := newFlags("export", env)
+	format := flags.String("format", "", "format of the file, json or csv; from its extension or -o by default")
+	file := flags.String("file", "-", "file to write, - for stdout")
+	var asOf asOfFlag
+	flags.Var(&asOf, "as-of", "export the expenses as they were at this time")
+	positional, err := parse(flags, env, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 0 || !validFormat(*format, "", formatJSON, formatCSV) {
+		return errUsage
+	}
+
+	expenses, err := listExpenses(ctx, env.client, client.ListOptions{PageSize: 1000, AsOf: asOf.Time})
+	if err != nil {
+		return err
+	}
+	if *file == "-" {
+		return writeExpenses(env.stdout, fileFormat(*format, *file, env.output), expenses)
+	}
+	f, err := os.Create(*file)
+	if err != nil {
+		return err
+	}
+	if err := writeExpenses(f, fileFormat(*format, *file, env.output), expenses); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(env.stderr, "exported %d expenses to %s\n", len(expenses), *file)
+	return nil
+}
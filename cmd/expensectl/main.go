@@ -0,0 +1,181 @@
+// Command expensectl manages expenses through the HTTP API.
+//
+//	expensectl [--config file] [--server url] [--ledger id] <command> [flags] [args]
+//
+// Credentials are read from the config file, $EXPENSECTL_CONFIG or
+// expensectl/config.yaml in the user config directory by default:
+//
+//	server: https://expenses.example.com
+//	api_key: <key>   # or authorization: <Authorization header value>
+//	ledger: 7        # optional, a shared ledger to act on
+//	output: table    # table, json or csv
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/brown-kaew/assessment/client"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultServer = "http://localhost:2565"
+
+// errUsage is returned for invalid arguments, after the usage was printed.
+var errUsage = errors.New("usage")
+
+// Config is the content of the config file.
+type Config struct {
+	Server        string `yaml:"server"`
+	ApiKey        string `yaml:"api_key"`
+	Authorization string `yaml:"authorization"`
+	Ledger        int    `yaml:"ledger"`
+	Output        string `yaml:"output"`
+}
+
+// loadConfig reads the config file at path. The default path may be
+// missing, in which case the defaults are used.
+func loadConfig(path string, required bool) (Config, error) {
+	conf := Config{Server: defaultServer, Output: formatTable}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return conf, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return conf, nil
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("EXPENSECTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "expensectl", "config.yaml")
+}
+
+// env is what every command runs with.
+type env struct {
+	client *client.Client
+	output string
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	usage string
+	run   func(ctx context.Context, env *env, args []string) error
+}
+
+var commands = map[string]command{
+	"add":    {"add --title <title> --amount <amount> [--note <note>] [--tag <tag>]...", addCommand},
+	"get":    {"get <id>", getCommand},
+	"update": {"update <id> [--title <title>] [--amount <amount>] [--note <note>] [--tag <tag>]...", updateCommand},
+	"list":   {"list [--page-size <n>] [--as-of <time>]", listCommand},
+	"import": {"import [--format json|csv] [file]", importCommand},
+	"export": {"export [--format json|csv] [--file <file>] [--as-of <time>]", exportCommand},
+}
+
+var commandOrder = []string{"add", "get", "update", "list", "import", "export"}
+
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: expensectl [flags] <command> [flags] [args]\n\ncommands:")
+	for _, name := range commandOrder {
+		fmt.Fprintf(w, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintln(w, "\nflags:")
+	flags.SetOutput(w)
+	flags.PrintDefaults()
+}
+
+// run runs expensectl with args and returns its exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("expensectl", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	configPath := flags.String("config", defaultConfigPath(), "config file with the server and credentials")
+	server := flags.String("server", "", "base URL of the API, overriding the config file")
+	ledger := flags.Int("ledger", 0, "shared ledger to act on, overriding the config file")
+	output := flags.String("o", "", "output format: table, json or csv")
+	if err := flags.Parse(args); err != nil || flags.NArg() == 0 {
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(stderr, err)
+		}
+		usage(stderr, flags)
+		return 2
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", flags.Arg(0))
+		usage(stderr, flags)
+		return 2
+	}
+
+	explicit := false
+	flags.Visit(func(f *flag.Flag) { explicit = explicit || f.Name == "config" })
+	conf, err := loadConfig(*configPath, explicit || os.Getenv("EXPENSECTL_CONFIG") != "")
+	if err != nil {
+		fmt.Fprintln(stderr, "expensectl:", err)
+		return 1
+	}
+	if *server != "" {
+		conf.Server = *server
+	}
+	if *ledger != 0 {
+		conf.Ledger = *ledger
+	}
+	if *output != "" {
+		conf.Output = *output
+	}
+	if !validFormat(conf.Output, formatTable, formatJSON, formatCSV) {
+		fmt.Fprintf(stderr, "expensectl: invalid output %q, expected table, json or csv\n", conf.Output)
+		return 2
+	}
+
+	var opts []client.Option
+	if conf.ApiKey != "" {
+		opts = append(opts, client.WithApiKey(conf.ApiKey))
+	} else if conf.Authorization != "" {
+		opts = append(opts, client.WithAuthorization(conf.Authorization))
+	}
+	if conf.Ledger != 0 {
+		opts = append(opts, client.WithLedger(conf.Ledger))
+	}
+	c, err := client.New(conf.Server, opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, "expensectl:", err)
+		return 1
+	}
+
+	err = cmd.run(ctx, &env{client: c, output: conf.Output, stdin: stdin, stdout: stdout, stderr: stderr}, flags.Args()[1:])
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(stderr, "usage: expensectl", cmd.usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "expensectl:", err)
+		return 1
+	}
+	return 0
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
@@ -0,0 +1,155 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/brown-kaew/assessment/app"
+	"github.com/brown-kaew/assessment/client"
+	"github.com/brown-kaew/assessment/openapi"
+	"github.com/brown-kaew/assessment/pgtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
+}
+
+// startServer serves the API for t on a database of its own and returns a
+// config file pointing expensectl at it with an API key made for it, the
+// way a user would configure it.
+func startServer(t *testing.T) string {
+	t.Parallel()
+	conf, a := pgtest.StartApp(t, app.WithOpenAPIOptions(openapi.Options{ValidateResponses: true}))
+	server := "http://localhost" + conf.Port
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "server: " + server + "\napi_key: " + createApiKey(t, server, pgtest.AdminKey(t, a.DB())) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// createApiKey creates an API key to read and write expenses through the
+// API at server, authorized by admin, and returns it.
+func createApiKey(t *testing.T, server string, admin string) string {
+	t.Helper()
+	body := `{"name":"expensectl","scopes":["expenses:read","expenses:write"]}`
+	req, err := http.NewRequest(http.MethodPost, server+"/api-keys", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", admin)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var created struct {
+		Key string `json:"key"`
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("can't create an API key: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	return created.Key
+}
+
+// expensectl runs the command with args and returns its stdout.
+func expensectl(t *testing.T, config string, stdin string, args ...string) string {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), append([]string{"--config", config}, args...), strings.NewReader(stdin), &stdout, &stderr)
+	assert.Equal(t, 0, code, "expensectl %s: %s", strings.Join(args, " "), stderr.String())
+	return stdout.String()
+}
+
+func TestExpensectl_AddGetUpdate(t *testing.T) {
+	config := startServer(t)
+
+	// Arrange
+	var added client.Expense
+	out := expensectl(t, config, "", "add", "--title", "strawberry smoothie", "--amount", "79", "--tag", "food", "--tag", "beverage", "-o", "json")
+	assert.NoError(t, json.Unmarshal([]byte(out), &added))
+	row := strings.Split(expensectl(t, config, "", "get", "-o", "csv", strconv.Itoa(added.Id)), "\n")[1]
+
+	// Act
+	var updated client.Expense
+	out = expensectl(t, config, "", "update", strconv.Itoa(added.Id), "--amount", "89", "--note", "no discount", "-o", "json")
+
+	// Assert
+	assert.Equal(t, strconv.Itoa(added.Id)+`,strawberry smoothie,79,,"food,beverage"`, row)
+	if assert.NoError(t, json.Unmarshal([]byte(out), &updated)) {
+		assert.Equal(t, client.Expense{Id: added.Id, Title: "strawberry smoothie", Amount: 89, Note: "no discount", Tags: []string{"food", "beverage"}}, updated)
+	}
+}
+
+func TestExpensectl_ExportThenImport_ShouldCopyExpenses(t *testing.T) {
+	config := startServer(t)
+
+	// Arrange
+	expensectl(t, config, "", "add", "--title", "apple", "--amount", "10")
+	file := filepath.Join(t.TempDir(), "expenses.csv")
+	expensectl(t, config, "", "export", "--file", file)
+	exported, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	before := strings.Count(string(exported), "\n") - 1
+
+	// Act
+	var imported []client.Expense
+	out := expensectl(t, config, "", "import", "-o", "json", file)
+
+	// Assert
+	if assert.NoError(t, json.Unmarshal([]byte(out), &imported)) {
+		assert.Len(t, imported, before)
+	}
+	var listed []client.Expense
+	assert.NoError(t, json.Unmarshal([]byte(expensectl(t, config, "", "list", "--page-size", "7", "-o", "json")), &listed))
+	assert.GreaterOrEqual(t, len(listed), 2*before)
+}
+
+func TestExpensectl_ImportFromStdin(t *testing.T) {
+	config := startServer(t)
+
+	// Act
+	out := expensectl(t, config, `[{"title":"pear","amount":12,"tags":["fruit"]}]`, "import", "--format", "json", "-")
+
+	// Assert
+	assert.Contains(t, out, "pear")
+	assert.Contains(t, out, "fruit")
+}
+
+func TestExpensectl_ImportTwice_ShouldCreateExpensesOnce(t *testing.T) {
+	config := startServer(t)
+
+	// Arrange
+	file := filepath.Join(t.TempDir(), "expenses.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`[{"title":"pear","amount":12},{"title":"pear","amount":12}]`), 0600))
+	var first, second []client.Expense
+	assert.NoError(t, json.Unmarshal([]byte(expensectl(t, config, "", "import", "-o", "json", file)), &first))
+
+	// Act
+	out := expensectl(t, config, "", "import", "-o", "json", file)
+
+	// Assert
+	if assert.NoError(t, json.Unmarshal([]byte(out), &second)) {
+		assert.Len(t, second, 2)
+		assert.Equal(t, first, second)
+	}
+	var listed []client.Expense
+	assert.NoError(t, json.Unmarshal([]byte(expensectl(t, config, "", "list", "-o", "json")), &listed))
+	assert.Len(t, listed, 2)
+}
@@ -0,0 +1,152 @@
+//go:build unit
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/brown-kaew/assessment/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		required bool
+		want     Config
+		err      bool
+	}{
+		{"file", writeConfig(t, "server: https://expenses.example.com\napi_key: secret\nledger: 7\n"), true,
+			Config{Server: "https://expenses.example.com", ApiKey: "secret", Ledger: 7, Output: formatTable}, false},
+		{"missing default", filepath.Join(t.TempDir(), "missing.yaml"), false,
+			Config{Server: defaultServer, Output: formatTable}, false},
+		{"missing explicit", filepath.Join(t.TempDir(), "missing.yaml"), true, Config{}, true},
+		{"invalid", writeConfig(t, "ledger: household\n"), true, Config{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			got, err := loadConfig(tt.path, tt.required)
+
+			// Assert
+			assert.Equal(t, tt.err, err != nil, "error: %v", err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRun_InvalidArguments_ShouldExitWithUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"no command", nil},
+		{"unknown command", []string{"remove", "1"}},
+		{"missing id", []string{"get"}},
+		{"invalid output", []string{"list", "-o", "yaml"}},
+		{"add without title", []string{"add", "--amount", "79"}},
+		{"update without changes", []string{"update", "1"}},
+	}
+	config := writeConfig(t, "server: http://localhost:1\n")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var stdout, stderr bytes.Buffer
+
+			// Act
+			code := run(context.Background(), append([]string{"--config", config}, tt.args...), nil, &stdout, &stderr)
+
+			// Assert
+			assert.Equal(t, 2, code)
+			assert.Contains(t, stderr.String(), "usage: expensectl")
+			assert.Empty(t, stdout.String())
+		})
+	}
+}
+
+func TestRun_ShouldSendCredentialsFromConfig(t *testing.T) {
+	// Arrange
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(client.Expense{Id: 3, Title: "apple", Amount: 10})
+	}))
+	defer server.Close()
+	config := writeConfig(t, "server: "+server.URL+"\napi_key: secret\nledger: 7\n")
+	var stdout, stderr bytes.Buffer
+
+	// Act
+	code := run(context.Background(), []string{"--config", config, "get", "3", "-o", "csv"}, nil, &stdout, &stderr)
+
+	// Assert
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "/expenses/3", got.URL.Path)
+	assert.Equal(t, "ApiKey secret", got.Header.Get("Authorization"))
+	assert.Equal(t, "7", got.Header.Get("X-Ledger-Id"))
+	assert.Equal(t, "id,title,amount,note,tags\n3,apple,10,,\n", stdout.String())
+}
+
+func TestRun_ApiError_ShouldExitWithMessage(t *testing.T) {
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"Expense not found"}`))
+	}))
+	defer server.Close()
+	var stdout, stderr bytes.Buffer
+
+	// Act
+	code := run(context.Background(), []string{"--config", writeConfig(t, ""), "--server", server.URL, "get", "3"}, nil, &stdout, &stderr)
+
+	// Assert
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "expensectl: expense API: 404 Expense not found\n", stderr.String())
+	assert.Empty(t, stdout.String())
+}
+
+func TestRun_ImportTwice_ShouldSendTheSameIdempotencyKeys(t *testing.T) {
+	// Arrange
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys = append(keys, r.Header.Get(client.HeaderIdempotencyKey))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(client.Expense{Id: len(keys), Title: "apple", Amount: 10})
+	}))
+	defer server.Close()
+	config := writeConfig(t, "server: "+server.URL+"\n")
+	file := `[{"title":"apple","amount":10},{"title":"apple","amount":10}]`
+	var stdout, stderr bytes.Buffer
+
+	// Act
+	for i := 0; i < 2; i++ {
+		code := run(context.Background(), []string{"--config", config, "import", "--format", "json", "-"}, strings.NewReader(file), &stdout, &stderr)
+		assert.Equal(t, 0, code, stderr.String())
+	}
+
+	// Assert
+	if assert.Len(t, keys, 4) {
+		assert.NotEmpty(t, keys[0])
+		assert.NotEqual(t, keys[0], keys[1])
+		assert.Equal(t, keys[:2], keys[2:])
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/brown-kaew/assessment/client"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+// csvHeader is the header row of the CSV format; tags are one
+// comma-separated cell.
+var csvHeader = []string{"id", "title", "amount", "note", "tags"}
+
+func validFormat(format string, valid ...string) bool {
+	for _, v := range valid {
+		if format == v {
+			return true
+		}
+	}
+	return false
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', -1, 64)
+}
+
+// writeExpense writes one expense: an object in JSON, a single row
+// otherwise.
+func writeExpense(w io.Writer, format string, e client.Expense) error {
+	if format == formatJSON {
+		return writeJSON(w, e)
+	}
+	return writeExpenses(w, format, []client.Expense{e})
+}
+
+func writeExpenses(w io.Writer, format string, expenses []client.Expense) error {
+	switch format {
+	case formatJSON:
+		return writeJSON(w, expenses)
+	case formatCSV:
+		out := csv.NewWriter(w)
+		out.Write(csvHeader)
+		for _, e := range expenses {
+			out.Write([]string{strconv.Itoa(e.Id), e.Title, formatAmount(e.Amount), e.Note, strings.Join(e.Tags, ",")})
+		}
+		out.Flush()
+		return out.Error()
+	default:
+		out := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(out, "ID\tTITLE\tAMOUNT\tNOTE\tTAGS")
+		for _, e := range expenses {
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\n", e.Id, e.Title, formatAmount(e.Amount), e.Note, strings.Join(e.Tags, ","))
+		}
+		return out.Flush()
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// readExpenses reads what writeExpenses wrote in JSON or CSV. CSV columns
+// are found by the header, in any order; id, note and tags may be left out.
+func readExpenses(r io.Reader, format string) ([]client.Expense, error) {
+	if format == formatJSON {
+		var expenses []client.Expense
+		if err := json.NewDecoder(r).Decode(&expenses); err != nil {
+			return nil, fmt.Errorf("invalid JSON, expected an array of expenses: %w", err)
+		}
+		return expenses, nil
+	}
+
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+	header, err := in.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV, expected a header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"title", "amount"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("invalid CSV, expected a %s column", name)
+		}
+	}
+
+	var expenses []client.Expense
+	for {
+		record, err := in.Read()
+		if err == io.EOF {
+			return expenses, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := in.FieldPos(0)
+		cell := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		e := client.Expense{Title: cell("title"), Note: cell("note")}
+		if e.Amount, err = strconv.ParseFloat(cell("amount"), 64); err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", line, cell("amount"))
+		}
+		if id := cell("id"); id != "" {
+			if e.Id, err = strconv.Atoi(id); err != nil {
+				return nil, fmt.Errorf("line %d: invalid id %q", line, id)
+			}
+		}
+		if tags := cell("tags"); tags != "" {
+			for _, tag := range strings.Split(tags, ",") {
+				e.Tags = append(e.Tags, strings.TrimSpace(tag))
+			}
+		}
+		expenses = append(expenses, e)
+	}
+}
@@ -0,0 +1,134 @@
+//go:build unit
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/brown-kaew/assessment/client"
+	"github.com/stretchr/testify/assert"
+)
+
+var smoothie = client.Expense{
+	Id:     1,
+	Title:  "strawberry smoothie",
+	Amount: 79.5,
+	Note:   "night market, 10 bath off",
+	Tags:   []string{"food", "beverage"},
+}
+
+func TestWriteExpenses(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{formatTable, "ID  TITLE                AMOUNT  NOTE                       TAGS\n" +
+			"1   strawberry smoothie  79.5    night market, 10 bath off  food,beverage\n"},
+		{formatCSV, "id,title,amount,note,tags\n" +
+			"1,strawberry smoothie,79.5,\"night market, 10 bath off\",\"food,beverage\"\n"},
+		{formatJSON, `[
+  {
+    "id": 1,
+    "title": "strawberry smoothie",
+    "amount": 79.5,
+    "note": "night market, 10 bath off",
+    "tags": [
+      "food",
+      "beverage"
+    ]
+  }
+]
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			// Arrange
+			var out bytes.Buffer
+
+			// Act
+			err := writeExpenses(&out, tt.format, []client.Expense{smoothie})
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, out.String())
+		})
+	}
+}
+
+func TestReadExpenses_ShouldReadWhatWriteExpensesWrote(t *testing.T) {
+	for _, format := range []string{formatJSON, formatCSV} {
+		t.Run(format, func(t *testing.T) {
+			// Arrange
+			var out bytes.Buffer
+			writeExpenses(&out, format, []client.Expense{smoothie, {Id: 2, Title: "apple", Amount: 10}})
+
+			// Act
+			got, err := readExpenses(&out, format)
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, []client.Expense{smoothie, {Id: 2, Title: "apple", Amount: 10}}, got)
+		})
+	}
+}
+
+func TestReadExpenses_CSVColumnsInAnyOrder(t *testing.T) {
+	// Arrange
+	in := "Amount,Title\n79,strawberry smoothie\n"
+
+	// Act
+	got, err := readExpenses(strings.NewReader(in), formatCSV)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []client.Expense{{Title: "strawberry smoothie", Amount: 79}}, got)
+}
+
+func TestReadExpenses_InvalidCSV_ShouldFail(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "", "invalid CSV, expected a header"},
+		{"missing column", "title\napple\n", "invalid CSV, expected a amount column"},
+		{"invalid amount", "title,amount\napple,10\npear,ten\n", `line 3: invalid amount "ten"`},
+		{"invalid id", "id,title,amount\nx,apple,10\n", `line 2: invalid id "x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			_, err := readExpenses(strings.NewReader(tt.in), formatCSV)
+
+			// Assert
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFileFormat(t *testing.T) {
+	tests := []struct {
+		format, file, fallback string
+		want                   string
+	}{
+		{formatCSV, "expenses.json", formatJSON, formatCSV},
+		{"", "expenses.JSON", formatCSV, formatJSON},
+		{"", "expenses.csv", formatJSON, formatCSV},
+		{"", "-", formatJSON, formatJSON},
+		{"", "expenses", formatJSON, formatJSON},
+		{"", "-", formatTable, formatCSV},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.file+" "+tt.fallback, func(t *testing.T) {
+			// Act
+			got := fileFormat(tt.format, tt.file, tt.fallback)
+
+			// Assert
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"github.com/brown-kaew/assessment/admin"
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/migration"
+	"github.com/brown-kaew/assessment/seed"
+)
+
+const usage = "usage: go-assessment [serve | migrate | create-api-key | seed | export | reindex | vacuum-deleted | config print] [flags]"
+
+// loadConfig loads the configuration from args, exiting on invalid settings
+// so a misconfigured deployment fails before it touches anything.
+func loadConfig(args []string, define ...func(*flag.FlagSet)) config.Config {
+	conf, err := config.Load(args, define...)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	return conf
+}
+
+// configCommand runs `config print`, which writes the effective
+// configuration with secrets redacted.
+func configCommand(args []string) {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err := config.Print(os.Stdout, loadConfig(args[1:])); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// task is a maintenance subcommand. define adds its own flags to those of
+// the configuration.
+type task struct {
+	define func(*flag.FlagSet)
+	run    func(ctx context.Context, db *sql.DB) error
+}
+
+func tasks() map[string]task {
+	var file string
+	var concurrently bool
+	var retention time.Duration
+	var generate seed.Options
+	var ledgerId int
+	var key apikey.ApiKey
+	var scopes string
+	fileFlag := func(usage string) func(*flag.FlagSet) {
+		return func(fs *flag.FlagSet) {
+			fs.StringVar(&file, "file", "-", usage)
+		}
+	}
+	return map[string]task{
+		"migrate": {run: migrate},
+		"create-api-key": {
+			define: func(fs *flag.FlagSet) {
+				fs.StringVar(&key.Name, "name", "admin", "name of the key")
+				fs.StringVar(&scopes, "scopes", auth.ScopeAdmin, "comma separated scopes of the key")
+			},
+			run: func(ctx context.Context, db *sql.DB) error {
+				key.Scopes = strings.Split(scopes, ",")
+				if err := key.Validate(); err != nil {
+					return err
+				}
+				if err := apikey.Create(ctx, db, &key); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "created API key %d %q with scopes %s; it isn't shown again\n", key.Id, key.Name, scopes)
+				fmt.Println(key.Key)
+				return nil
+			},
+		},
+		"seed": {
+			define: func(fs *flag.FlagSet) {
+				fileFlag("expenses to insert, one JSON object per line as export writes them; - for stdin")(fs)
+				fs.IntVar(&generate.Count, "count", 0, "generate this many expenses instead of reading file")
+				fs.Int64Var(&generate.Seed, "seed", 1, "seed of the generated expenses; the same seed makes the same expenses")
+				fs.IntVar(&ledgerId, "ledger", 0, "ledger of the generated expenses, 0 for none")
+			},
+			run: func(ctx context.Context, db *sql.DB) error {
+				if generate.Count > 0 {
+					if ledgerId != 0 {
+						generate.LedgerId = &ledgerId
+					}
+					expenses, err := seed.Populate(ctx, db, generate)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("seeded %d expenses\n", len(expenses))
+					return nil
+				}
+				in, err := open(file)
+				if err != nil {
+					return err
+				}
+				defer in.Close()
+				n, err := admin.Seed(ctx, db, in)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("seeded %d expenses\n", n)
+				return nil
+			},
+		},
+		"export": {
+			define: fileFlag("file to write every expense to, one JSON object per line; - for stdout"),
+			run: func(ctx context.Context, db *sql.DB) error {
+				out := io.WriteCloser(os.Stdout)
+				if file != "-" {
+					f, err := os.Create(file)
+					if err != nil {
+						return err
+					}
+					out = f
+				}
+				n, err := admin.Export(ctx, db, out)
+				if err != nil {
+					out.Close()
+					return err
+				}
+				if err := out.Close(); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "exported %d expenses to %s\n", n, file)
+				return nil
+			},
+		},
+		"reindex": {
+			define: func(fs *flag.FlagSet) {
+				fs.BoolVar(&concurrently, "concurrently", false, "rebuild without blocking writes, more slowly")
+			},
+			run: func(ctx context.Context, db *sql.DB) error {
+				tables, err := admin.Reindex(ctx, db, concurrently)
+				for _, table := range tables {
+					fmt.Println("reindexed", table)
+				}
+				return err
+			},
+		},
+		"vacuum-deleted": {
+			define: func(fs *flag.FlagSet) {
+				fs.DurationVar(&retention, "retention", 30*24*time.Hour, "how long finished webhook deliveries, dispatched events and idle rate limit buckets are kept")
+			},
+			run: func(ctx context.Context, db *sql.DB) error {
+				purged, err := admin.VacuumDeleted(ctx, db, retention)
+				out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+				fmt.Fprintln(out, "TABLE\tDELETED")
+				for _, p := range purged {
+					fmt.Fprintf(out, "%s\t%d\n", p.Table, p.Rows)
+				}
+				out.Flush()
+				return err
+			},
+		},
+	}
+}
+
+// adminCommand runs the maintenance task named command against the
+// database of the configuration. Every task but migrate refuses to run on
+// a database that isn't migrated.
+func adminCommand(command string, args []string) {
+	t, ok := tasks()[command]
+	if !ok {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var define []func(*flag.FlagSet)
+	if t.define != nil {
+		define = append(define, t.define)
+	}
+	conf := loadConfig(args, define...)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := func() error {
+		db, err := expense.ConnectDB(conf)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		if command != "migrate" {
+			if err := admin.RequireMigrated(ctx, db); err != nil {
+				return err
+			}
+		}
+		return t.run(ctx, db)
+	}()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", command, err)
+		os.Exit(1)
+	}
+}
+
+func migrate(ctx context.Context, db *sql.DB) error {
+	if err := migration.Up(ctx, db); err != nil {
+		return err
+	}
+	status, err := migration.CurrentStatus(ctx, db)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("database is at version %d\n", status.Current)
+	return nil
+}
+
+// open opens file for reading, stdin for -.
+func open(file string) (io.ReadCloser, error) {
+	if file == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(file)
+}
@@ -1,17 +0,0 @@
-package config
-
-import (
-	"net/http"
-
-	"github.com/labstack/echo/v4"
-)
-
-func HardCodeAuth(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		auth := c.Request().Header.Get(echo.HeaderAuthorization)
-		if auth != "November 10, 2009" {
-			return echo.NewHTTPError(http.StatusUnauthorized, "Unauthorized")
-		}
-		return next(c)
-	}
-}
@@ -1,15 +1,225 @@
 package config
 
-import "os"
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
 
 type Config struct {
-	Port        string
-	DatabaseUrl string
+	Port           string        `yaml:"port"`
+	MetricsPort    string        `yaml:"metrics_port"`
+	MetricsTags    []string      `yaml:"metrics_tags"`
+	DatabaseUrl    string        `yaml:"database_url"`
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+	LogLevel       string        `yaml:"log_level"`
+	LogFormat      string        `yaml:"log_format"`
+	TraceExporter  string        `yaml:"trace_exporter"`
+	ReadyTimeout   time.Duration `yaml:"ready_timeout"`
+	ShutdownDrain  time.Duration `yaml:"shutdown_drain"`
+	QueryTimeout   time.Duration `yaml:"query_timeout"`
+	DB             DBConfig      `yaml:"db"`
+	RateLimit      RateLimit     `yaml:"rate_limit"`
+	TLS            TLSConfig     `yaml:"tls"`
 }
 
-func New() Config {
+// DBConfig tunes the connection pool. ConnectTimeout bounds how long startup
+// keeps retrying a database that isn't accepting connections yet.
+type DBConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	ConnectTimeout  time.Duration `yaml:"connect_timeout"`
+}
+
+// RateLimit sets the token bucket every client gets. Routes, keyed by
+// "METHOD /path" as registered with echo, get a bucket of their own with a
+// different limit; every other route shares Default. PerIP limits every
+// address before authentication, so requests with invalid credentials are
+// limited too. It counts the address of the connection, which behind a
+// proxy is the proxy's. Store is memory, or postgres to share buckets
+// between replicas.
+type RateLimit struct {
+	Store   string           `yaml:"store"`
+	Default Limit            `yaml:"default"`
+	PerIP   Limit            `yaml:"per_ip"`
+	Routes  map[string]Limit `yaml:"routes"`
+}
+
+// Limit allows Requests per Per on average and bursts of up to Burst
+// requests. Zero Requests disables the limit.
+type Limit struct {
+	Requests int           `yaml:"requests"`
+	Per      time.Duration `yaml:"per"`
+	Burst    int           `yaml:"burst"`
+}
+
+// TLSConfig serves the API over HTTPS when CertFile and KeyFile are set. The
+// files are reloaded every ReloadInterval when they change, so certificates
+// can be rotated without a restart. ClientAuth is none, optional or require;
+// client certificates are verified against ClientCAFile, and those whose
+// subject, e.g. "CN=reporting,O=Acme", is in ClientIdentities authenticate
+// with the listed scopes. RedirectPort, when set, serves plain HTTP that
+// redirects to HTTPS.
+type TLSConfig struct {
+	CertFile         string              `yaml:"cert_file"`
+	KeyFile          string              `yaml:"key_file"`
+	ClientCAFile     string              `yaml:"client_ca_file"`
+	ClientAuth       string              `yaml:"client_auth"`
+	ClientIdentities map[string][]string `yaml:"client_identities"`
+	RedirectPort     string              `yaml:"redirect_port"`
+	ReloadInterval   time.Duration       `yaml:"reload_interval"`
+}
+
+// Enabled reports whether the API is served over HTTPS.
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// Default returns the configuration used for anything the file, environment
+// and flags leave unset.
+func Default() Config {
 	return Config{
-		Port:        os.Getenv("PORT"),
-		DatabaseUrl: os.Getenv("DATABASE_URL"),
+		Port:           ":2565",
+		MetricsPort:    ":2112",
+		IdempotencyTTL: 24 * time.Hour,
+		LogLevel:       "info",
+		LogFormat:      "json",
+		TraceExporter:  "none",
+		ReadyTimeout:   2 * time.Second,
+		ShutdownDrain:  5 * time.Second,
+		QueryTimeout:   5 * time.Second,
+		DB: DBConfig{
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+			ConnectTimeout:  30 * time.Second,
+		},
+		RateLimit: RateLimit{
+			Store:   "memory",
+			Default: Limit{Requests: 600, Per: time.Minute, Burst: 60},
+			PerIP:   Limit{Requests: 1200, Per: time.Minute, Burst: 120},
+			Routes: map[string]Limit{
+				"POST /expenses": {Requests: 60, Per: time.Minute, Burst: 10},
+			},
+		},
+		TLS: TLSConfig{
+			ClientAuth:     "none",
+			ReloadInterval: 10 * time.Second,
+		},
+	}
+}
+
+// Validate reports every invalid setting at once, so a misconfigured
+// deployment can be fixed in one go.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(validAddr(c.Port), "port: must be [host]:port, got %q", c.Port)
+	check(validAddr(c.MetricsPort), "metrics_port: must be [host]:port, got %q", c.MetricsPort)
+	check(c.Port != c.MetricsPort, "metrics_port: must differ from port %q", c.Port)
+	check(c.DatabaseUrl != "", "database_url: is required")
+	check(c.IdempotencyTTL > 0, "idempotency_ttl: must be positive, got %s", c.IdempotencyTTL)
+	check(oneOf(c.LogLevel, "debug", "info", "warn", "error"), "log_level: must be debug, info, warn or error, got %q", c.LogLevel)
+	check(oneOf(c.LogFormat, "json", "text"), "log_format: must be json or text, got %q", c.LogFormat)
+	check(oneOf(c.TraceExporter, "none", "otlp", "stdout"), "trace_exporter: must be none, otlp or stdout, got %q", c.TraceExporter)
+	check(c.ReadyTimeout > 0, "ready_timeout: must be positive, got %s", c.ReadyTimeout)
+	check(c.ShutdownDrain >= 0, "shutdown_drain: must not be negative, got %s", c.ShutdownDrain)
+	check(c.QueryTimeout >= 0, "query_timeout: must not be negative, got %s", c.QueryTimeout)
+	check(c.DB.MaxOpenConns >= 0, "db.max_open_conns: must not be negative, got %d", c.DB.MaxOpenConns)
+	check(c.DB.MaxIdleConns >= 0, "db.max_idle_conns: must not be negative, got %d", c.DB.MaxIdleConns)
+	check(c.DB.MaxOpenConns == 0 || c.DB.MaxIdleConns <= c.DB.MaxOpenConns,
+		"db.max_idle_conns: must not exceed db.max_open_conns %d, got %d", c.DB.MaxOpenConns, c.DB.MaxIdleConns)
+	check(c.DB.ConnMaxLifetime >= 0, "db.conn_max_lifetime: must not be negative, got %s", c.DB.ConnMaxLifetime)
+	check(c.DB.ConnMaxIdleTime >= 0, "db.conn_max_idle_time: must not be negative, got %s", c.DB.ConnMaxIdleTime)
+	check(c.DB.ConnectTimeout > 0, "db.connect_timeout: must be positive, got %s", c.DB.ConnectTimeout)
+	check(oneOf(c.RateLimit.Store, "memory", "postgres"), "rate_limit.store: must be memory or postgres, got %q", c.RateLimit.Store)
+	errs = append(errs, c.RateLimit.Default.validate("rate_limit.default"))
+	errs = append(errs, c.RateLimit.PerIP.validate("rate_limit.per_ip"))
+	for route, limit := range c.RateLimit.Routes {
+		method, path, ok := strings.Cut(route, " ")
+		check(ok && method != "" && strings.HasPrefix(path, "/"), "rate_limit.routes: keys must be \"METHOD /path\", got %q", route)
+		errs = append(errs, limit.validate(fmt.Sprintf("rate_limit.routes[%s]", route)))
+	}
+	errs = append(errs, c.TLS.validate(c.Port, c.MetricsPort))
+	return errors.Join(errs...)
+}
+
+func (t TLSConfig) validate(port string, metricsPort string) error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(!t.Enabled() || t.CertFile != "", "tls.cert_file: is required with tls.key_file")
+	check(!t.Enabled() || t.KeyFile != "", "tls.key_file: is required with tls.cert_file")
+	check(oneOf(t.ClientAuth, "none", "optional", "require"), "tls.client_auth: must be none, optional or require, got %q", t.ClientAuth)
+	if !strings.EqualFold(t.ClientAuth, "none") {
+		check(t.Enabled(), "tls.client_auth: needs tls.cert_file and tls.key_file")
+		check(t.ClientCAFile != "", "tls.client_ca_file: is required when tls.client_auth is %s", t.ClientAuth)
+	}
+	for subject, scopes := range t.ClientIdentities {
+		check(len(scopes) > 0, "tls.client_identities[%s]: must grant at least one scope", subject)
+	}
+	if t.RedirectPort != "" {
+		check(t.Enabled(), "tls.redirect_port: needs tls.cert_file and tls.key_file")
+		check(validAddr(t.RedirectPort), "tls.redirect_port: must be [host]:port, got %q", t.RedirectPort)
+		check(t.RedirectPort != port && t.RedirectPort != metricsPort, "tls.redirect_port: must differ from port and metrics_port")
+	}
+	check(t.ReloadInterval > 0, "tls.reload_interval: must be positive, got %s", t.ReloadInterval)
+	return errors.Join(errs...)
+}
+
+func (l Limit) validate(name string) error {
+	switch {
+	case l.Requests < 0:
+		return fmt.Errorf("%s.requests: must not be negative, got %d", name, l.Requests)
+	case l.Requests == 0:
+		return nil
+	case l.Per <= 0:
+		return fmt.Errorf("%s.per: must be positive, got %s", name, l.Per)
+	case l.Burst < 1:
+		return fmt.Errorf("%s.burst: must be at least 1, got %d", name, l.Burst)
+	}
+	return nil
+}
+
+var dsnPassword = regexp.MustCompile(`(password=)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// Redacted returns a copy of c that is safe to print: passwords in the
+// database url are masked.
+func (c Config) Redacted() Config {
+	if u, err := url.Parse(c.DatabaseUrl); err == nil && u.User != nil {
+		c.DatabaseUrl = u.Redacted()
+	} else {
+		c.DatabaseUrl = dsnPassword.ReplaceAllString(c.DatabaseUrl, "${1}xxxxx")
+	}
+	return c
+}
+
+func validAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	return err == nil && port != ""
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if strings.EqualFold(value, a) {
+			return true
+		}
 	}
+	return false
 }
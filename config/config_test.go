@@ -0,0 +1,204 @@
+//go:build unit
+
+package config
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, content string) string {
+	name := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestLoad_ShouldUseDefaults(t *testing.T) {
+	t.Setenv("DATABASE_URL", "postgres://db/expenses")
+
+	// Act
+	conf, err := Load(nil)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ":2565", conf.Port)
+	assert.Equal(t, 5*time.Second, conf.QueryTimeout)
+	assert.Equal(t, 25, conf.DB.MaxOpenConns)
+}
+
+func TestLoad_FlagsOverrideEnvOverrideFile(t *testing.T) {
+	// Arrange
+	file := writeFile(t, `
+port: ":3000"
+database_url: postgres://file/expenses
+query_timeout: 3s
+db:
+  max_open_conns: 10
+  max_idle_conns: 5
+`)
+	t.Setenv("CONFIG_FILE", file)
+	t.Setenv("PORT", ":4000")
+	t.Setenv("DB_MAX_OPEN_CONNS", "20")
+
+	// Act
+	conf, err := Load([]string{"--port", ":5000"})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ":5000", conf.Port)
+	assert.Equal(t, 20, conf.DB.MaxOpenConns)
+	assert.Equal(t, 5, conf.DB.MaxIdleConns)
+	assert.Equal(t, 3*time.Second, conf.QueryTimeout)
+	assert.Equal(t, "postgres://file/expenses", conf.DatabaseUrl)
+	assert.Equal(t, ":2112", conf.MetricsPort)
+}
+
+func TestLoad_ConfigFlagOverridesConfigFileEnv(t *testing.T) {
+	// Arrange
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	file := writeFile(t, "database_url: postgres://file/expenses\n")
+
+	// Act
+	conf, err := Load([]string{"--config", file})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres://file/expenses", conf.DatabaseUrl)
+}
+
+func TestLoad_UnknownFileKey_ShouldFail(t *testing.T) {
+	// Arrange
+	file := writeFile(t, "database_url: postgres://db/expenses\nprot: \":2565\"\n")
+
+	// Act
+	_, err := Load([]string{"--config", file})
+
+	// Assert
+	assert.ErrorContains(t, err, "field prot not found")
+}
+
+func TestLoad_CommandFlags_ShouldBeParsedButNotLayered(t *testing.T) {
+	// Arrange
+	t.Setenv("DATABASE_URL", "postgres://db/expenses")
+	t.Setenv("FORMAT", "csv")
+	var format string
+	define := func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", "json", "output format")
+	}
+
+	// Act
+	conf, err := Load([]string{"--port", ":5000"}, define)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, ":5000", conf.Port)
+	assert.Equal(t, "json", format)
+
+	// Act
+	_, err = Load([]string{"--format", "csv"}, define)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", format)
+}
+
+func TestLoad_InvalidEnvDuration_ShouldNameVariable(t *testing.T) {
+	// Arrange
+	t.Setenv("DATABASE_URL", "postgres://db/expenses")
+	t.Setenv("QUERY_TIMEOUT", "soon")
+
+	// Act
+	_, err := Load(nil)
+
+	// Assert
+	assert.ErrorContains(t, err, "QUERY_TIMEOUT")
+}
+
+func TestValidate_ShouldReportEveryProblem(t *testing.T) {
+	// Arrange
+	conf := Default()
+	conf.Port = "2565"
+	conf.LogLevel = "loud"
+	conf.DB.MaxIdleConns = 50
+	conf.RateLimit.Routes["expenses"] = Limit{Requests: 10, Per: time.Minute}
+
+	// Act
+	err := conf.Validate()
+
+	// Assert
+	assert.ErrorContains(t, err, `port: must be [host]:port, got "2565"`)
+	assert.ErrorContains(t, err, "database_url: is required")
+	assert.ErrorContains(t, err, `log_level: must be debug, info, warn or error, got "loud"`)
+	assert.ErrorContains(t, err, "db.max_idle_conns: must not exceed db.max_open_conns 25, got 50")
+	assert.ErrorContains(t, err, `rate_limit.routes: keys must be "METHOD /path", got "expenses"`)
+	assert.ErrorContains(t, err, "rate_limit.routes[expenses].burst: must be at least 1, got 0")
+}
+
+func TestValidate_TLS(t *testing.T) {
+	tests := []struct {
+		name string
+		tls  TLSConfig
+		want string
+	}{
+		{"cert without key", TLSConfig{CertFile: "tls.crt", ClientAuth: "none", ReloadInterval: time.Second}, "tls.key_file: is required with tls.cert_file"},
+		{"mtls without ca", TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: "require", ReloadInterval: time.Second}, "tls.client_ca_file: is required when tls.client_auth is require"},
+		{"mtls without tls", TLSConfig{ClientCAFile: "ca.crt", ClientAuth: "optional", ReloadInterval: time.Second}, "tls.client_auth: needs tls.cert_file and tls.key_file"},
+		{"redirect without tls", TLSConfig{ClientAuth: "none", RedirectPort: ":8080", ReloadInterval: time.Second}, "tls.redirect_port: needs tls.cert_file and tls.key_file"},
+		{"redirect to itself", TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: "none", RedirectPort: ":2565", ReloadInterval: time.Second}, "tls.redirect_port: must differ from port and metrics_port"},
+		{"identity without scopes", TLSConfig{ClientAuth: "none", ClientIdentities: map[string][]string{"CN=reporting": nil}, ReloadInterval: time.Second}, "tls.client_identities[CN=reporting]: must grant at least one scope"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			conf := Default()
+			conf.DatabaseUrl = "postgres://db/expenses"
+			conf.TLS = tt.tls
+
+			// Act
+			err := conf.Validate()
+
+			// Assert
+			assert.ErrorContains(t, err, tt.want)
+		})
+	}
+}
+
+func TestRedacted_ShouldMaskDatabasePassword(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"postgres://root:root@db/expenses?sslmode=disable", "postgres://root:xxxxx@db/expenses?sslmode=disable"},
+		{"host=db user=root password=root dbname=expenses", "host=db user=root password=xxxxx dbname=expenses"},
+		{"postgres://db/expenses", "postgres://db/expenses"},
+	}
+	for _, tt := range tests {
+		conf := Config{DatabaseUrl: tt.url}
+
+		assert.Equal(t, tt.want, conf.Redacted().DatabaseUrl)
+	}
+}
+
+func TestPrint_ShouldWriteRedactedYaml(t *testing.T) {
+	// Arrange
+	conf := Default()
+	conf.DatabaseUrl = "postgres://root:root@db/expenses"
+	var out bytes.Buffer
+
+	// Act
+	err := Print(&out, conf)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), "database_url: postgres://root:xxxxx@db/expenses\n")
+	assert.Contains(t, out.String(), "query_timeout: 5s\n")
+	assert.NotContains(t, out.String(), "root:root")
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration in layers, each overriding the one before:
+// defaults, the YAML file named by --config or CONFIG_FILE, environment
+// variables, then command-line flags. Every flag has an environment variable
+// of the same name in upper snake case, e.g. --db-max-open-conns and
+// DB_MAX_OPEN_CONNS. Metric tags, per-route rate limits and TLS client
+// identities can only be set in the file. The result is validated.
+//
+// Commands add flags of their own with define; those are parsed from args
+// too but take no part in the layering.
+func Load(args []string, define ...func(*flag.FlagSet)) (Config, error) {
+	conf := Default()
+	var file string
+	fs := flagSet(&conf, &file)
+	own := map[string]bool{}
+	fs.VisitAll(func(f *flag.Flag) {
+		own[f.Name] = true
+	})
+	for _, d := range define {
+		d(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return Config{}, err
+	}
+	flags := map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	// The flags were parsed into conf only to find them; start over so the
+	// file and environment sit underneath them.
+	conf = Default()
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		if err := readFile(file, &conf); err != nil {
+			return Config{}, err
+		}
+	}
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || !own[f.Name] {
+			return
+		}
+		if value, ok := flags[f.Name]; ok {
+			fs.Set(f.Name, value)
+			return
+		}
+		env := envName(f.Name)
+		if value := os.Getenv(env); value != "" {
+			if err := fs.Set(f.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", env, err))
+			}
+		}
+	})
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	if err := conf.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return conf, nil
+}
+
+func flagSet(conf *Config, file *string) *flag.FlagSet {
+	fs := flag.NewFlagSet("expenses", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(file, "config", "", "YAML configuration file")
+	fs.StringVar(&conf.Port, "port", conf.Port, "address the API listens on")
+	fs.StringVar(&conf.MetricsPort, "metrics-port", conf.MetricsPort, "address the metrics server listens on")
+	fs.StringVar(&conf.DatabaseUrl, "database-url", conf.DatabaseUrl, "Postgres connection url")
+	fs.DurationVar(&conf.IdempotencyTTL, "idempotency-ttl", conf.IdempotencyTTL, "how long Idempotency-Key responses are kept")
+	fs.StringVar(&conf.LogLevel, "log-level", conf.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&conf.LogFormat, "log-format", conf.LogFormat, "json or text")
+	fs.StringVar(&conf.TraceExporter, "trace-exporter", conf.TraceExporter, "none, otlp or stdout")
+	fs.DurationVar(&conf.ReadyTimeout, "ready-timeout", conf.ReadyTimeout, "deadline for readiness checks")
+	fs.DurationVar(&conf.ShutdownDrain, "shutdown-drain", conf.ShutdownDrain, "how long readiness fails before the servers stop on shutdown")
+	fs.DurationVar(&conf.QueryTimeout, "query-timeout", conf.QueryTimeout, "deadline for each data layer call, 0 disables it")
+	fs.IntVar(&conf.DB.MaxOpenConns, "db-max-open-conns", conf.DB.MaxOpenConns, "maximum open connections, 0 is unlimited")
+	fs.IntVar(&conf.DB.MaxIdleConns, "db-max-idle-conns", conf.DB.MaxIdleConns, "maximum idle connections")
+	fs.DurationVar(&conf.DB.ConnMaxLifetime, "db-conn-max-lifetime", conf.DB.ConnMaxLifetime, "maximum connection age, 0 is unlimited")
+	fs.DurationVar(&conf.DB.ConnMaxIdleTime, "db-conn-max-idle-time", conf.DB.ConnMaxIdleTime, "maximum connection idle time, 0 is unlimited")
+	fs.DurationVar(&conf.DB.ConnectTimeout, "db-connect-timeout", conf.DB.ConnectTimeout, "how long startup retries the database")
+	fs.StringVar(&conf.RateLimit.Store, "rate-limit-store", conf.RateLimit.Store, "memory or postgres")
+	fs.IntVar(&conf.RateLimit.Default.Requests, "rate-limit-requests", conf.RateLimit.Default.Requests, "requests each client may make per rate-limit-per, 0 disables it")
+	fs.DurationVar(&conf.RateLimit.Default.Per, "rate-limit-per", conf.RateLimit.Default.Per, "window of rate-limit-requests")
+	fs.IntVar(&conf.RateLimit.Default.Burst, "rate-limit-burst", conf.RateLimit.Default.Burst, "requests a client may make at once")
+	fs.IntVar(&conf.RateLimit.PerIP.Requests, "rate-limit-per-ip-requests", conf.RateLimit.PerIP.Requests, "requests each address may make per rate-limit-per-ip-per before authentication, 0 disables it")
+	fs.DurationVar(&conf.RateLimit.PerIP.Per, "rate-limit-per-ip-per", conf.RateLimit.PerIP.Per, "window of rate-limit-per-ip-requests")
+	fs.IntVar(&conf.RateLimit.PerIP.Burst, "rate-limit-per-ip-burst", conf.RateLimit.PerIP.Burst, "requests an address may make at once")
+	fs.StringVar(&conf.TLS.CertFile, "tls-cert-file", conf.TLS.CertFile, "PEM certificate to serve HTTPS with")
+	fs.StringVar(&conf.TLS.KeyFile, "tls-key-file", conf.TLS.KeyFile, "PEM private key of tls-cert-file")
+	fs.StringVar(&conf.TLS.ClientCAFile, "tls-client-ca-file", conf.TLS.ClientCAFile, "PEM CA bundle client certificates are verified against")
+	fs.StringVar(&conf.TLS.ClientAuth, "tls-client-auth", conf.TLS.ClientAuth, "none, optional or require")
+	fs.StringVar(&conf.TLS.RedirectPort, "tls-redirect-port", conf.TLS.RedirectPort, "address serving redirects from HTTP to HTTPS")
+	fs.DurationVar(&conf.TLS.ReloadInterval, "tls-reload-interval", conf.TLS.ReloadInterval, "how often certificate files are checked for changes")
+	return fs
+}
+
+func readFile(name string, conf *Config) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+	defer f.Close()
+
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(conf); err != nil && err != io.EOF {
+		return fmt.Errorf("config file %s: %w", name, err)
+	}
+	return nil
+}
+
+func envName(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func Print(w io.Writer, conf Config) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(conf.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+)
+
+var (
+	initialBackoff = 250 * time.Millisecond
+	maxBackoff     = 5 * time.Second
+)
+
+// WaitForConnection pings db until it answers, doubling the delay between
+// attempts, so the service can start before the database is accepting
+// connections. It gives up with the last ping error once ctx is done.
+func WaitForConnection(ctx context.Context, db *sql.DB) error {
+	delay := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("database not ready", "attempt", attempt, "retry_in", delay.String(), "error", err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
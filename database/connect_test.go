@@ -0,0 +1,50 @@
+//go:build unit
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForConnection_ShouldRetryUntilDatabaseAnswers(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+	initialBackoff, maxBackoff = time.Millisecond, time.Millisecond
+
+	// Arrange
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	mock.ExpectPing()
+
+	// Act
+	err = WaitForConnection(context.Background(), db)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestWaitForConnection_ShouldGiveUpWhenContextIsDone(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+	initialBackoff, maxBackoff = time.Hour, time.Hour
+
+	// Arrange
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// Act
+	err = WaitForConnection(ctx, db)
+
+	// Assert
+	assert.EqualError(t, err, "connection refused")
+}
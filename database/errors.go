@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+// queryCanceled is the Postgres error code for a statement cancelled because
+// of statement_timeout or a cancel request sent when a context expired.
+const queryCanceled = "57014"
+
+// HTTPError maps an error from a query run with ctx to an HTTP error. Queries
+// that ran out of time become 504 and queries that couldn't reach the
+// database, or whose request went away, become 503. Other errors become a 500
+// with message, or are returned unchanged when message is empty.
+func HTTPError(ctx context.Context, err error, message string) error {
+	var pqErr *pq.Error
+	var netErr *net.OpError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded),
+		errors.Is(err, context.DeadlineExceeded),
+		errors.As(err, &pqErr) && pqErr.Code == queryCanceled:
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "Database query timed out").SetInternal(err)
+	case errors.Is(ctx.Err(), context.Canceled),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, driver.ErrBadConn),
+		errors.As(err, &netErr):
+		return echo.NewHTTPError(http.StatusServiceUnavailable, "Database unavailable").SetInternal(err)
+	case message == "":
+		return err
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, message).SetInternal(err)
+	}
+}
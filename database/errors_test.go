@@ -0,0 +1,64 @@
+//go:build unit
+
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPError(t *testing.T) {
+	expired, cancelExpired := context.WithTimeout(context.Background(), 0)
+	defer cancelExpired()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	other := errors.New("boom")
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		err  error
+		code int
+	}{
+		{"deadline exceeded", expired, other, http.StatusGatewayTimeout},
+		{"statement cancelled", context.Background(), &pq.Error{Code: "57014"}, http.StatusGatewayTimeout},
+		{"request canceled", canceled, other, http.StatusServiceUnavailable},
+		{"bad connection", context.Background(), driver.ErrBadConn, http.StatusServiceUnavailable},
+		{"connection refused", context.Background(), &net.OpError{Op: "dial", Err: errors.New("connection refused")}, http.StatusServiceUnavailable},
+		{"other", context.Background(), other, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := HTTPError(tt.ctx, tt.err, "Cannot query")
+
+			// Assert
+			var httpErr *echo.HTTPError
+			assert.True(t, errors.As(err, &httpErr))
+			assert.Equal(t, tt.code, httpErr.Code)
+			assert.Equal(t, tt.err, httpErr.Internal)
+		})
+	}
+}
+
+func TestHTTPError_WithoutMessage_ShouldReturnErrorUnchanged(t *testing.T) {
+	err := errors.New("boom")
+
+	assert.Equal(t, err, HTTPError(context.Background(), err, ""))
+}
+
+func TestWithTimeout_Zero_ShouldNotSetDeadline(t *testing.T) {
+	ctx, cancel := WithTimeout(context.Background(), 0)
+	defer cancel()
+
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+}
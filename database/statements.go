@@ -0,0 +1,50 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+)
+
+// Statements prepares each query once and reuses the statement for the life
+// of the process. database/sql re-prepares a statement on every connection
+// it runs on, so a cached statement stays valid as the pool churns.
+type Statements struct {
+	db    *sql.DB
+	mu    sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func NewStatements(db *sql.DB) *Statements {
+	return &Statements{
+		db:    db,
+		stmts: map[string]*sql.Stmt{},
+	}
+}
+
+// Prepare returns the statement for query, preparing it on first use. A
+// failed prepare isn't cached, so the next call tries again.
+func (s *Statements) Prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stmt, ok := s.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	s.stmts[query] = stmt
+	return stmt, nil
+}
+
+// PrepareAll prepares every query up front, so a query the schema can't
+// satisfy fails at startup rather than on the first request.
+func (s *Statements) PrepareAll(ctx context.Context, queries ...string) error {
+	for _, query := range queries {
+		if _, err := s.Prepare(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
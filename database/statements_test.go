@@ -0,0 +1,56 @@
+//go:build unit
+
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatements_ShouldPrepareEachQueryOnce(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	stmts := NewStatements(db)
+
+	// Arrange
+	mock.ExpectPrepare("SELECT 1")
+	mock.ExpectPrepare("SELECT 2")
+
+	// Act
+	err = stmts.PrepareAll(context.Background(), "SELECT 1", "SELECT 2")
+	assert.NoError(t, err)
+	first, err := stmts.Prepare(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	second, err := stmts.Prepare(context.Background(), "SELECT 1")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStatements_FailedPrepare_ShouldBeRetried(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+	stmts := NewStatements(db)
+
+	// Arrange
+	mock.ExpectPrepare("SELECT 1").WillReturnError(errors.New("connection refused"))
+	mock.ExpectPrepare("SELECT 1")
+
+	// Act
+	_, err = stmts.Prepare(context.Background(), "SELECT 1")
+	assert.Error(t, err)
+	stmt, err := stmts.Prepare(context.Background(), "SELECT 1")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NotNil(t, stmt)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,15 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// WithTimeout bounds a query by timeout. A timeout of zero or less leaves the
+// query bound only by ctx.
+func WithTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -1,35 +1,48 @@
 package expense
 
 import (
+	"context"
 	"database/sql"
-	"log"
+	"fmt"
 
+	"github.com/XSAM/otelsql"
 	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/migration"
 	_ "github.com/lib/pq"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
-func InitDB(conf config.Config) (*sql.DB, func()) {
-	db, err := sql.Open("postgres", conf.DatabaseUrl)
+// ConnectDB connects to the database of conf, waiting up to
+// conf.DB.ConnectTimeout for it.
+func ConnectDB(conf config.Config) (*sql.DB, error) {
+	db, err := otelsql.Open("postgres", conf.DatabaseUrl, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
-		log.Fatal("connect to database error", err)
+		return nil, fmt.Errorf("connect to database: %w", err)
 	}
+	db.SetMaxOpenConns(conf.DB.MaxOpenConns)
+	db.SetMaxIdleConns(conf.DB.MaxIdleConns)
+	db.SetConnMaxLifetime(conf.DB.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(conf.DB.ConnMaxIdleTime)
 
-	initTable(db)
-
-	return db, func() { db.Close() }
+	ctx, cancel := context.WithTimeout(context.Background(), conf.DB.ConnectTimeout)
+	defer cancel()
+	if err := database.WaitForConnection(ctx, db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't connect to database within %s: %w", conf.DB.ConnectTimeout, err)
+	}
+	return db, nil
 }
 
-func initTable(db *sql.DB) {
-	createTable := `
-	CREATE TABLE IF NOT EXISTS expenses (
-		id SERIAL PRIMARY KEY,
-		title TEXT,
-		amount FLOAT,
-		note TEXT,
-		tags TEXT[]
-	);`
-
-	if _, err := db.Exec(createTable); err != nil {
-		log.Fatal("can't create table", err)
+// OpenDB connects to the database of conf like ConnectDB and migrates it.
+func OpenDB(conf config.Config) (*sql.DB, error) {
+	db, err := ConnectDB(conf)
+	if err != nil {
+		return nil, err
+	}
+	if err := migration.Up(context.Background(), db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("can't migrate database: %w", err)
 	}
+	return db, nil
 }
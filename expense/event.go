@@ -0,0 +1,41 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+const (
+	EventExpenseCreated = "expense.created"
+	EventExpenseUpdated = "expense.updated"
+)
+
+// Event is a change to an expense, as stored in the outbox table and as
+// delivered to webhook subscribers.
+type Event struct {
+	Id        int64           `json:"id"`
+	Type      string          `json:"type"`
+	ExpenseId int             `json:"expense_id"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// recordEvent writes an event to the outbox. It must run in the same
+// transaction as the write it describes so an event exists if and only if the
+// write was committed.
+func recordEvent(ctx context.Context, tx *sql.Tx, eventType string, expense *Expense) error {
+	data, err := json.Marshal(expense)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO
+		outbox (event_type, expense_id, payload)
+	VALUES
+		($1, $2, $3)
+	`, eventType, expense.Id, data)
+	return err
+}
@@ -1,28 +1,71 @@
 package expense
 
 import (
+	"context"
 	"database/sql"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/brown-kaew/assessment/metrics"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/brown-kaew/assessment/expense")
+
 type Handler interface {
-	CreateNewExpense(expense *Expense) error
-	GetExpenseById(id int) (*Expense, error)
-	UpdateExpenseById(expense *Expense) error
-	GetAllExpenses() ([]Expense, error)
+	CreateNewExpense(ctx context.Context, expense *Expense) error
+	GetExpenseById(ctx context.Context, id int) (*Expense, error)
+	UpdateExpenseById(ctx context.Context, expense *Expense) error
+	GetAllExpenses(ctx context.Context, page Page) ([]Expense, error)
+	GetExpenseByIdAsOf(ctx context.Context, id int, asOf time.Time) (*Expense, error)
+	GetAllExpensesAsOf(ctx context.Context, asOf time.Time, page Page) ([]Expense, error)
+	Prepare(ctx context.Context) error
 }
 
+const (
+	getExpenseByIdSQL = `
+	SELECT id, title, amount, note, tags
+	FROM expenses
+	WHERE id=$1 AND ledger_id IS NOT DISTINCT FROM $2
+	`
+	getAllExpensesSQL = `
+	SELECT id, title, amount, note, tags
+	FROM expenses
+	WHERE ledger_id IS NOT DISTINCT FROM $1 AND id > $2
+	ORDER BY id
+	LIMIT $3
+	`
+	updateExpenseSQL = `
+	UPDATE expenses
+	SET
+		title=$2,
+		amount=$3,
+		note=$4,
+		tags=$5
+	WHERE id=$1 AND ledger_id IS NOT DISTINCT FROM $6
+	`
+)
+
 type handler struct {
-	db *sql.DB
+	db             *sql.DB
+	stmts          *database.Statements
+	idempotencyTTL time.Duration
+	queryTimeout   time.Duration
 }
 
-func NewHandler(db *sql.DB, g *echo.Group) Handler {
+func NewHandler(db *sql.DB, g *echo.Group, conf config.Config) Handler {
 	handler := &handler{
-		db: db,
+		db:             db,
+		stmts:          database.NewStatements(db),
+		idempotencyTTL: conf.IdempotencyTTL,
+		queryTimeout:   conf.QueryTimeout,
 	}
 	handler.initRoutes(g)
 	return handler
@@ -37,12 +80,16 @@ func (h *handler) initRoutes(g *echo.Group) {
 
 func (h *handler) createNewExpenseHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
+		if key := c.Request().Header.Get(HeaderIdempotencyKey); key != "" {
+			return h.createNewExpenseIdempotent(c, key)
+		}
+
 		var expense Expense
 		err := c.Bind(&expense)
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, err)
 		}
-		err = h.CreateNewExpense(&expense)
+		err = h.CreateNewExpense(c.Request().Context(), &expense)
 		if err != nil {
 			return err
 		}
@@ -56,7 +103,17 @@ func (h *handler) getExpenseHandler() echo.HandlerFunc {
 		if err != nil {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid Id")
 		}
-		expense, err := h.GetExpenseById(id)
+		asOf, ok, err := parseAsOf(c.QueryParam("as_of"))
+		if err != nil {
+			return err
+		}
+
+		var expense *Expense
+		if ok {
+			expense, err = h.GetExpenseByIdAsOf(c.Request().Context(), id, asOf)
+		} else {
+			expense, err = h.GetExpenseById(c.Request().Context(), id)
+		}
 		if err != nil {
 			return err
 		}
@@ -76,7 +133,7 @@ func (h *handler) updateExpenseHandler() echo.HandlerFunc {
 			return echo.NewHTTPError(http.StatusBadRequest, "invalid Id")
 		}
 
-		err = h.UpdateExpenseById(&expense)
+		err = h.UpdateExpenseById(c.Request().Context(), &expense)
 		if err != nil {
 			return err
 		}
@@ -86,37 +143,83 @@ func (h *handler) updateExpenseHandler() echo.HandlerFunc {
 
 func (h *handler) getAllExpenseHandler() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		expense, err := h.GetAllExpenses()
+		asOf, ok, err := parseAsOf(c.QueryParam("as_of"))
+		if err != nil {
+			return err
+		}
+		page, err := parsePage(c)
 		if err != nil {
 			return err
 		}
+
+		var expense []Expense
+		if ok {
+			expense, err = h.GetAllExpensesAsOf(c.Request().Context(), asOf, page)
+		} else {
+			expense, err = h.GetAllExpenses(c.Request().Context(), page)
+		}
+		if err != nil {
+			return err
+		}
+		setNextLink(c, page, expense)
 		return c.JSON(http.StatusOK, expense)
 	}
 }
 
-func (h *handler) CreateNewExpense(expense *Expense) error {
+func (h *handler) CreateNewExpense(ctx context.Context, expense *Expense) error {
+	return h.createNewExpense(ctx, expense, nil)
+}
+
+// createNewExpense inserts the expense, and runs beforeCommit, when given, in
+// the same transaction.
+func (h *handler) createNewExpense(ctx context.Context, expense *Expense, beforeCommit func(tx *sql.Tx) error) error {
+	ctx, end := h.startQuery(ctx, "CreateNewExpense")
+	defer end()
 	sql := `
 	INSERT INTO
-		expenses (title, amount, note, tags)
+		expenses (title, amount, note, tags, ledger_id)
 	VALUES
-		($1, $2, $3, $4) 
+		($1, $2, $3, $4, $5) 
 	RETURNING id;
 	`
-	row := h.db.QueryRow(sql, expense.Title, expense.Amount, expense.Note, pq.Array(&expense.Tags))
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.HTTPError(ctx, err, "")
+	}
+	defer tx.Rollback()
 
+	row := tx.QueryRowContext(ctx, sql, expense.Title, expense.Amount, expense.Note, pq.Array(&expense.Tags), ledger.IdArg(ctx))
 	if err := row.Scan(&expense.Id); err != nil {
-		return err
+		return database.HTTPError(ctx, err, "")
+	}
+	if err := recordVersion(ctx, tx, expense); err != nil {
+		return database.HTTPError(ctx, err, "")
+	}
+	if err := recordEvent(ctx, tx, EventExpenseCreated, expense); err != nil {
+		return database.HTTPError(ctx, err, "")
+	}
+	if beforeCommit != nil {
+		if err := beforeCommit(tx); err != nil {
+			return database.HTTPError(ctx, err, "")
+		}
 	}
+	if err := tx.Commit(); err != nil {
+		return database.HTTPError(ctx, err, "")
+	}
+
+	metrics.ExpenseCreated(expense.Amount, expense.Tags)
 	return nil
 }
 
-func (h *handler) GetExpenseById(id int) (*Expense, error) {
-	stmt, err := h.db.Prepare("SELECT * FROM expenses WHERE id=$1")
+func (h *handler) GetExpenseById(ctx context.Context, id int) (*Expense, error) {
+	ctx, end := h.startQuery(ctx, "GetExpenseById")
+	defer end()
+	stmt, err := h.stmts.Prepare(ctx, getExpenseByIdSQL)
 	if err != nil {
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Cannot prepare statment")
+		return nil, database.HTTPError(ctx, err, "Cannot prepare statment")
 	}
 
-	row := stmt.QueryRow(id)
+	row := stmt.QueryRowContext(ctx, id, ledger.IdArg(ctx))
 
 	var expense Expense
 	err = row.Scan(&expense.Id, &expense.Title, &expense.Amount, &expense.Note, pq.Array(&expense.Tags))
@@ -124,60 +227,104 @@ func (h *handler) GetExpenseById(id int) (*Expense, error) {
 		return nil, echo.NewHTTPError(http.StatusNotFound, "Expense not found")
 	}
 	if err != nil {
-		return nil, err
+		return nil, database.HTTPError(ctx, err, "")
 	}
 	return &expense, nil
 }
 
-func (h *handler) UpdateExpenseById(expense *Expense) error {
-	stmt, err := h.db.Prepare(`
-	UPDATE expenses
-	SET
-		title=$2,
-		amount=$3,
-		note=$4,
-		tags=$5
-	WHERE id=$1
-	`)
+func (h *handler) UpdateExpenseById(ctx context.Context, expense *Expense) error {
+	ctx, end := h.startQuery(ctx, "UpdateExpenseById")
+	defer end()
+	stmt, err := h.stmts.Prepare(ctx, updateExpenseSQL)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot prepare statment")
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot prepare statment")
+		return database.HTTPError(ctx, err, "Cannot begin transaction")
 	}
+	defer tx.Rollback()
 
 	var res sql.Result
-	res, err = stmt.Exec(expense.Id, expense.Title, expense.Amount, expense.Note, pq.Array(&expense.Tags))
+	res, err = tx.StmtContext(ctx, stmt).ExecContext(ctx, expense.Id, expense.Title, expense.Amount, expense.Note, pq.Array(&expense.Tags), ledger.IdArg(ctx))
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot update expense: "+err.Error())
+		return database.HTTPError(ctx, err, "Cannot update expense: "+err.Error())
 	}
 
 	row, err := res.RowsAffected()
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot update expense: "+err.Error())
+		return database.HTTPError(ctx, err, "Cannot update expense: "+err.Error())
 	}
 	if row == 0 {
 		return echo.NewHTTPError(http.StatusNotFound, "Expense not found")
 	}
+
+	if err := recordVersion(ctx, tx, expense); err != nil {
+		return database.HTTPError(ctx, err, "Cannot record expense version: "+err.Error())
+	}
+	if err := recordEvent(ctx, tx, EventExpenseUpdated, expense); err != nil {
+		return database.HTTPError(ctx, err, "Cannot record expense event: "+err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return database.HTTPError(ctx, err, "Cannot update expense: "+err.Error())
+	}
 	return nil
 }
 
-func (h *handler) GetAllExpenses() ([]Expense, error) {
-	stmt, err := h.db.Prepare("SELECT * FROM expenses")
+func (h *handler) GetAllExpenses(ctx context.Context, page Page) ([]Expense, error) {
+	ctx, end := h.startQuery(ctx, "GetAllExpenses")
+	defer end()
+	stmt, err := h.stmts.Prepare(ctx, getAllExpensesSQL)
 	if err != nil {
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Cannot prepare statment")
+		return nil, database.HTTPError(ctx, err, "Cannot prepare statment")
 	}
 
-	rows, err := stmt.Query()
+	rows, err := stmt.QueryContext(ctx, ledger.IdArg(ctx), page.After, page.limitArg())
 	if err != nil {
-		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Can't query all expenses: "+err.Error())
+		return nil, database.HTTPError(ctx, err, "Can't query all expenses: "+err.Error())
 	}
+	defer rows.Close()
 
 	var expenses []Expense
 	for rows.Next() {
 		var expense Expense
 		err = rows.Scan(&expense.Id, &expense.Title, &expense.Amount, &expense.Note, pq.Array(&expense.Tags))
 		if err != nil {
-			return nil, echo.NewHTTPError(http.StatusInternalServerError, "Can't scan expense: "+err.Error())
+			return nil, database.HTTPError(ctx, err, "Can't scan expense: "+err.Error())
 		}
 		expenses = append(expenses, expense)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all expenses: "+err.Error())
+	}
 	return expenses, nil
 }
+
+// Prepare prepares every statement the handler reuses, so a schema that
+// doesn't match the queries fails at startup.
+func (h *handler) Prepare(ctx context.Context) error {
+	return h.stmts.PrepareAll(ctx,
+		getExpenseByIdSQL,
+		getAllExpensesSQL,
+		updateExpenseSQL,
+		getExpenseByIdAsOfSQL,
+		getAllExpensesAsOfSQL,
+	)
+}
+
+// startQuery bounds a data layer call by the configured query timeout and
+// starts a span for it; the SQL statements it runs become its children. The
+// returned function ends the span and logs the call with the request scoped
+// logger in ctx, so slow queries can be traced back to the request that
+// issued them.
+func (h *handler) startQuery(ctx context.Context, name string) (context.Context, func()) {
+	start := time.Now()
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	ctx, span := tracer.Start(ctx, "expense."+name)
+	return ctx, func() {
+		span.End()
+		cancel()
+		logging.FromContext(ctx).DebugContext(ctx, "db query", "query", name, "duration_ms", time.Since(start).Milliseconds())
+	}
+}
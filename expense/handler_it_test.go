@@ -4,13 +4,11 @@ package expense_test
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
-	"net"
 	"net/http"
+	"os"
 	"strings"
 	"testing"
 	"time"
@@ -18,76 +16,46 @@ import (
 	"github.com/labstack/echo/v4"
 	_ "github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
-
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/app"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/client"
 	"github.com/brown-kaew/assessment/config"
 	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/grpcapi/expensev1"
+	"github.com/brown-kaew/assessment/health"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/openapi"
+	"github.com/brown-kaew/assessment/pgtest"
+	"github.com/brown-kaew/assessment/seed"
 )
 
-const (
-	AUTH_SUCCESS = "November 10, 2009"
-)
-
-func setUp() (config.Config, func()) {
-	fmt.Println("setUp")
-	conf := config.New()
-	database, close := expense.InitDB(conf)
-	e := echo.New()
-
-	go startServer(e, conf, database)
-	checkServerReadiness(conf)
-
-	return conf, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		e.Shutdown(ctx)
-		close()
-	}
-}
-
-func setUpNoDB() (config.Config, func()) {
-	fmt.Println("setUpNoDB")
-	conf := config.New()
-	database, close := expense.InitDB(conf)
-	defer close() //close DB after every thing is set
-	e := echo.New()
-
-	go startServer(e, conf, database)
-	checkServerReadiness(conf)
-
-	return conf, func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		e.Shutdown(ctx)
-		close()
-	}
+func TestMain(m *testing.M) {
+	os.Exit(pgtest.Main(m))
 }
 
-func startServer(e *echo.Echo, conf config.Config, database *sql.DB) {
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, "OK")
-	})
-
-	g := e.Group("")
-	g.Use(config.HardCodeAuth)
-	expense.NewHandler(database, g)
-
-	e.Start(conf.Port)
+// setUp serves the API for t alone, on a database of its own, in parallel
+// with the other tests. It returns the Authorization of an admin key.
+func setUp(t *testing.T) (config.Config, string) {
+	t.Parallel()
+	conf, a := pgtest.StartApp(t, app.WithOpenAPIOptions(openapi.Options{ValidateResponses: true}))
+	return conf, pgtest.AdminKey(t, a.DB())
 }
 
-func checkServerReadiness(config config.Config) {
-	for {
-		conn, err := net.DialTimeout("tcp", fmt.Sprintf("localhost%s", config.Port), 30*time.Second)
-		if err != nil {
-			log.Println(err)
-		}
-		if conn != nil {
-			conn.Close()
-			break
-		}
-	}
+// setUpNoDB is setUp with the database of the API closed once it is up.
+func setUpNoDB(t *testing.T) (config.Config, string) {
+	t.Parallel()
+	conf, a := pgtest.StartApp(t, app.WithOpenAPIOptions(openapi.Options{ValidateResponses: true}))
+	admin := pgtest.AdminKey(t, a.DB())
+	a.DB().Close()
+	return conf, admin
 }
 
-func seedExpenses(t *testing.T, config config.Config) int {
+func seedExpenses(t *testing.T, config config.Config, admin string) int {
 	reqBody := `{
 		"title": "strawberry smoothie",
 		"amount": 79,
@@ -101,7 +69,7 @@ func seedExpenses(t *testing.T, config config.Config) int {
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	resp, err := client.Do(req)
@@ -118,8 +86,7 @@ func seedExpenses(t *testing.T, config config.Config) int {
 }
 
 func TestHealth(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, _ := setUp(t)
 
 	// Arrange
 	reqBody := ``
@@ -143,8 +110,7 @@ func TestHealth(t *testing.T) {
 }
 
 func TestCreateNewExpense_Success(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
 	reqBody := `{
@@ -160,7 +126,7 @@ func TestCreateNewExpense_Success(t *testing.T) {
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -184,8 +150,7 @@ func TestCreateNewExpense_Success(t *testing.T) {
 }
 
 func TestCreateNewExpense_InvalidJsonRequest_ShouldGetBadRequest(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
 	reqBody := `{
@@ -201,7 +166,7 @@ func TestCreateNewExpense_InvalidJsonRequest_ShouldGetBadRequest(t *testing.T) {
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -214,13 +179,13 @@ func TestCreateNewExpense_InvalidJsonRequest_ShouldGetBadRequest(t *testing.T) {
 	// Assert
 	if assert.NoError(t, err) {
 		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		assert.Contains(t, strings.TrimSpace(string(byteBody)), `"message":"Unmarshal type error`)
+		assert.Contains(t, strings.TrimSpace(string(byteBody)), `"message":"Request doesn't match the API contract"`)
+		assert.Contains(t, strings.TrimSpace(string(byteBody)), `{"in":"body","field":"/amount","reason":"value must be a number"}`)
 	}
 }
 
 func TestCreateNewExpense_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
-	config, teardown := setUpNoDB()
-	defer teardown()
+	config, admin := setUpNoDB(t)
 
 	// Arrange
 	reqBody := `{
@@ -236,7 +201,7 @@ func TestCreateNewExpense_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
 	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -254,8 +219,7 @@ func TestCreateNewExpense_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
 }
 
 func TestCreateNewExpense_InvalidAuth_ShouldGetUnauthorizedError(t *testing.T) {
-	config, teardown := setUpNoDB()
-	defer teardown()
+	config, _ := setUpNoDB(t)
 
 	// Arrange
 	reqBody := `{
@@ -289,17 +253,16 @@ func TestCreateNewExpense_InvalidAuth_ShouldGetUnauthorizedError(t *testing.T) {
 }
 
 func TestGetExpenseById_Success(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
-	id := seedExpenses(t, config)
+	id := seedExpenses(t, config, admin)
 	reqBody := ``
 	url := fmt.Sprintf("http://localhost%s/expenses/%d", config.Port, id)
 	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -323,8 +286,7 @@ func TestGetExpenseById_Success(t *testing.T) {
 }
 
 func TestGetExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
 	id := "999"
@@ -333,7 +295,7 @@ func TestGetExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -358,8 +320,7 @@ func TestGetExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
 }
 
 func TestGetExpenseById_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
-	config, teardown := setUpNoDB()
-	defer teardown()
+	config, admin := setUpNoDB(t)
 
 	// Arrange
 	reqBody := ``
@@ -367,7 +328,7 @@ func TestGetExpenseById_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
 	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -385,11 +346,10 @@ func TestGetExpenseById_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
 }
 
 func TestUpdateExpenseById_Success(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
-	id := seedExpenses(t, config)
+	id := seedExpenses(t, config, admin)
 	reqBody := `{
 		"title": "MaMa",
 		"amount": 5,
@@ -402,7 +362,7 @@ func TestUpdateExpenseById_Success(t *testing.T) {
 	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -426,8 +386,7 @@ func TestUpdateExpenseById_Success(t *testing.T) {
 }
 
 func TestUpdateExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
 	id := "999"
@@ -443,7 +402,7 @@ func TestUpdateExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
 	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -468,18 +427,17 @@ func TestUpdateExpenseById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
 }
 
 func TestGetAllExpenses_Success(t *testing.T) {
-	config, teardown := setUp()
-	defer teardown()
+	config, admin := setUp(t)
 
 	// Arrange
-	seedExpenses(t, config)
-	seedExpenses(t, config)
+	seedExpenses(t, config, admin)
+	seedExpenses(t, config, admin)
 	reqBody := ``
 	url := fmt.Sprintf("http://localhost%s/expenses", config.Port)
 	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -498,19 +456,137 @@ func TestGetAllExpenses_Success(t *testing.T) {
 	}
 }
 
+func TestClient_ShouldCreateAndPageThroughExpenses(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	c, err := client.New(fmt.Sprintf("http://localhost%s", config.Port), client.WithAuthorization(admin))
+	assert.NoError(t, err)
+	var created []int
+	for i := 0; i < 5; i++ {
+		e, err := c.CreateExpense(context.Background(), client.Expense{Title: "strawberry smoothie", Amount: 79})
+		if assert.NoError(t, err) {
+			created = append(created, e.Id)
+		}
+	}
+
+	// Act
+	var listed []int
+	it := c.ListExpenses(client.ListOptions{PageSize: 2})
+	for it.Next(context.Background()) {
+		listed = append(listed, it.Expense().Id)
+	}
+
+	// Assert
+	assert.NoError(t, it.Err())
+	assert.Subset(t, listed, created)
+	assert.IsIncreasing(t, listed)
+}
+
+// seedGenerated inserts the expenses seed generates for opts straight into
+// the database.
+func seedGenerated(t *testing.T, conf config.Config, opts seed.Options) []seed.Expense {
+	db, err := expense.ConnectDB(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	expenses, err := seed.Populate(context.Background(), db, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return expenses
+}
+
+func TestGetAllExpensesAsOf_SeededExpenses_ShouldListThoseSpentByThen(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	seeded := seedGenerated(t, config, seed.Options{Seed: 49, Count: 200})
+	asOf := time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)
+	var spent []int
+	for _, e := range seeded {
+		if e.At.Before(asOf.AddDate(0, 0, 1)) {
+			spent = append(spent, e.Id)
+		}
+	}
+	url := fmt.Sprintf("http://localhost%s/expenses?as_of=2024-06-30&after=%d&limit=1000", config.Port, seeded[0].Id-1)
+
+	// Act
+	resp, byteBody := send(t, http.MethodGet, url, ``, admin)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	var expenses []expense.Expense
+	assert.NoError(t, json.Unmarshal(byteBody, &expenses))
+	var listed []int
+	for _, e := range expenses {
+		if e.Id <= seeded[len(seeded)-1].Id {
+			listed = append(listed, e.Id)
+		}
+	}
+	assert.NotEmpty(t, spent)
+	assert.Less(t, len(spent), len(seeded))
+	assert.Equal(t, spent, listed)
+}
+
+func TestGrpc_CreateExpense_ShouldBeReadableOverRest(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	conn, err := grpc.NewClient(fmt.Sprintf("localhost%s", config.Port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", admin)
+
+	// Act
+	created, err := expensev1.NewExpenseServiceClient(conn).CreateExpense(ctx, &expensev1.CreateExpenseRequest{
+		Expense: &expensev1.Expense{Title: "strawberry smoothie", Amount: 79, Tags: []string{"food"}},
+	})
+
+	// Assert
+	if assert.NoError(t, err) {
+		resp, byteBody := send(t, http.MethodGet, fmt.Sprintf("http://localhost%s/expenses/%d", config.Port, created.Expense.Id), ``, admin)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.JSONEq(t, fmt.Sprintf(`{"id":%d,"title":"strawberry smoothie","amount":79,"note":"","tags":["food"]}`, created.Expense.Id), string(byteBody))
+	}
+}
+
+func TestGraphql_CreateThenQueryWithHistory(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	url := fmt.Sprintf("http://localhost%s/graphql", config.Port)
+	_, byteBody := send(t, http.MethodPost, url, `{"query":"mutation { createExpense(input: {title: \"apple\", amount: 10, tags: [\"graphql\"]}) { id } }"}`, admin)
+	var created struct {
+		Data struct {
+			CreateExpense struct{ Id string } `json:"createExpense"`
+		} `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(byteBody, &created))
+
+	// Act
+	resp, byteBody := send(t, http.MethodPost, url, `{"query":"{ expenses(filter: {tag: \"graphql\"}, first: 1000) { nodes { id history { version amount } } } tags { tag count } }"}`, admin)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(byteBody), fmt.Sprintf(`{"id":"%s","history":[{"version":1,"amount":10}]}`, created.Data.CreateExpense.Id))
+	assert.Contains(t, string(byteBody), `"tag":"graphql"`)
+	assert.NotContains(t, string(byteBody), `"errors"`)
+}
+
 func TestGetAllExpenses_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
-	config, teardown := setUpNoDB()
-	defer teardown()
+	config, admin := setUpNoDB(t)
 
 	// Arrange
-	seedExpenses(t, config)
-	seedExpenses(t, config)
+	seedExpenses(t, config, admin)
+	seedExpenses(t, config, admin)
 	reqBody := ``
 	url := fmt.Sprintf("http://localhost%s/expenses", config.Port)
 	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(reqBody))
 	assert.NoError(t, err)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-	req.Header.Set(echo.HeaderAuthorization, AUTH_SUCCESS)
+	req.Header.Set(echo.HeaderAuthorization, admin)
 	client := http.Client{}
 
 	// Act
@@ -526,3 +602,239 @@ func TestGetAllExpenses_NoDbConn_ShouldGetInternalServerError(t *testing.T) {
 		assert.Contains(t, strings.TrimSpace(string(byteBody)), `"message":"Cannot prepare statment"`)
 	}
 }
+
+func TestGetExpenseById_AsOf_ShouldGetVersionAtThatTime(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	id := seedExpenses(t, config, admin)
+	time.Sleep(10 * time.Millisecond)
+	asOf := time.Now().UTC()
+	time.Sleep(10 * time.Millisecond)
+	reqBody := `{
+		"title": "MaMa",
+		"amount": 5,
+		"note": "Yummy",
+		"tags": [
+		  "food"
+		]
+	  }`
+	url := fmt.Sprintf("http://localhost%s/expenses/%d", config.Port, id)
+	req, err := http.NewRequest(http.MethodPut, url, strings.NewReader(reqBody))
+	assert.NoError(t, err)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, admin)
+	client := http.Client{}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	url = fmt.Sprintf("http://localhost%s/expenses/%d?as_of=%s", config.Port, id, asOf.Format(time.RFC3339Nano))
+	req, err = http.NewRequest(http.MethodGet, url, strings.NewReader(``))
+	assert.NoError(t, err)
+	req.Header.Set(echo.HeaderAuthorization, admin)
+
+	// Act
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	byteBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Assert
+	var expense expense.Expense
+	err = json.Unmarshal(byteBody, &expense)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, id, expense.Id)
+		assert.Equal(t, "strawberry smoothie", expense.Title)
+		assert.Equal(t, float64(79), expense.Amount)
+		assert.Equal(t, []string{"food", "beverage"}, expense.Tags)
+	}
+}
+
+func TestGetExpenseById_AsOfBeforeCreated_ShouldGetNotFound(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	id := seedExpenses(t, config, admin)
+	url := fmt.Sprintf("http://localhost%s/expenses/%d?as_of=2009-11-10", config.Port, id)
+	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(``))
+	assert.NoError(t, err)
+	req.Header.Set(echo.HeaderAuthorization, admin)
+	client := http.Client{}
+
+	// Act
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	byteBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Assert
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+		assert.Contains(t, strings.TrimSpace(string(byteBody)), `"message":"Expense not found"`)
+	}
+}
+
+func TestReadyz_Success(t *testing.T) {
+	config, _ := setUp(t)
+
+	// Arrange
+	url := fmt.Sprintf("http://localhost%s/readyz", config.Port)
+	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(``))
+	assert.NoError(t, err)
+	client := http.Client{}
+
+	// Act
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	byteBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Assert
+	var readiness health.Readiness
+	err = json.Unmarshal(byteBody, &readiness)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, health.StatusReady, readiness.Status)
+		assert.Equal(t, health.StatusUp, readiness.Database.Status)
+		assert.Equal(t, health.StatusUp, readiness.Migrations.Status)
+	}
+}
+
+func TestReadyz_NoDbConn_ShouldGetServiceUnavailable(t *testing.T) {
+	config, _ := setUpNoDB(t)
+
+	// Arrange
+	url := fmt.Sprintf("http://localhost%s/readyz", config.Port)
+	req, err := http.NewRequest(http.MethodGet, url, strings.NewReader(``))
+	assert.NoError(t, err)
+	client := http.Client{}
+
+	// Act
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	byteBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Assert
+	var readiness health.Readiness
+	err = json.Unmarshal(byteBody, &readiness)
+	if assert.NoError(t, err) {
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+		assert.Equal(t, health.StatusNotReady, readiness.Status)
+		assert.Equal(t, health.StatusDown, readiness.Database.Status)
+	}
+}
+
+func send(t *testing.T, method string, url string, body string, authorization string) (*http.Response, []byte) {
+	return sendInLedger(t, method, url, body, authorization, 0)
+}
+
+// sendInLedger is send with the X-Ledger-Id header set, unless ledgerId is 0.
+func sendInLedger(t *testing.T, method string, url string, body string, authorization string, ledgerId int) (*http.Response, []byte) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, authorization)
+	if ledgerId != 0 {
+		req.Header.Set(ledger.HeaderLedgerId, fmt.Sprint(ledgerId))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	byteBody, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	return resp, byteBody
+}
+
+func TestApiKey_ShouldBeLimitedToItsScopesUntilDeleted(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	baseUrl := fmt.Sprintf("http://localhost%s", config.Port)
+	resp, byteBody := send(t, http.MethodPost, baseUrl+"/api-keys", `{"name":"reporting","scopes":["expenses:read"]}`, admin)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var key apikey.ApiKey
+	assert.NoError(t, json.Unmarshal(byteBody, &key))
+	authorization := auth.SchemeApiKey + " " + key.Key
+
+	// Act
+	readResp, _ := send(t, http.MethodGet, baseUrl+"/expenses", ``, authorization)
+	writeResp, _ := send(t, http.MethodPost, baseUrl+"/expenses", `{"title":"strawberry smoothie","amount":79}`, authorization)
+	_, byteBody = send(t, http.MethodGet, baseUrl+"/api-keys", ``, admin)
+	deleteResp, _ := send(t, http.MethodDelete, fmt.Sprintf("%s/api-keys/%d", baseUrl, key.Id), ``, admin)
+	revokedResp, _ := send(t, http.MethodGet, baseUrl+"/expenses", ``, authorization)
+
+	// Assert
+	assert.Equal(t, http.StatusOK, readResp.StatusCode)
+	assert.Equal(t, http.StatusForbidden, writeResp.StatusCode)
+	var keys []apikey.ApiKey
+	if assert.NoError(t, json.Unmarshal(byteBody, &keys)) {
+		for _, k := range keys {
+			assert.Empty(t, k.Key)
+			if k.Id == key.Id {
+				assert.NotNil(t, k.LastUsedAt)
+			}
+		}
+	}
+	assert.Equal(t, http.StatusNoContent, deleteResp.StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, revokedResp.StatusCode)
+}
+
+func newApiKey(t *testing.T, baseUrl string, admin string, name string) string {
+	resp, byteBody := send(t, http.MethodPost, baseUrl+"/api-keys", `{"name":"`+name+`","scopes":["expenses:read","expenses:write"]}`, admin)
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var key apikey.ApiKey
+	assert.NoError(t, json.Unmarshal(byteBody, &key))
+	return auth.SchemeApiKey + " " + key.Key
+}
+
+func TestLedger_InvitedViewer_ShouldReadButNotWrite(t *testing.T) {
+	config, admin := setUp(t)
+
+	// Arrange
+	baseUrl := fmt.Sprintf("http://localhost%s", config.Port)
+	owner := newApiKey(t, baseUrl, admin, "ledger owner")
+	viewer := newApiKey(t, baseUrl, admin, "ledger viewer")
+	_, byteBody := send(t, http.MethodPost, baseUrl+"/ledgers", `{"name":"household"}`, owner)
+	var l ledger.Ledger
+	assert.NoError(t, json.Unmarshal(byteBody, &l))
+	_, byteBody = sendInLedger(t, http.MethodPost, baseUrl+"/expenses", `{"title":"groceries","amount":420}`, owner, l.Id)
+	var shared expense.Expense
+	assert.NoError(t, json.Unmarshal(byteBody, &shared))
+	_, byteBody = send(t, http.MethodPost, fmt.Sprintf("%s/ledgers/%d/invitations", baseUrl, l.Id), `{"role":"viewer"}`, owner)
+	var invitation ledger.Invitation
+	assert.NoError(t, json.Unmarshal(byteBody, &invitation))
+
+	// Act
+	beforeResp, _ := sendInLedger(t, http.MethodGet, baseUrl+"/expenses", ``, viewer, l.Id)
+	acceptResp, _ := send(t, http.MethodPost, baseUrl+"/invitations/"+invitation.Token+"/accept", ``, viewer)
+	reusedResp, _ := send(t, http.MethodPost, baseUrl+"/invitations/"+invitation.Token+"/accept", ``, viewer)
+	readResp, readBody := sendInLedger(t, http.MethodGet, fmt.Sprintf("%s/expenses/%d", baseUrl, shared.Id), ``, viewer, l.Id)
+	writeResp, _ := sendInLedger(t, http.MethodPost, baseUrl+"/expenses", `{"title":"snacks","amount":50}`, viewer, l.Id)
+	outsideResp, _ := send(t, http.MethodGet, fmt.Sprintf("%s/expenses/%d", baseUrl, shared.Id), ``, viewer)
+	_, membersBody := send(t, http.MethodGet, fmt.Sprintf("%s/ledgers/%d/members", baseUrl, l.Id), ``, owner)
+	var members []ledger.Member
+	assert.NoError(t, json.Unmarshal(membersBody, &members))
+	lastOwnerResp, _ := send(t, http.MethodDelete, fmt.Sprintf("%s/ledgers/%d/members/%s", baseUrl, l.Id, members[0].Subject), ``, owner)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, beforeResp.StatusCode)
+	assert.Equal(t, http.StatusOK, acceptResp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, reusedResp.StatusCode)
+	assert.Equal(t, http.StatusOK, readResp.StatusCode)
+	var got expense.Expense
+	if assert.NoError(t, json.Unmarshal(readBody, &got)) {
+		assert.Equal(t, shared, got)
+	}
+	assert.Equal(t, http.StatusForbidden, writeResp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, outsideResp.StatusCode)
+	assert.Len(t, members, 2)
+	assert.Equal(t, ledger.RoleOwner, members[0].Role)
+	assert.Equal(t, http.StatusConflict, lastOwnerResp.StatusCode)
+}
@@ -3,14 +3,21 @@
 package expense
 
 import (
+	"context"
 	"database/sql"
 	"database/sql/driver"
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
 	"github.com/labstack/echo/v4"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
@@ -24,11 +31,17 @@ func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
 func TestCreateNewExpense(t *testing.T) {
 	db, mock, teardown := setUp(t)
 	defer teardown()
-	handler := NewHandler(db, echo.New().Group(""))
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
 
 	// Arrange
 	expectId := 1
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO expenses").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(expectId))
+	mock.ExpectExec("UPDATE expense_versions").WithArgs(expectId).WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec("INSERT INTO expense_versions").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs(EventExpenseCreated, expectId, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
 	e := &Expense{
 		Title:  "strawberry smoothie",
 		Amount: 79,
@@ -37,7 +50,7 @@ func TestCreateNewExpense(t *testing.T) {
 	}
 
 	// Act
-	err := handler.CreateNewExpense(e)
+	err := handler.CreateNewExpense(context.Background(), e)
 
 	// Assert
 	assert.NoError(t, err)
@@ -53,16 +66,16 @@ func TestCreateNewExpense(t *testing.T) {
 func TestGetExpenseById(t *testing.T) {
 	db, mock, teardown := setUp(t)
 	defer teardown()
-	handler := NewHandler(db, echo.New().Group(""))
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
 
 	// Arrange
 	expectId := 1
-	mock.ExpectPrepare("SELECT \\* FROM expenses.*").ExpectQuery().WithArgs(expectId).
+	mock.ExpectPrepare("SELECT (.+) FROM expenses.*").ExpectQuery().WithArgs(expectId, nil).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
 			AddRow(expectId, "strawberry smoothie", "79", "night market promotion discount 10 bath", `{"food","beverage"}`))
 
 	// Act
-	e, err := handler.GetExpenseById(expectId)
+	e, err := handler.GetExpenseById(context.Background(), expectId)
 
 	// Assert
 	assert.NoError(t, err)
@@ -78,7 +91,7 @@ func TestGetExpenseById(t *testing.T) {
 func TestUpdateExpenseById(t *testing.T) {
 	db, mock, teardown := setUp(t)
 	defer teardown()
-	handler := NewHandler(db, echo.New().Group(""))
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
 
 	// Arrange
 	expectId := 1
@@ -89,12 +102,21 @@ func TestUpdateExpenseById(t *testing.T) {
 		Note:   "night market promotion discount 10 bath",
 		Tags:   []string{"food", "beverage"},
 	}
-	mock.ExpectPrepare("UPDATE expenses.*").ExpectExec().
+	mock.ExpectPrepare("UPDATE expenses.*")
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE expenses.*").
+		WithArgs(expectId, e.Title, e.Amount, e.Note, pq.Array(&e.Tags), nil).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("UPDATE expense_versions").WithArgs(expectId).WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("INSERT INTO expense_versions").
 		WithArgs(expectId, e.Title, e.Amount, e.Note, pq.Array(&e.Tags)).
 		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("INSERT INTO outbox").WithArgs(EventExpenseUpdated, expectId, sqlmock.AnyArg()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
 
 	// Act
-	err := handler.UpdateExpenseById(e)
+	err := handler.UpdateExpenseById(context.Background(), e)
 
 	// Assert
 	assert.NoError(t, err)
@@ -110,16 +132,16 @@ func TestUpdateExpenseById(t *testing.T) {
 func TestGetAllExpenses(t *testing.T) {
 	db, mock, teardown := setUp(t)
 	defer teardown()
-	handler := NewHandler(db, echo.New().Group(""))
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
 
 	// Arrange
-	mock.ExpectPrepare("SELECT \\* FROM expenses.*").ExpectQuery().
+	mock.ExpectPrepare("SELECT (.+) FROM expenses.*").ExpectQuery().WithArgs(nil, 0, nil).
 		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
 			AddRow("1", "strawberry smoothie", "79", "night market promotion discount 10 bath", `{"food","beverage"}`).
 			AddRow("2", "MaMa", "5", "No money", `{"food"}`))
 
 	// Act
-	expenses, err := handler.GetAllExpenses()
+	expenses, err := handler.GetAllExpenses(context.Background(), Page{})
 
 	// Assert
 	assert.NoError(t, err)
@@ -139,3 +161,65 @@ func TestGetAllExpenses(t *testing.T) {
 	assert.Equal(t, "No money", e.Note)
 	assert.Equal(t, []string{"food"}, e.Tags)
 }
+
+func TestGetExpenseById_ShouldStartSpan(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "GET /expenses/:id")
+	mock.ExpectPrepare("SELECT (.+) FROM expenses.*").ExpectQuery().WithArgs(1, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
+			AddRow(1, "strawberry smoothie", "79", "night market promotion discount 10 bath", `{"food","beverage"}`))
+
+	// Act
+	_, err := handler.GetExpenseById(ctx, 1)
+	parent.End()
+
+	// Assert
+	assert.NoError(t, err)
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "expense.GetExpenseById", spans[0].Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), spans[0].Parent().SpanID())
+	}
+}
+
+func TestGetExpenseById_SlowQuery_ShouldGetGatewayTimeout(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{QueryTimeout: 10 * time.Millisecond})
+
+	// Arrange
+	mock.ExpectPrepare("SELECT (.+) FROM expenses.*").ExpectQuery().WithArgs(1, nil).
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}))
+
+	// Act
+	_, err := handler.GetExpenseById(context.Background(), 1)
+
+	// Assert
+	assert.Equal(t, http.StatusGatewayTimeout, err.(*echo.HTTPError).Code)
+}
+
+func TestGetAllExpenses_CanceledRequest_ShouldGetServiceUnavailable(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{QueryTimeout: time.Second})
+
+	// Arrange
+	mock.ExpectPrepare("SELECT (.+) FROM expenses").ExpectQuery().
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	_, err := handler.GetAllExpenses(ctx, Page{})
+
+	// Assert
+	assert.Equal(t, http.StatusServiceUnavailable, err.(*echo.HTTPError).Code)
+}
@@ -0,0 +1,160 @@
+package expense
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/labstack/echo/v4"
+)
+
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+var errIdempotencyKeyInUse = errors.New("idempotency key in use")
+
+// idempotencyKey is an Idempotency-Key as scoped to the caller and the ledger
+// it sent the request to, so callers can't replay each other's responses.
+// ledgerId is 0 outside of a ledger.
+type idempotencyKey struct {
+	subject  string
+	ledgerId int
+	key      string
+}
+
+func newIdempotencyKey(ctx context.Context, key string) idempotencyKey {
+	principal, _ := auth.FromContext(ctx)
+	ledgerId, _, _ := ledger.FromContext(ctx)
+	return idempotencyKey{subject: principal.Subject, ledgerId: ledgerId, key: key}
+}
+
+type idempotentResponse struct {
+	requestHash string
+	statusCode  int
+	body        []byte
+}
+
+// createNewExpenseIdempotent creates the expense at most once per key of the
+// caller and ledger. The key is stored with a hash of the request body and the response in the same
+// transaction as the expense, so a retry either replays that response or, if
+// the first attempt never committed, creates the expense.
+func (h *handler) createNewExpenseIdempotent(c echo.Context, value string) error {
+	key := newIdempotencyKey(c.Request().Context(), value)
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	c.Request().Body = io.NopCloser(bytes.NewReader(body))
+	sum := sha256.Sum256(body)
+	requestHash := hex.EncodeToString(sum[:])
+
+	if replayed, err := h.replayIdempotentResponse(c, key, requestHash); replayed || err != nil {
+		return err
+	}
+
+	var expense Expense
+	err = c.Bind(&expense)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	var response []byte
+	err = h.createNewExpense(c.Request().Context(), &expense, func(tx *sql.Tx) error {
+		response, err = json.Marshal(expense)
+		if err != nil {
+			return err
+		}
+		return h.saveIdempotentResponse(c.Request().Context(), tx, key, idempotentResponse{
+			requestHash: requestHash,
+			statusCode:  http.StatusCreated,
+			body:        response,
+		})
+	})
+	if err == errIdempotencyKeyInUse {
+		// A concurrent request with the same key committed first.
+		if replayed, err := h.replayIdempotentResponse(c, key, requestHash); replayed || err != nil {
+			return err
+		}
+		return echo.NewHTTPError(http.StatusConflict, "A request with this Idempotency-Key is in progress")
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSONBlob(http.StatusCreated, response)
+}
+
+// replayIdempotentResponse writes the stored response for key, if there is an
+// unexpired one, and reports whether it did.
+func (h *handler) replayIdempotentResponse(c echo.Context, key idempotencyKey, requestHash string) (bool, error) {
+	stored, err := h.findIdempotentResponse(c.Request().Context(), key)
+	if err != nil {
+		return false, err
+	}
+	if stored == nil {
+		return false, nil
+	}
+	if stored.requestHash != requestHash {
+		return false, echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was already used with a different request body")
+	}
+	c.Response().Header().Set("Idempotent-Replayed", "true")
+	return true, c.JSONBlob(stored.statusCode, stored.body)
+}
+
+func (h *handler) findIdempotentResponse(ctx context.Context, key idempotencyKey) (*idempotentResponse, error) {
+	ctx, end := h.startQuery(ctx, "FindIdempotentResponse")
+	defer end()
+	row := h.db.QueryRowContext(ctx, `
+	SELECT request_hash, status_code, response_body
+	FROM idempotency_keys
+	WHERE subject=$1 AND ledger_id=$2 AND key=$3 AND expires_at > now()
+	`, key.subject, key.ledgerId, key.key)
+
+	var stored idempotentResponse
+	err := row.Scan(&stored.requestHash, &stored.statusCode, &stored.body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	return &stored, nil
+}
+
+// saveIdempotentResponse stores the response for key, replacing an expired
+// entry. It returns errIdempotencyKeyInUse if an unexpired entry exists.
+func (h *handler) saveIdempotentResponse(ctx context.Context, tx *sql.Tx, key idempotencyKey, response idempotentResponse) error {
+	res, err := tx.ExecContext(ctx, `
+	INSERT INTO
+		idempotency_keys (subject, ledger_id, key, request_hash, status_code, response_body, expires_at)
+	VALUES
+		($1, $2, $3, $4, $5, $6, now() + $7 * interval '1 millisecond')
+	ON CONFLICT (subject, ledger_id, key) DO UPDATE
+	SET
+		request_hash=EXCLUDED.request_hash,
+		status_code=EXCLUDED.status_code,
+		response_body=EXCLUDED.response_body,
+		created_at=now(),
+		expires_at=EXCLUDED.expires_at
+	WHERE idempotency_keys.expires_at <= now()
+	`, key.subject, key.ledgerId, key.key, response.requestHash, response.statusCode, response.body, h.idempotencyTTL.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if row == 0 {
+		return errIdempotencyKeyInUse
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+//go:build unit
+
+package expense
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+const idempotentBody = `{"title":"strawberry smoothie","amount":79,"note":"night market promotion discount 10 bath","tags":["food","beverage"]}`
+
+func hashOf(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+func newIdempotentRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/expenses", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(HeaderIdempotencyKey, "retry-me")
+	return req
+}
+
+func TestCreateNewExpense_IdempotencyKey_ShouldStoreResponse(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{IdempotencyTTL: time.Hour})
+
+	// Arrange
+	mock.ExpectQuery("SELECT (.+) FROM idempotency_keys").WithArgs("", 0, "retry-me").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO expenses").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("UPDATE expense_versions").WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectExec("INSERT INTO expense_versions").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("INSERT INTO outbox").WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectExec("INSERT INTO idempotency_keys").
+		WithArgs("", 0, "retry-me", hashOf(idempotentBody), http.StatusCreated, sqlmock.AnyArg(), time.Hour.Milliseconds()).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, newIdempotentRequest(idempotentBody))
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, `{"id":1,"title":"strawberry smoothie","amount":79,"note":"night market promotion discount 10 bath","tags":["food","beverage"]}`, rec.Body.String())
+}
+
+func TestCreateNewExpense_IdempotencyKeyRetried_ShouldReplayResponse(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{IdempotencyTTL: time.Hour})
+
+	// Arrange
+	stored := `{"id":1,"title":"strawberry smoothie","amount":79,"note":"night market promotion discount 10 bath","tags":["food","beverage"]}`
+	mock.ExpectQuery("SELECT (.+) FROM idempotency_keys").WithArgs("", 0, "retry-me").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(hashOf(idempotentBody), http.StatusCreated, []byte(stored)))
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, newIdempotentRequest(idempotentBody))
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, stored, rec.Body.String())
+}
+
+func TestCreateNewExpense_IdempotencyKeyWithDifferentBody_ShouldGetUnprocessableEntity(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{IdempotencyTTL: time.Hour})
+
+	// Arrange
+	mock.ExpectQuery("SELECT (.+) FROM idempotency_keys").WithArgs("", 0, "retry-me").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(hashOf(`{"title":"MaMa"}`), http.StatusCreated, []byte(`{}`)))
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, newIdempotentRequest(idempotentBody))
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Idempotency-Key was already used with a different request body")
+}
+
+func TestCreateNewExpense_IdempotencyKey_ShouldBeScopedToCallerAndLedger(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{IdempotencyTTL: time.Hour})
+
+	// Arrange
+	mock.ExpectQuery("SELECT (.+) FROM idempotency_keys WHERE subject=\\$1 AND ledger_id=\\$2 AND key=\\$3").
+		WithArgs("apikey:4", 3, "retry-me").
+		WillReturnRows(sqlmock.NewRows([]string{"request_hash", "status_code", "response_body"}).
+			AddRow(hashOf(idempotentBody), http.StatusCreated, []byte(`{"id":1}`)))
+	req := newIdempotentRequest(idempotentBody)
+	ctx := ledger.WithLedger(req.Context(), 3, ledger.RoleEditor)
+	req = req.WithContext(auth.WithPrincipal(ctx, auth.Principal{Subject: "apikey:4"}))
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
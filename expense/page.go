@@ -0,0 +1,55 @@
+package expense
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+const maxPageLimit = 1000
+
+// Page selects the expenses with an id above After, in id order, at most
+// Limit of them. A zero Limit selects all of them, as GET /expenses did
+// before it was paginated.
+type Page struct {
+	After int
+	Limit int
+}
+
+// limitArg is the LIMIT of the page's query; NULL is no limit.
+func (p Page) limitArg() sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(p.Limit), Valid: p.Limit > 0}
+}
+
+// parsePage reads the after and limit query parameters.
+func parsePage(c echo.Context) (Page, error) {
+	var page Page
+	var err error
+	if value := c.QueryParam("after"); value != "" {
+		if page.After, err = strconv.Atoi(value); err != nil || page.After < 0 {
+			return Page{}, echo.NewHTTPError(http.StatusBadRequest, "invalid after, expected an expense Id")
+		}
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		if page.Limit, err = strconv.Atoi(value); err != nil || page.Limit < 1 || page.Limit > maxPageLimit {
+			return Page{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid limit, expected 1 to %d", maxPageLimit))
+		}
+	}
+	return page, nil
+}
+
+// setNextLink points the Link header at the page after expenses when they
+// filled page, so clients follow it until it's gone. Other query parameters,
+// like as_of, are kept.
+func setNextLink(c echo.Context, page Page, expenses []Expense) {
+	if page.Limit == 0 || len(expenses) < page.Limit {
+		return
+	}
+	query := c.Request().URL.Query()
+	query.Set("after", strconv.Itoa(expenses[len(expenses)-1].Id))
+	query.Set("limit", strconv.Itoa(page.Limit))
+	c.Response().Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, c.Request().URL.Path, query.Encode()))
+}
@@ -0,0 +1,87 @@
+//go:build unit
+
+package expense
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAllExpensesHandler_FullPage_ShouldLinkNextPage(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{})
+
+	// Arrange
+	asOf := time.Date(2026, 3, 1, 23, 59, 59, 999999999, time.UTC)
+	mock.ExpectPrepare("SELECT (.+) FROM expense_versions.*").ExpectQuery().WithArgs(asOf, nil, 5, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "title", "amount", "note", "tags"}).
+			AddRow(6, "strawberry smoothie", 79, "", `{}`).
+			AddRow(9, "MaMa", 5, "", `{}`))
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expenses?as_of=2026-03-01&after=5&limit=2", nil))
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `</expenses?after=9&as_of=2026-03-01&limit=2>; rel="next"`, rec.Header().Get("Link"))
+}
+
+func TestGetAllExpensesHandler_LastPage_ShouldNotLinkNextPage(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	NewHandler(db, e.Group(""), config.Config{})
+
+	// Arrange
+	mock.ExpectPrepare("SELECT (.+) FROM expenses.*").ExpectQuery().WithArgs(nil, 9, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
+			AddRow(12, "strawberry smoothie", 79, "", `{}`))
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expenses?after=9&limit=2", nil))
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get("Link"))
+}
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Page
+		err   bool
+	}{
+		{"", Page{}, false},
+		{"after=5&limit=10", Page{After: 5, Limit: 10}, false},
+		{"limit=0", Page{}, true},
+		{"limit=1001", Page{}, true},
+		{"after=-1", Page{}, true},
+		{"after=abc", Page{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			// Arrange
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/expenses?"+tt.query, nil), httptest.NewRecorder())
+
+			// Act
+			page, err := parsePage(c)
+
+			// Assert
+			assert.Equal(t, tt.err, err != nil)
+			assert.Equal(t, tt.want, page)
+		})
+	}
+}
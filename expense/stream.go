@@ -0,0 +1,298 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const (
+	eventChannel     = "expense_events"
+	eventBatchSize   = 100
+	defaultHeartbeat = 15 * time.Second
+)
+
+// Broker listens for outbox notifications from Postgres and wakes every
+// connected stream. Notifications only carry the event id; streams read the
+// events themselves from the outbox, so every replica sees every event no
+// matter which replica wrote it.
+type Broker struct {
+	notify      <-chan *pq.Notification
+	closer      func() error
+	closeOnce   sync.Once
+	closeErr    error
+	done        chan struct{}
+	mu          sync.Mutex
+	subscribers map[chan struct{}]struct{}
+}
+
+func NewBroker(conf config.Config) *Broker {
+	listener := pq.NewListener(conf.DatabaseUrl, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("expense event listener error", "error", err)
+		}
+	})
+	if err := listener.Listen(eventChannel); err != nil {
+		slog.Error("can't listen for expense events", "channel", eventChannel, "error", err)
+	}
+	return newBroker(listener.Notify, listener.Close)
+}
+
+func newBroker(notify <-chan *pq.Notification, closer func() error) *Broker {
+	return &Broker{
+		notify:      notify,
+		closer:      closer,
+		done:        make(chan struct{}),
+		subscribers: map[chan struct{}]struct{}{},
+	}
+}
+
+// Run fans notifications out to subscribers until ctx is cancelled, then ends
+// every open stream.
+func (b *Broker) Run(ctx context.Context) {
+	defer close(b.done)
+	defer b.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-b.notify:
+			// A nil notification means the listener reconnected and may have
+			// missed events; waking subscribers makes them catch up either way.
+			b.wake()
+		}
+	}
+}
+
+// Close stops listening for notifications. Run closes the broker when it
+// returns; call Close to release a broker that never runs.
+func (b *Broker) Close() error {
+	b.closeOnce.Do(func() { b.closeErr = b.closer() })
+	return b.closeErr
+}
+
+// Done is closed once the broker has stopped.
+func (b *Broker) Done() <-chan struct{} {
+	return b.done
+}
+
+func (b *Broker) subscribe() (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+	}
+}
+
+func (b *Broker) wake() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type streamHandler struct {
+	db           *sql.DB
+	broker       *Broker
+	heartbeat    time.Duration
+	queryTimeout time.Duration
+}
+
+// NewStreamHandler serves expense events as server-sent events. There are
+// created and updated events only: expenses can't be deleted.
+func NewStreamHandler(db *sql.DB, broker *Broker, g *echo.Group, conf config.Config) {
+	handler := &streamHandler{
+		db:           db,
+		broker:       broker,
+		heartbeat:    defaultHeartbeat,
+		queryTimeout: conf.QueryTimeout,
+	}
+	g.GET("/expenses/stream", handler.streamHandler())
+}
+
+func (h *streamHandler) streamHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		updates, unsubscribe := h.broker.subscribe()
+		defer unsubscribe()
+
+		position, err := h.lastEventId(c)
+		if err != nil {
+			return err
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Connection", "keep-alive")
+		res.WriteHeader(http.StatusOK)
+		res.Flush()
+
+		heartbeat := time.NewTicker(h.heartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			events, err := h.readEventsAfter(c.Request().Context(), position)
+			if err != nil {
+				// Headers are already sent; end the stream and let the client
+				// reconnect with Last-Event-ID.
+				logging.FromContext(c.Request().Context()).Error("can't read events for stream", "error", err)
+				return nil
+			}
+			for _, event := range events {
+				if err := writeEvent(res, event); err != nil {
+					return nil
+				}
+				position = event.position
+			}
+			res.Flush()
+			if len(events) == eventBatchSize {
+				continue
+			}
+
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-h.broker.Done():
+				return nil
+			case <-updates:
+			case <-heartbeat.C:
+				fmt.Fprint(res, ": ping\n\n")
+				res.Flush()
+			}
+		}
+	}
+}
+
+// streamPosition is where a stream is in the outbox: after the event id of
+// transaction txid. Events are streamed in commit order rather than id order,
+// since ids are taken before commit and a transaction can commit a lower id
+// after another has committed a higher one.
+type streamPosition struct {
+	txid int64
+	id   int64
+}
+
+func (p streamPosition) String() string {
+	return strconv.FormatInt(p.txid, 10) + "-" + strconv.FormatInt(p.id, 10)
+}
+
+func parseStreamPosition(value string) (streamPosition, error) {
+	txid, id, ok := strings.Cut(value, "-")
+	if !ok {
+		return streamPosition{}, errors.New("missing event id")
+	}
+	var p streamPosition
+	var err error
+	if p.txid, err = strconv.ParseInt(txid, 10, 64); err != nil {
+		return streamPosition{}, err
+	}
+	if p.id, err = strconv.ParseInt(id, 10, 64); err != nil {
+		return streamPosition{}, err
+	}
+	return p, nil
+}
+
+// streamEvent is an event along with its position in the stream.
+type streamEvent struct {
+	Event
+	position streamPosition
+}
+
+// lastEventId returns the position after which the stream starts.
+// Reconnecting clients send Last-Event-ID (or last_event_id, since
+// EventSource can't set headers on the first connection); new clients start
+// after every transaction that had finished, so they may get a few events
+// committed just before they connected.
+func (h *streamHandler) lastEventId(c echo.Context) (streamPosition, error) {
+	value := c.Request().Header.Get("Last-Event-ID")
+	if value == "" {
+		value = c.QueryParam("last_event_id")
+	}
+	if value != "" {
+		position, err := parseStreamPosition(value)
+		if err != nil {
+			return streamPosition{}, echo.NewHTTPError(http.StatusBadRequest, "invalid Last-Event-ID")
+		}
+		return position, nil
+	}
+
+	ctx, cancel := database.WithTimeout(c.Request().Context(), h.queryTimeout)
+	defer cancel()
+	var position streamPosition
+	if err := h.db.QueryRowContext(ctx, "SELECT txid_snapshot_xmin(txid_current_snapshot())").Scan(&position.txid); err != nil {
+		return streamPosition{}, database.HTTPError(ctx, err, "")
+	}
+	return position, nil
+}
+
+// readEventsAfter reads the next batch of events of expenses in the ledger
+// of ctx. It only reads events of transactions older than every running
+// one, so no event can commit behind the returned position later; a long
+// running transaction holds the stream back until it ends. Each batch gets
+// its own deadline since the stream itself stays open indefinitely.
+func (h *streamHandler) readEventsAfter(ctx context.Context, position streamPosition) ([]streamEvent, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT o.txid, o.id, o.event_type, o.expense_id, o.payload, o.created_at
+	FROM outbox o
+		JOIN expenses e ON e.id = o.expense_id
+	WHERE (o.txid, o.id) > ($1, $2)
+		AND o.txid < txid_snapshot_xmin(txid_current_snapshot())
+		AND e.ledger_id IS NOT DISTINCT FROM $4
+	ORDER BY o.txid, o.id
+	LIMIT $3
+	`, position.txid, position.id, eventBatchSize, ledger.IdArg(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []streamEvent
+	for rows.Next() {
+		var event streamEvent
+		var payload []byte
+		err = rows.Scan(&event.position.txid, &event.Id, &event.Type, &event.ExpenseId, &payload, &event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		event.position.id = event.Id
+		event.Data = payload
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func writeEvent(res *echo.Response, event streamEvent) error {
+	data, err := json.Marshal(event.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(res, "id: %s\nevent: %s\ndata: %s\n\n", event.position, event.Type, data)
+	return err
+}
@@ -0,0 +1,145 @@
+//go:build unit
+
+package expense
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker_ShouldWakeSubscribersOnNotification(t *testing.T) {
+	// Arrange
+	notify := make(chan *pq.Notification)
+	closed := false
+	broker := newBroker(notify, func() error { closed = true; return nil })
+	updates, unsubscribe := broker.subscribe()
+	defer unsubscribe()
+	ctx, cancel := context.WithCancel(context.Background())
+	go broker.Run(ctx)
+
+	// Act
+	notify <- &pq.Notification{Channel: eventChannel, Extra: "1"}
+
+	// Assert
+	select {
+	case <-updates:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber was not woken")
+	}
+	cancel()
+	<-broker.Done()
+	assert.True(t, closed)
+}
+
+func TestBroker_CloseThenRun_ShouldCloseTheListenerOnce(t *testing.T) {
+	// Arrange
+	closed := 0
+	broker := newBroker(make(chan *pq.Notification), func() error { closed++; return nil })
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Act
+	err := broker.Close()
+	broker.Run(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 1, closed)
+}
+
+func TestStreamHandler_ShouldResumeAfterLastEventId(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	e := echo.New()
+	broker := newBroker(make(chan *pq.Notification), func() error { return nil })
+	NewStreamHandler(db, broker, e.Group(""), config.Config{})
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("SELECT (.+) FROM outbox (.+) ORDER BY o.txid, o.id").WithArgs(740, 5, eventBatchSize, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"txid", "id", "event_type", "expense_id", "payload", "created_at"}).
+			AddRow(738, 6, EventExpenseUpdated, 1, `{"id":1}`, createdAt))
+
+	// A stopped broker ends the stream once the backlog is written.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	broker.Run(ctx)
+	req := httptest.NewRequest(http.MethodGet, "/expenses/stream", nil)
+	req.Header.Set("Last-Event-ID", "740-5")
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/event-stream", rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Body.String(), "id: 738-6\nevent: expense.updated\ndata: {\"id\":6,\"type\":\"expense.updated\",\"expense_id\":1,\"data\":{\"id\":1}")
+}
+
+func TestStreamHandler_NoLastEventId_ShouldStartAfterFinishedTransactions(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	e := echo.New()
+	broker := newBroker(make(chan *pq.Notification), func() error { return nil })
+	NewStreamHandler(db, broker, e.Group(""), config.Config{})
+	mock.ExpectQuery("SELECT txid_snapshot_xmin\\(txid_current_snapshot\\(\\)\\)").
+		WillReturnRows(sqlmock.NewRows([]string{"txid_snapshot_xmin"}).AddRow(812))
+	mock.ExpectQuery("SELECT (.+) FROM outbox").WithArgs(812, 0, eventBatchSize, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"txid", "id", "event_type", "expense_id", "payload", "created_at"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	broker.Run(ctx)
+	req := httptest.NewRequest(http.MethodGet, "/expenses/stream", nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestParseStreamPosition(t *testing.T) {
+	position, err := parseStreamPosition("740-5")
+	assert.NoError(t, err)
+	assert.Equal(t, streamPosition{txid: 740, id: 5}, position)
+	assert.Equal(t, "740-5", position.String())
+
+	for _, value := range []string{"5", "abc", "740-", "-5", "740-5-1"} {
+		_, err := parseStreamPosition(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestStreamHandler_InvalidLastEventId_ShouldGetBadRequest(t *testing.T) {
+	db, _, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	e := echo.New()
+	broker := newBroker(make(chan *pq.Notification), func() error { return nil })
+	NewStreamHandler(db, broker, e.Group(""), config.Config{})
+	req := httptest.NewRequest(http.MethodGet, "/expenses/stream?last_event_id=abc", nil)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
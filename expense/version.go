@@ -0,0 +1,124 @@
+package expense
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/labstack/echo/v4"
+	"github.com/lib/pq"
+)
+
+const dateLayout = "2006-01-02"
+
+const (
+	getExpenseByIdAsOfSQL = `
+	SELECT v.expense_id, v.title, v.amount, v.note, v.tags
+	FROM expense_versions v
+		JOIN expenses e ON e.id = v.expense_id
+	WHERE v.expense_id=$1 AND v.valid_from <= $2 AND (v.valid_to IS NULL OR v.valid_to > $2)
+		AND e.ledger_id IS NOT DISTINCT FROM $3
+	`
+	getAllExpensesAsOfSQL = `
+	SELECT v.expense_id, v.title, v.amount, v.note, v.tags
+	FROM expense_versions v
+		JOIN expenses e ON e.id = v.expense_id
+	WHERE v.valid_from <= $1 AND (v.valid_to IS NULL OR v.valid_to > $1)
+		AND e.ledger_id IS NOT DISTINCT FROM $2 AND v.expense_id > $3
+	ORDER BY v.expense_id
+	LIMIT $4
+	`
+)
+
+// recordVersion closes the currently valid version of the expense and appends
+// a new one, so expense_versions always holds the full timeline of an expense.
+// It must run in the same transaction as the write it records.
+func recordVersion(ctx context.Context, tx *sql.Tx, expense *Expense) error {
+	_, err := tx.ExecContext(ctx, `
+	UPDATE expense_versions
+	SET valid_to=now()
+	WHERE expense_id=$1 AND valid_to IS NULL
+	`, expense.Id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO
+		expense_versions (expense_id, version, title, amount, note, tags, valid_from)
+	SELECT
+		$1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, now()
+	FROM expense_versions
+	WHERE expense_id=$1
+	`, expense.Id, expense.Title, expense.Amount, expense.Note, pq.Array(&expense.Tags))
+	return err
+}
+
+// parseAsOf reads the as_of query parameter. It accepts an RFC 3339 timestamp
+// or a plain date, which is read as the end of that day in UTC. ok is false
+// when the parameter is absent.
+func parseAsOf(value string) (asOf time.Time, ok bool, err error) {
+	if value == "" {
+		return time.Time{}, false, nil
+	}
+	if asOf, err = time.Parse(time.RFC3339Nano, value); err == nil {
+		return asOf, true, nil
+	}
+	if asOf, err = time.Parse(dateLayout, value); err == nil {
+		return asOf.Add(24*time.Hour - time.Nanosecond), true, nil
+	}
+	return time.Time{}, false, echo.NewHTTPError(http.StatusBadRequest, "invalid as_of, expected RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+func (h *handler) GetExpenseByIdAsOf(ctx context.Context, id int, asOf time.Time) (*Expense, error) {
+	ctx, end := h.startQuery(ctx, "GetExpenseByIdAsOf")
+	defer end()
+	stmt, err := h.stmts.Prepare(ctx, getExpenseByIdAsOfSQL)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot prepare statment")
+	}
+
+	row := stmt.QueryRowContext(ctx, id, asOf, ledger.IdArg(ctx))
+
+	var expense Expense
+	err = row.Scan(&expense.Id, &expense.Title, &expense.Amount, &expense.Note, pq.Array(&expense.Tags))
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+	}
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	return &expense, nil
+}
+
+func (h *handler) GetAllExpensesAsOf(ctx context.Context, asOf time.Time, page Page) ([]Expense, error) {
+	ctx, end := h.startQuery(ctx, "GetAllExpensesAsOf")
+	defer end()
+	stmt, err := h.stmts.Prepare(ctx, getAllExpensesAsOfSQL)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot prepare statment")
+	}
+
+	rows, err := stmt.QueryContext(ctx, asOf, ledger.IdArg(ctx), page.After, page.limitArg())
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all expenses: "+err.Error())
+	}
+	defer rows.Close()
+
+	var expenses []Expense
+	for rows.Next() {
+		var expense Expense
+		err = rows.Scan(&expense.Id, &expense.Title, &expense.Amount, &expense.Note, pq.Array(&expense.Tags))
+		if err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan expense: "+err.Error())
+		}
+		expenses = append(expenses, expense)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all expenses: "+err.Error())
+	}
+	return expenses, nil
+}
@@ -0,0 +1,107 @@
+//go:build unit
+
+package expense
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAsOf(t *testing.T) {
+	// Timestamp
+	asOf, ok, err := parseAsOf("2026-03-01T10:00:00Z")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC), asOf)
+
+	// Date is read as the end of that day
+	asOf, ok, err = parseAsOf("2026-03-01")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, time.Date(2026, 3, 1, 23, 59, 59, 999999999, time.UTC), asOf)
+
+	// Absent
+	_, ok, err = parseAsOf("")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	// Invalid
+	_, _, err = parseAsOf("yesterday")
+	assert.Error(t, err)
+}
+
+func TestGetExpenseByIdAsOf(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	expectId := 1
+	asOf := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectPrepare("SELECT (.+) FROM expense_versions.*").ExpectQuery().WithArgs(expectId, asOf, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "title", "amount", "note", "tags"}).
+			AddRow(expectId, "strawberry smoothie", "79", "night market promotion discount 10 bath", `{"food","beverage"}`))
+
+	// Act
+	e, err := handler.GetExpenseByIdAsOf(context.Background(), expectId, asOf)
+
+	// Assert
+	assert.NoError(t, err)
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err)
+	assert.Equal(t, expectId, e.Id)
+	assert.Equal(t, "strawberry smoothie", e.Title)
+	assert.Equal(t, float64(79), e.Amount)
+	assert.Equal(t, "night market promotion discount 10 bath", e.Note)
+	assert.Equal(t, []string{"food", "beverage"}, e.Tags)
+}
+
+func TestGetExpenseByIdAsOf_NoVersion_ShouldGetNotFound(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	asOf := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectPrepare("SELECT (.+) FROM expense_versions.*").ExpectQuery().WithArgs(1, asOf, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "title", "amount", "note", "tags"}))
+
+	// Act
+	e, err := handler.GetExpenseByIdAsOf(context.Background(), 1, asOf)
+
+	// Assert
+	assert.Nil(t, e)
+	assert.Equal(t, echo.NewHTTPError(404, "Expense not found"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetAllExpensesAsOf(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	asOf := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectPrepare("SELECT (.+) FROM expense_versions.*").ExpectQuery().WithArgs(asOf, nil, 0, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "title", "amount", "note", "tags"}).
+			AddRow("1", "strawberry smoothie", "79", "night market promotion discount 10 bath", `{"food","beverage"}`).
+			AddRow("2", "MaMa", "5", "No money", `{"food"}`))
+
+	// Act
+	expenses, err := handler.GetAllExpensesAsOf(context.Background(), asOf, Page{})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 2, len(expenses))
+	assert.Equal(t, 1, expenses[0].Id)
+	assert.Equal(t, "strawberry smoothie", expenses[0].Title)
+	assert.Equal(t, 2, expenses[1].Id)
+	assert.Equal(t, "MaMa", expenses[1].Title)
+}
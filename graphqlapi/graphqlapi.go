@@ -0,0 +1,176 @@
+// Package graphqlapi serves /graphql, which reads expenses, their history
+// and tag totals in one round trip and creates and updates expenses.
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/ratelimit"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed schema.graphql
+var schema string
+
+// Limits on the work one request can ask for. maxDepth leaves room for the
+// introspection query of GraphQL tools. Of at most maxRootFields root
+// fields, maxListFields may be expenses or tags, which read up to maxFirst
+// rows or the whole ledger, and maxMutations may be mutations.
+const (
+	maxDepth       = 15
+	maxParallelism = 10
+	maxRootFields  = 10
+	maxListFields  = 3
+	maxMutations   = 5
+)
+
+type handler struct {
+	db           *sql.DB
+	expenses     expense.Handler
+	schema       *graphql.Schema
+	queryTimeout time.Duration
+}
+
+// NewHandler registers POST /graphql on g. Creating and updating expenses
+// goes through expenses, so they are versioned and published like those
+// made over REST.
+func NewHandler(db *sql.DB, expenses expense.Handler, g *echo.Group, conf config.Config) {
+	h := &handler{
+		db:           db,
+		expenses:     expenses,
+		queryTimeout: conf.QueryTimeout,
+	}
+	h.schema = graphql.MustParseSchema(schema, &resolver{h},
+		graphql.MaxDepth(maxDepth), graphql.MaxParallelism(maxParallelism))
+	g.POST("/graphql", h.graphqlHandler())
+}
+
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// graphqlHandler answers 200 with the errors of the query in the body, as
+// GraphQL clients expect, even when it fails entirely.
+func (h *handler) graphqlHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req request
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		ctx := withHistoryLoader(c.Request().Context(), newHistoryLoader(h.loadHistory))
+		ctx = context.WithValue(ctx, rootFieldsKey{}, &rootFields{})
+		return c.JSON(http.StatusOK, h.schema.Exec(ctx, req.Query, req.OperationName, req.Variables))
+	}
+}
+
+// rootFields counts the root fields resolved for a request, by kind.
+type rootFields struct {
+	all, lists, mutations atomic.Int32
+}
+
+type rootFieldsKey struct{}
+
+type fieldKind int
+
+const (
+	otherField fieldKind = iota
+	listField
+	mutationField
+)
+
+// countRootField counts one more root field of kind resolved for the request
+// of ctx, and refuses it past the limits.
+func countRootField(ctx context.Context, kind fieldKind) error {
+	counts := ctx.Value(rootFieldsKey{}).(*rootFields)
+	tooMany := func(what string, max int) error {
+		return apiError{status: http.StatusBadRequest, message: fmt.Sprintf("too many %s, expected at most %d", what, max)}
+	}
+	if counts.all.Add(1) > maxRootFields {
+		return tooMany("root fields", maxRootFields)
+	}
+	switch kind {
+	case listField:
+		if counts.lists.Add(1) > maxListFields {
+			return tooMany("expenses and tags fields", maxListFields)
+		}
+	case mutationField:
+		if counts.mutations.Add(1) > maxMutations {
+			return tooMany("mutations", maxMutations)
+		}
+	}
+	return nil
+}
+
+// countMutation counts a mutation against the limits, and against the rate
+// limit of route, the REST route doing the same work; the POST /graphql it
+// came in only counts once.
+func countMutation(ctx context.Context, route string) error {
+	if err := countRootField(ctx, mutationField); err != nil {
+		return err
+	}
+	if err := ratelimit.Take(ctx, route); err != nil {
+		return resolverError(err)
+	}
+	return nil
+}
+
+// apiError is an error for the caller, with its HTTP status as the status
+// extension.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e apiError) Error() string {
+	return e.message
+}
+
+func (e apiError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"status": e.status}
+}
+
+// resolverError turns the echo.HTTPError of the expense handler and of
+// database.HTTPError into an apiError; other errors are hidden.
+func resolverError(err error) error {
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		message := fmt.Sprint(he.Message)
+		if message == "" {
+			message = http.StatusText(he.Code)
+		}
+		return apiError{status: he.Code, message: message}
+	}
+	var ae apiError
+	if errors.As(err, &ae) {
+		return ae
+	}
+	return apiError{status: http.StatusInternalServerError, message: http.StatusText(http.StatusInternalServerError)}
+}
+
+// requireWrite refuses mutations to callers who may only read. Queries and
+// mutations share POST /graphql, which auth.Middleware and
+// ledger.Middleware let readers through.
+func requireWrite(ctx context.Context) error {
+	principal, _ := auth.FromContext(ctx)
+	if !principal.HasScope(auth.ScopeExpensesWrite) {
+		return apiError{status: http.StatusForbidden, message: "Missing scope " + auth.ScopeExpensesWrite}
+	}
+	if _, role, ok := ledger.FromContext(ctx); ok && !role.Allows(ledger.ActionWrite) {
+		return apiError{status: http.StatusForbidden, message: "Role " + string(role) + " can't " + string(ledger.ActionWrite) + " in this ledger"}
+	}
+	return nil
+}
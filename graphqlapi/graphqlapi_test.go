@@ -0,0 +1,406 @@
+//go:build unit
+
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/ratelimit"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubExpenses stands in for the expense handler, which has its own tests.
+type stubExpenses struct {
+	expense.Handler
+	created []expense.Expense
+}
+
+func (s *stubExpenses) CreateNewExpense(ctx context.Context, e *expense.Expense) error {
+	e.Id = len(s.created) + 1
+	s.created = append(s.created, *e)
+	return nil
+}
+
+func (s *stubExpenses) GetExpenseById(ctx context.Context, id int) (*expense.Expense, error) {
+	return nil, echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+}
+
+// newTestServer serves /graphql to a principal with the scopes of the
+// X-Scopes header, working in ledger 7 as the role of the X-Role header,
+// when there is one, behind middleware.
+func newTestServer(db *sql.DB, expenses expense.Handler, middleware ...echo.MiddlewareFunc) *echo.Echo {
+	e := echo.New()
+	g := e.Group("", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := auth.WithPrincipal(c.Request().Context(), auth.Principal{
+				Subject: "api-key:1",
+				Scopes:  strings.Split(c.Request().Header.Get("X-Scopes"), ","),
+			})
+			if role := c.Request().Header.Get("X-Role"); role != "" {
+				ctx = ledger.WithLedger(ctx, 7, ledger.Role(role))
+			}
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+	g.Use(middleware...)
+	NewHandler(db, expenses, g, config.Config{})
+	return e
+}
+
+type result struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+func query(t *testing.T, e *echo.Echo, scopes string, role string, q string) result {
+	body, _ := json.Marshal(map[string]string{"query": q})
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(string(body)))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-Scopes", scopes)
+	req.Header.Set("X-Role", role)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var r result
+	if err := json.Unmarshal(rec.Body.Bytes(), &r); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// idsArg matches an int array argument holding ids in any order.
+type idsArg []int
+
+func (a idsArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	got := strings.Split(strings.Trim(s, "{}"), ",")
+	if len(got) != len(a) {
+		return false
+	}
+	want := map[string]bool{}
+	for _, id := range a {
+		want[strconv.Itoa(id)] = true
+	}
+	for _, id := range got {
+		if !want[id] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestExpenses_WithHistory_ShouldLoadHistoryInOneQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	validFrom := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	validTo := validFrom.Add(time.Hour)
+	mock.ExpectQuery("SELECT id, title, amount, note, tags FROM expenses").
+		WithArgs(nil, 0, nil, nil, nil, nil, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
+			AddRow(1, "apple", 10, "", "{food}").
+			AddRow(2, "pear", 12, "", "{}"))
+	mock.ExpectQuery("SELECT (.+) FROM expense_versions v").
+		WithArgs(idsArg{1, 2}, nil).
+		WillReturnRows(sqlmock.NewRows([]string{"expense_id", "version", "title", "amount", "note", "tags", "valid_from", "valid_to"}).
+			AddRow(1, 1, "apple", 9, "", "{food}", validFrom, validTo).
+			AddRow(1, 2, "apple", 10, "", "{food}", validTo, nil).
+			AddRow(2, 1, "pear", 12, "", "{}", validFrom, nil))
+	e := newTestServer(db, &stubExpenses{})
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, "", `{
+		expenses(first: 2) {
+			nodes { id title tags history { version amount validTo } }
+			pageInfo { endCursor hasNextPage }
+		}
+	}`)
+
+	// Assert
+	assert.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"expenses": {
+		"nodes": [
+			{"id": "1", "title": "apple", "tags": ["food"], "history": [
+				{"version": 1, "amount": 9, "validTo": "2024-01-01T01:00:00Z"},
+				{"version": 2, "amount": 10, "validTo": null}
+			]},
+			{"id": "2", "title": "pear", "tags": [], "history": [
+				{"version": 1, "amount": 12, "validTo": null}
+			]}
+		],
+		"pageInfo": {"endCursor": "2", "hasNextPage": false}
+	}}`, string(r.Data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExpenses_Filter_ShouldBeQueryArguments(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	mock.ExpectQuery("SELECT id, title, amount, note, tags FROM expenses").
+		WithArgs(sql.NullInt64{Int64: 7, Valid: true}, 3, "food", "smoothie", 10.0, nil, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "title", "amount", "note", "tags"}).
+			AddRow(4, "strawberry smoothie", 79, "", "{food}").
+			AddRow(5, "mango smoothie", 89, "", "{food}"))
+	e := newTestServer(db, &stubExpenses{})
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, string(ledger.RoleViewer), `{
+		expenses(first: 1, after: "3", filter: {tag: "food", titleContains: "smoothie", minAmount: 10}) {
+			nodes { id }
+			pageInfo { endCursor hasNextPage }
+		}
+	}`)
+
+	// Assert
+	assert.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"expenses": {"nodes": [{"id": "4"}], "pageInfo": {"endCursor": "4", "hasNextPage": true}}}`, string(r.Data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestTags_ShouldSumAmountsPerTag(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	mock.ExpectQuery("SELECT tag, COUNT\\(\\*\\), SUM\\(amount\\)").
+		WithArgs(nil).
+		WillReturnRows(sqlmock.NewRows([]string{"tag", "count", "sum"}).
+			AddRow("beverage", 1, 79).
+			AddRow("food", 2, 89))
+	e := newTestServer(db, &stubExpenses{})
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, "", `{ tags { tag count total } }`)
+
+	// Assert
+	assert.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"tags": [{"tag": "beverage", "count": 1, "total": 79}, {"tag": "food", "count": 2, "total": 89}]}`, string(r.Data))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateExpense(t *testing.T) {
+	tests := []struct {
+		name    string
+		scopes  string
+		role    ledger.Role
+		created int
+		message string
+	}{
+		{"writer", auth.ScopeExpensesWrite, "", 1, ""},
+		{"editor", auth.ScopeExpensesWrite, ledger.RoleEditor, 1, ""},
+		{"read scope", auth.ScopeExpensesRead, "", 0, "Missing scope expenses:write"},
+		{"viewer", auth.ScopeExpensesWrite, ledger.RoleViewer, 0, "Role viewer can't write in this ledger"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			expenses := &stubExpenses{}
+			e := newTestServer(nil, expenses)
+
+			// Act
+			r := query(t, e, tt.scopes, string(tt.role), `mutation {
+				createExpense(input: {title: "strawberry smoothie", amount: 79, tags: ["food"]}) { id title note tags }
+			}`)
+
+			// Assert
+			assert.Len(t, expenses.created, tt.created)
+			if tt.message == "" {
+				assert.Empty(t, r.Errors)
+				assert.JSONEq(t, `{"createExpense": {"id": "1", "title": "strawberry smoothie", "note": "", "tags": ["food"]}}`, string(r.Data))
+			} else if assert.Len(t, r.Errors, 1) {
+				assert.Equal(t, tt.message, r.Errors[0].Message)
+				assert.Equal(t, float64(http.StatusForbidden), r.Errors[0].Extensions["status"])
+			}
+		})
+	}
+}
+
+func TestExpense_NotFound_ShouldBeNull(t *testing.T) {
+	// Arrange
+	e := newTestServer(nil, &stubExpenses{})
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, "", `{ expense(id: "9") { id } }`)
+
+	// Assert
+	assert.Empty(t, r.Errors)
+	assert.JSONEq(t, `{"expense": null}`, string(r.Data))
+}
+
+func TestExpenses_InvalidArguments_ShouldFail(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		message string
+	}{
+		{"first too large", `{ expenses(first: 1001) { nodes { id } } }`, "invalid first, expected 1 to 1000"},
+		{"invalid cursor", `{ expenses(after: "abc") { nodes { id } } }`, `invalid id "abc", expected an expense Id`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			e := newTestServer(nil, &stubExpenses{})
+
+			// Act
+			r := query(t, e, auth.ScopeExpensesRead, "", tt.query)
+
+			// Assert
+			if assert.Len(t, r.Errors, 1) {
+				assert.Equal(t, tt.message, r.Errors[0].Message)
+				assert.Equal(t, float64(http.StatusBadRequest), r.Errors[0].Extensions["status"])
+			}
+		})
+	}
+}
+
+func TestListFields_TooManyAliases_ShouldFailThosePastTheLimit(t *testing.T) {
+	tests := []struct {
+		field   string
+		sql     string
+		columns []string
+	}{
+		{"expenses { nodes { id } }", "SELECT id, title, amount, note, tags FROM expenses", []string{"id", "title", "amount", "note", "tags"}},
+		{"tags { tag }", "SELECT tag, COUNT", []string{"tag", "count", "sum"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+			}
+			defer db.Close()
+
+			// Arrange
+			for i := 0; i < maxListFields; i++ {
+				mock.ExpectQuery(tt.sql).WillReturnRows(sqlmock.NewRows(tt.columns))
+			}
+			e := newTestServer(db, &stubExpenses{})
+			q := "{"
+			for i := 0; i <= maxListFields; i++ {
+				q += fmt.Sprintf(" a%d: %s", i, tt.field)
+			}
+			q += " }"
+
+			// Act
+			r := query(t, e, auth.ScopeExpensesRead, "", q)
+
+			// Assert
+			if assert.Len(t, r.Errors, 1) {
+				assert.Equal(t, "too many expenses and tags fields, expected at most 3", r.Errors[0].Message)
+				assert.Equal(t, float64(http.StatusBadRequest), r.Errors[0].Extensions["status"])
+			}
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestQuery_TooDeep_ShouldFail(t *testing.T) {
+	// Arrange
+	e := newTestServer(nil, &stubExpenses{})
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, "", `{ __schema { types { fields { type { ofType { ofType { ofType { ofType { ofType { ofType { ofType { ofType { ofType { ofType { ofType { name } } } } } } } } } } } } } } } }`)
+
+	// Assert
+	if assert.Len(t, r.Errors, 1) {
+		assert.Contains(t, r.Errors[0].Message, "exceeds max depth 15")
+	}
+}
+
+func TestQuery_TooManyRootFields_ShouldFailThosePastTheLimit(t *testing.T) {
+	// Arrange
+	e := newTestServer(nil, &stubExpenses{})
+	q := "{"
+	for i := 0; i <= maxRootFields; i++ {
+		q += fmt.Sprintf(` e%d: expense(id: "9") { id }`, i)
+	}
+	q += " }"
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesRead, "", q)
+
+	// Assert
+	if assert.Len(t, r.Errors, 1) {
+		assert.Equal(t, "too many root fields, expected at most 10", r.Errors[0].Message)
+		assert.Equal(t, float64(http.StatusBadRequest), r.Errors[0].Extensions["status"])
+	}
+}
+
+func TestMutation_TooMany_ShouldFailThosePastTheLimit(t *testing.T) {
+	// Arrange
+	expenses := &stubExpenses{}
+	e := newTestServer(nil, expenses)
+	q := "mutation {"
+	for i := 0; i <= maxMutations; i++ {
+		q += fmt.Sprintf(` c%d: createExpense(input: {title: "apple", amount: 10}) { id }`, i)
+	}
+	q += " }"
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesWrite, "", q)
+
+	// Assert
+	assert.Len(t, expenses.created, maxMutations)
+	if assert.Len(t, r.Errors, 1) {
+		assert.Equal(t, "too many mutations, expected at most 5", r.Errors[0].Message)
+	}
+}
+
+func TestMutation_ShouldCountAgainstTheWriteRateLimit(t *testing.T) {
+	// Arrange
+	expenses := &stubExpenses{}
+	e := newTestServer(nil, expenses, ratelimit.Middleware(ratelimit.NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 60},
+		Routes:  map[string]config.Limit{"POST /expenses": {Requests: 2, Per: time.Minute, Burst: 2}},
+	}, ratelimit.ClientKey))
+
+	// Act
+	r := query(t, e, auth.ScopeExpensesWrite, "", `mutation {
+		a: createExpense(input: {title: "apple", amount: 10}) { id }
+		b: createExpense(input: {title: "apple", amount: 10}) { id }
+		c: createExpense(input: {title: "apple", amount: 10}) { id }
+	}`)
+
+	// Assert
+	assert.Len(t, expenses.created, 2)
+	if assert.Len(t, r.Errors, 1) {
+		assert.Equal(t, "Rate limit exceeded", r.Errors[0].Message)
+		assert.Equal(t, float64(http.StatusTooManyRequests), r.Errors[0].Extensions["status"])
+	}
+}
@@ -0,0 +1,112 @@
+package graphqlapi
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/lib/pq"
+)
+
+// version is a row of expense_versions.
+type version struct {
+	Version   int
+	Title     string
+	Amount    float64
+	Note      string
+	Tags      []string
+	ValidFrom time.Time
+	ValidTo   *time.Time
+}
+
+// historyLoader loads the history of the expenses a request resolves in one
+// query instead of one per expense. Resolvers returning expenses prime it
+// with their ids, and the first history field loads every primed id; the
+// others are then served from its cache.
+type historyLoader struct {
+	mu      sync.Mutex
+	load    func(ctx context.Context, ids []int) (map[int][]version, error)
+	pending []int
+	loaded  map[int][]version
+}
+
+func newHistoryLoader(load func(ctx context.Context, ids []int) (map[int][]version, error)) *historyLoader {
+	return &historyLoader{load: load, loaded: map[int][]version{}}
+}
+
+type loaderKey struct{}
+
+func withHistoryLoader(ctx context.Context, l *historyLoader) context.Context {
+	return context.WithValue(ctx, loaderKey{}, l)
+}
+
+func historyLoaderFrom(ctx context.Context) *historyLoader {
+	return ctx.Value(loaderKey{}).(*historyLoader)
+}
+
+// prime queues ids to be loaded with the next one Load misses.
+func (l *historyLoader) prime(ids ...int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.pending = append(l.pending, ids...)
+}
+
+// Load returns the versions of expense id, oldest first.
+func (l *historyLoader) Load(ctx context.Context, id int) ([]version, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if versions, ok := l.loaded[id]; ok {
+		return versions, nil
+	}
+
+	ids := []int{id}
+	for _, pending := range l.pending {
+		if _, ok := l.loaded[pending]; !ok && pending != id {
+			ids = append(ids, pending)
+		}
+	}
+	l.pending = nil
+	versions, err := l.load(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		l.loaded[id] = versions[id]
+	}
+	return l.loaded[id], nil
+}
+
+// loadHistory reads the versions of every expense of ids in the ledger of
+// the request.
+func (h *handler) loadHistory(ctx context.Context, ids []int) (map[int][]version, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT v.expense_id, v.version, v.title, v.amount, v.note, v.tags, v.valid_from, v.valid_to
+	FROM expense_versions v
+		JOIN expenses e ON e.id = v.expense_id
+	WHERE v.expense_id = ANY($1) AND e.ledger_id IS NOT DISTINCT FROM $2
+	ORDER BY v.expense_id, v.version
+	`, pq.Array(ids), ledger.IdArg(ctx))
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	defer rows.Close()
+
+	versions := map[int][]version{}
+	for rows.Next() {
+		var id int
+		var v version
+		err := rows.Scan(&id, &v.Version, &v.Title, &v.Amount, &v.Note, pq.Array(&v.Tags), &v.ValidFrom, &v.ValidTo)
+		if err != nil {
+			return nil, database.HTTPError(ctx, err, "")
+		}
+		versions[id] = append(versions[id], v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	return versions, nil
+}
@@ -0,0 +1,327 @@
+package graphqlapi
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/brown-kaew/assessment/database"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/graph-gophers/graphql-go"
+	"github.com/lib/pq"
+)
+
+const maxFirst = 1000
+
+type resolver struct {
+	h *handler
+}
+
+func parseId(id graphql.ID) (int, error) {
+	n, err := strconv.Atoi(string(id))
+	if err != nil || n < 1 {
+		return 0, apiError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid id %q, expected an expense Id", id)}
+	}
+	return n, nil
+}
+
+func (r *resolver) Expense(ctx context.Context, args struct {
+	ID   graphql.ID
+	AsOf *graphql.Time
+}) (*expenseResolver, error) {
+	if err := countRootField(ctx, otherField); err != nil {
+		return nil, err
+	}
+	id, err := parseId(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	var e *expense.Expense
+	if args.AsOf != nil {
+		e, err = r.h.expenses.GetExpenseByIdAsOf(ctx, id, args.AsOf.Time)
+	} else {
+		e, err = r.h.expenses.GetExpenseById(ctx, id)
+	}
+	if err != nil {
+		err = resolverError(err)
+		if err.(apiError).status == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	historyLoaderFrom(ctx).prime(id)
+	return &expenseResolver{*e}, nil
+}
+
+type filterInput struct {
+	Tag           *string
+	TitleContains *string
+	MinAmount     *float64
+	MaxAmount     *float64
+}
+
+func (r *resolver) Expenses(ctx context.Context, args struct {
+	Filter *filterInput
+	First  int32
+	After  *graphql.ID
+}) (*connectionResolver, error) {
+	if err := countRootField(ctx, listField); err != nil {
+		return nil, err
+	}
+	if args.First < 1 || args.First > maxFirst {
+		return nil, apiError{status: http.StatusBadRequest, message: fmt.Sprintf("invalid first, expected 1 to %d", maxFirst)}
+	}
+	after := 0
+	if args.After != nil {
+		var err error
+		if after, err = parseId(*args.After); err != nil {
+			return nil, err
+		}
+	}
+	var filter filterInput
+	if args.Filter != nil {
+		filter = *args.Filter
+	}
+
+	// One more than first tells whether there is a next page.
+	expenses, err := r.h.findExpenses(ctx, filter, after, int(args.First)+1)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	conn := &connectionResolver{}
+	if len(expenses) > int(args.First) {
+		expenses = expenses[:args.First]
+		conn.hasNextPage = true
+	}
+	ids := make([]int, len(expenses))
+	for i, e := range expenses {
+		ids[i] = e.Id
+		conn.nodes = append(conn.nodes, &expenseResolver{e})
+	}
+	historyLoaderFrom(ctx).prime(ids...)
+	return conn, nil
+}
+
+func (h *handler) findExpenses(ctx context.Context, filter filterInput, after int, limit int) ([]expense.Expense, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT id, title, amount, note, tags
+	FROM expenses
+	WHERE ledger_id IS NOT DISTINCT FROM $1 AND id > $2
+		AND ($3::TEXT IS NULL OR $3 = ANY(tags))
+		AND ($4::TEXT IS NULL OR strpos(lower(title), lower($4)) > 0)
+		AND ($5::FLOAT IS NULL OR amount >= $5)
+		AND ($6::FLOAT IS NULL OR amount <= $6)
+	ORDER BY id
+	LIMIT $7
+	`, ledger.IdArg(ctx), after, nullString(filter.Tag), nullString(filter.TitleContains),
+		nullFloat(filter.MinAmount), nullFloat(filter.MaxAmount), limit)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	defer rows.Close()
+
+	var expenses []expense.Expense
+	for rows.Next() {
+		var e expense.Expense
+		if err := rows.Scan(&e.Id, &e.Title, &e.Amount, &e.Note, pq.Array(&e.Tags)); err != nil {
+			return nil, database.HTTPError(ctx, err, "")
+		}
+		expenses = append(expenses, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "")
+	}
+	return expenses, nil
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *s, Valid: true}
+}
+
+func nullFloat(f *float64) sql.NullFloat64 {
+	if f == nil {
+		return sql.NullFloat64{}
+	}
+	return sql.NullFloat64{Float64: *f, Valid: true}
+}
+
+func (r *resolver) Tags(ctx context.Context) ([]*tagResolver, error) {
+	if err := countRootField(ctx, listField); err != nil {
+		return nil, err
+	}
+	ctx, cancel := database.WithTimeout(ctx, r.h.queryTimeout)
+	defer cancel()
+	rows, err := r.h.db.QueryContext(ctx, `
+	SELECT tag, COUNT(*), SUM(amount)
+	FROM expenses, unnest(tags) AS tag
+	WHERE ledger_id IS NOT DISTINCT FROM $1
+	GROUP BY tag
+	ORDER BY tag
+	`, ledger.IdArg(ctx))
+	if err != nil {
+		return nil, resolverError(database.HTTPError(ctx, err, ""))
+	}
+	defer rows.Close()
+
+	tags := []*tagResolver{}
+	for rows.Next() {
+		var t tagResolver
+		if err := rows.Scan(&t.tag, &t.count, &t.total); err != nil {
+			return nil, resolverError(database.HTTPError(ctx, err, ""))
+		}
+		tags = append(tags, &t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, resolverError(database.HTTPError(ctx, err, ""))
+	}
+	return tags, nil
+}
+
+type expenseInput struct {
+	Title  string
+	Amount float64
+	Note   *string
+	Tags   *[]string
+}
+
+func (in expenseInput) expense(id int) expense.Expense {
+	e := expense.Expense{Id: id, Title: in.Title, Amount: in.Amount}
+	if in.Note != nil {
+		e.Note = *in.Note
+	}
+	if in.Tags != nil {
+		e.Tags = *in.Tags
+	}
+	return e
+}
+
+func (r *resolver) CreateExpense(ctx context.Context, args struct{ Input expenseInput }) (*expenseResolver, error) {
+	if err := requireWrite(ctx); err != nil {
+		return nil, err
+	}
+	if err := countMutation(ctx, "POST /expenses"); err != nil {
+		return nil, err
+	}
+	e := args.Input.expense(0)
+	if err := r.h.expenses.CreateNewExpense(ctx, &e); err != nil {
+		return nil, resolverError(err)
+	}
+	return &expenseResolver{e}, nil
+}
+
+// UpdateExpense replaces the expense with id by input, like PUT
+// /expenses/:id.
+func (r *resolver) UpdateExpense(ctx context.Context, args struct {
+	ID    graphql.ID
+	Input expenseInput
+}) (*expenseResolver, error) {
+	if err := requireWrite(ctx); err != nil {
+		return nil, err
+	}
+	if err := countMutation(ctx, "PUT /expenses/:id"); err != nil {
+		return nil, err
+	}
+	id, err := parseId(args.ID)
+	if err != nil {
+		return nil, err
+	}
+	e := args.Input.expense(id)
+	if err := r.h.expenses.UpdateExpenseById(ctx, &e); err != nil {
+		return nil, resolverError(err)
+	}
+	return &expenseResolver{e}, nil
+}
+
+type expenseResolver struct {
+	e expense.Expense
+}
+
+func (r *expenseResolver) ID() graphql.ID  { return graphql.ID(strconv.Itoa(r.e.Id)) }
+func (r *expenseResolver) Title() string   { return r.e.Title }
+func (r *expenseResolver) Amount() float64 { return r.e.Amount }
+func (r *expenseResolver) Note() string    { return r.e.Note }
+func (r *expenseResolver) Tags() []string  { return nonNil(r.e.Tags) }
+
+func (r *expenseResolver) History(ctx context.Context) ([]*versionResolver, error) {
+	versions, err := historyLoaderFrom(ctx).Load(ctx, r.e.Id)
+	if err != nil {
+		return nil, resolverError(err)
+	}
+	resolvers := []*versionResolver{}
+	for _, v := range versions {
+		resolvers = append(resolvers, &versionResolver{v})
+	}
+	return resolvers, nil
+}
+
+type versionResolver struct {
+	v version
+}
+
+func (r *versionResolver) Version() int32          { return int32(r.v.Version) }
+func (r *versionResolver) Title() string           { return r.v.Title }
+func (r *versionResolver) Amount() float64         { return r.v.Amount }
+func (r *versionResolver) Note() string            { return r.v.Note }
+func (r *versionResolver) Tags() []string          { return nonNil(r.v.Tags) }
+func (r *versionResolver) ValidFrom() graphql.Time { return graphql.Time{Time: r.v.ValidFrom} }
+
+func (r *versionResolver) ValidTo() *graphql.Time {
+	if r.v.ValidTo == nil {
+		return nil
+	}
+	return &graphql.Time{Time: *r.v.ValidTo}
+}
+
+type connectionResolver struct {
+	nodes       []*expenseResolver
+	hasNextPage bool
+}
+
+func (r *connectionResolver) Nodes() []*expenseResolver {
+	if r.nodes == nil {
+		return []*expenseResolver{}
+	}
+	return r.nodes
+}
+
+func (r *connectionResolver) PageInfo() *pageInfoResolver {
+	info := &pageInfoResolver{hasNextPage: r.hasNextPage}
+	if len(r.nodes) > 0 {
+		cursor := r.nodes[len(r.nodes)-1].ID()
+		info.endCursor = &cursor
+	}
+	return info
+}
+
+type pageInfoResolver struct {
+	endCursor   *graphql.ID
+	hasNextPage bool
+}
+
+func (r *pageInfoResolver) EndCursor() *graphql.ID { return r.endCursor }
+func (r *pageInfoResolver) HasNextPage() bool      { return r.hasNextPage }
+
+type tagResolver struct {
+	tag   string
+	count int32
+	total float64
+}
+
+func (r *tagResolver) Tag() string    { return r.tag }
+func (r *tagResolver) Count() int32   { return r.count }
+func (r *tagResolver) Total() float64 { return r.total }
+
+func nonNil(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
@@ -0,0 +1,262 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.4.0
+// - protoc             (unknown)
+// source: expense/v1/expense.proto
+
+package expensev1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.62.0 or later.
+const _ = grpc.SupportPackageIsVersion8
+
+const (
+	ExpenseService_CreateExpense_FullMethodName = "/expense.v1.ExpenseService/CreateExpense"
+	ExpenseService_GetExpense_FullMethodName    = "/expense.v1.ExpenseService/GetExpense"
+	ExpenseService_UpdateExpense_FullMethodName = "/expense.v1.ExpenseService/UpdateExpense"
+	ExpenseService_ListExpenses_FullMethodName  = "/expense.v1.ExpenseService/ListExpenses"
+)
+
+// ExpenseServiceClient is the client API for ExpenseService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ExpenseService is the gRPC counterpart of the /expenses routes. It is
+// served on the same port, behind the same credentials: the authorization
+// metadata takes an API key, and x-ledger-id selects a shared ledger.
+type ExpenseServiceClient interface {
+	CreateExpense(ctx context.Context, in *CreateExpenseRequest, opts ...grpc.CallOption) (*CreateExpenseResponse, error)
+	GetExpense(ctx context.Context, in *GetExpenseRequest, opts ...grpc.CallOption) (*GetExpenseResponse, error)
+	UpdateExpense(ctx context.Context, in *UpdateExpenseRequest, opts ...grpc.CallOption) (*UpdateExpenseResponse, error)
+	// ListExpenses streams every expense in id order, one per response.
+	ListExpenses(ctx context.Context, in *ListExpensesRequest, opts ...grpc.CallOption) (ExpenseService_ListExpensesClient, error)
+}
+
+type expenseServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewExpenseServiceClient(cc grpc.ClientConnInterface) ExpenseServiceClient {
+	return &expenseServiceClient{cc}
+}
+
+func (c *expenseServiceClient) CreateExpense(ctx context.Context, in *CreateExpenseRequest, opts ...grpc.CallOption) (*CreateExpenseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateExpenseResponse)
+	err := c.cc.Invoke(ctx, ExpenseService_CreateExpense_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *expenseServiceClient) GetExpense(ctx context.Context, in *GetExpenseRequest, opts ...grpc.CallOption) (*GetExpenseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetExpenseResponse)
+	err := c.cc.Invoke(ctx, ExpenseService_GetExpense_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *expenseServiceClient) UpdateExpense(ctx context.Context, in *UpdateExpenseRequest, opts ...grpc.CallOption) (*UpdateExpenseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UpdateExpenseResponse)
+	err := c.cc.Invoke(ctx, ExpenseService_UpdateExpense_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *expenseServiceClient) ListExpenses(ctx context.Context, in *ListExpensesRequest, opts ...grpc.CallOption) (ExpenseService_ListExpensesClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ExpenseService_ServiceDesc.Streams[0], ExpenseService_ListExpenses_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &expenseServiceListExpensesClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ExpenseService_ListExpensesClient interface {
+	Recv() (*ListExpensesResponse, error)
+	grpc.ClientStream
+}
+
+type expenseServiceListExpensesClient struct {
+	grpc.ClientStream
+}
+
+func (x *expenseServiceListExpensesClient) Recv() (*ListExpensesResponse, error) {
+	m := new(ListExpensesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ExpenseServiceServer is the server API for ExpenseService service.
+// All implementations must embed UnimplementedExpenseServiceServer
+// for forward compatibility
+//
+// ExpenseService is the gRPC counterpart of the /expenses routes. It is
+// served on the same port, behind the same credentials: the authorization
+// metadata takes an API key, and x-ledger-id selects a shared ledger.
+type ExpenseServiceServer interface {
+	CreateExpense(context.Context, *CreateExpenseRequest) (*CreateExpenseResponse, error)
+	GetExpense(context.Context, *GetExpenseRequest) (*GetExpenseResponse, error)
+	UpdateExpense(context.Context, *UpdateExpenseRequest) (*UpdateExpenseResponse, error)
+	// ListExpenses streams every expense in id order, one per response.
+	ListExpenses(*ListExpensesRequest, ExpenseService_ListExpensesServer) error
+	mustEmbedUnimplementedExpenseServiceServer()
+}
+
+// UnimplementedExpenseServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedExpenseServiceServer struct {
+}
+
+func (UnimplementedExpenseServiceServer) CreateExpense(context.Context, *CreateExpenseRequest) (*CreateExpenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateExpense not implemented")
+}
+func (UnimplementedExpenseServiceServer) GetExpense(context.Context, *GetExpenseRequest) (*GetExpenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetExpense not implemented")
+}
+func (UnimplementedExpenseServiceServer) UpdateExpense(context.Context, *UpdateExpenseRequest) (*UpdateExpenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateExpense not implemented")
+}
+func (UnimplementedExpenseServiceServer) ListExpenses(*ListExpensesRequest, ExpenseService_ListExpensesServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListExpenses not implemented")
+}
+func (UnimplementedExpenseServiceServer) mustEmbedUnimplementedExpenseServiceServer() {}
+
+// UnsafeExpenseServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ExpenseServiceServer will
+// result in compilation errors.
+type UnsafeExpenseServiceServer interface {
+	mustEmbedUnimplementedExpenseServiceServer()
+}
+
+func RegisterExpenseServiceServer(s grpc.ServiceRegistrar, srv ExpenseServiceServer) {
+	s.RegisterService(&ExpenseService_ServiceDesc, srv)
+}
+
+func _ExpenseService_CreateExpense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateExpenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExpenseServiceServer).CreateExpense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExpenseService_CreateExpense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExpenseServiceServer).CreateExpense(ctx, req.(*CreateExpenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExpenseService_GetExpense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetExpenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExpenseServiceServer).GetExpense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExpenseService_GetExpense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExpenseServiceServer).GetExpense(ctx, req.(*GetExpenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExpenseService_UpdateExpense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateExpenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ExpenseServiceServer).UpdateExpense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ExpenseService_UpdateExpense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ExpenseServiceServer).UpdateExpense(ctx, req.(*UpdateExpenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ExpenseService_ListExpenses_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListExpensesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ExpenseServiceServer).ListExpenses(m, &expenseServiceListExpensesServer{ServerStream: stream})
+}
+
+type ExpenseService_ListExpensesServer interface {
+	Send(*ListExpensesResponse) error
+	grpc.ServerStream
+}
+
+type expenseServiceListExpensesServer struct {
+	grpc.ServerStream
+}
+
+func (x *expenseServiceListExpensesServer) Send(m *ListExpensesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// ExpenseService_ServiceDesc is the grpc.ServiceDesc for ExpenseService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ExpenseService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "expense.v1.ExpenseService",
+	HandlerType: (*ExpenseServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateExpense",
+			Handler:    _ExpenseService_CreateExpense_Handler,
+		},
+		{
+			MethodName: "GetExpense",
+			Handler:    _ExpenseService_GetExpense_Handler,
+		},
+		{
+			MethodName: "UpdateExpense",
+			Handler:    _ExpenseService_UpdateExpense_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListExpenses",
+			Handler:       _ExpenseService_ListExpenses_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "expense/v1/expense.proto",
+}
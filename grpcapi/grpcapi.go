@@ -0,0 +1,225 @@
+// Package grpcapi serves the expense operations over gRPC, on the same port
+// and behind the same middleware as the REST routes.
+package grpcapi
+
+//go:generate sh -c "cd ../proto && buf generate"
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/grpcapi/expensev1"
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listPageSize is how many expenses ListExpenses reads per query.
+const listPageSize = 100
+
+type server struct {
+	expensev1.UnimplementedExpenseServiceServer
+	expenses expense.Handler
+}
+
+// NewHandler registers every ExpenseService method on g as a POST route, the
+// way gRPC calls arrive over HTTP/2, so they are authenticated, checked
+// against the caller's ledger role, rate limited and logged like any other
+// route. The server must accept HTTP/2, with TLS or h2c.
+func NewHandler(expenses expense.Handler, g *echo.Group) {
+	s := grpc.NewServer()
+	expensev1.RegisterExpenseServiceServer(s, &server{expenses: expenses})
+	handler := echo.WrapHandler(s)
+	for _, path := range Paths() {
+		g.POST(path, handler)
+	}
+}
+
+// Paths returns the route of every ExpenseService method.
+func Paths() []string {
+	desc := expensev1.ExpenseService_ServiceDesc
+	var paths []string
+	for _, method := range desc.Methods {
+		paths = append(paths, "/"+desc.ServiceName+"/"+method.MethodName)
+	}
+	for _, stream := range desc.Streams {
+		paths = append(paths, "/"+desc.ServiceName+"/"+stream.StreamName)
+	}
+	return paths
+}
+
+// RESTRoutes maps the route of each ExpenseService method to the REST route
+// doing the same work, for ratelimit.WithAliases.
+func RESTRoutes() map[string]string {
+	service := "POST /" + expensev1.ExpenseService_ServiceDesc.ServiceName + "/"
+	return map[string]string{
+		service + "CreateExpense": "POST /expenses",
+		service + "GetExpense":    "GET /expenses/:id",
+		service + "UpdateExpense": "PUT /expenses/:id",
+		service + "ListExpenses":  "GET /expenses",
+	}
+}
+
+func (s *server) CreateExpense(ctx context.Context, req *expensev1.CreateExpenseRequest) (*expensev1.CreateExpenseResponse, error) {
+	if req.Expense == nil {
+		return nil, status.Error(codes.InvalidArgument, "expense is required")
+	}
+	e := fromProto(req.Expense)
+	e.Id = 0
+	if err := s.expenses.CreateNewExpense(ctx, &e); err != nil {
+		return nil, statusError(err)
+	}
+	return &expensev1.CreateExpenseResponse{Expense: toProto(e)}, nil
+}
+
+func (s *server) GetExpense(ctx context.Context, req *expensev1.GetExpenseRequest) (*expensev1.GetExpenseResponse, error) {
+	var e *expense.Expense
+	var err error
+	if req.AsOf != nil {
+		e, err = s.expenses.GetExpenseByIdAsOf(ctx, int(req.Id), req.AsOf.AsTime())
+	} else {
+		e, err = s.expenses.GetExpenseById(ctx, int(req.Id))
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &expensev1.GetExpenseResponse{Expense: toProto(*e)}, nil
+}
+
+func (s *server) UpdateExpense(ctx context.Context, req *expensev1.UpdateExpenseRequest) (*expensev1.UpdateExpenseResponse, error) {
+	if req.Expense == nil {
+		return nil, status.Error(codes.InvalidArgument, "expense is required")
+	}
+	e := fromProto(req.Expense)
+	if err := s.expenses.UpdateExpenseById(ctx, &e); err != nil {
+		return nil, statusError(err)
+	}
+	return &expensev1.UpdateExpenseResponse{Expense: toProto(e)}, nil
+}
+
+// ListExpenses sends the expenses a page at a time, so the whole list is
+// never held in memory.
+func (s *server) ListExpenses(req *expensev1.ListExpensesRequest, stream expensev1.ExpenseService_ListExpensesServer) error {
+	ctx := stream.Context()
+	page := expense.Page{Limit: listPageSize}
+	for {
+		var expenses []expense.Expense
+		var err error
+		if req.AsOf != nil {
+			expenses, err = s.expenses.GetAllExpensesAsOf(ctx, req.AsOf.AsTime(), page)
+		} else {
+			expenses, err = s.expenses.GetAllExpenses(ctx, page)
+		}
+		if err != nil {
+			return statusError(err)
+		}
+		for _, e := range expenses {
+			if err := stream.Send(&expensev1.ListExpensesResponse{Expense: toProto(e)}); err != nil {
+				return err
+			}
+		}
+		if len(expenses) < page.Limit {
+			return nil
+		}
+		page.After = expenses[len(expenses)-1].Id
+	}
+}
+
+func toProto(e expense.Expense) *expensev1.Expense {
+	return &expensev1.Expense{
+		Id:     int64(e.Id),
+		Title:  e.Title,
+		Amount: e.Amount,
+		Note:   e.Note,
+		Tags:   e.Tags,
+	}
+}
+
+func fromProto(e *expensev1.Expense) expense.Expense {
+	return expense.Expense{
+		Id:     int(e.Id),
+		Title:  e.Title,
+		Amount: e.Amount,
+		Note:   e.Note,
+		Tags:   e.Tags,
+	}
+}
+
+// Middleware answers gRPC calls refused by the middleware after it, like
+// auth.Middleware, with a gRPC status instead of a JSON body, which gRPC
+// clients can't read. Errors of the methods are already statuses.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			err := next(c)
+			req := c.Request()
+			if err == nil || c.Response().Committed || req.ProtoMajor != 2 ||
+				!strings.HasPrefix(req.Header.Get(echo.HeaderContentType), "application/grpc") {
+				return err
+			}
+			st := status.Convert(statusError(err))
+			header := c.Response().Header()
+			header.Set(echo.HeaderContentType, "application/grpc")
+			header.Set("Grpc-Status", strconv.Itoa(int(st.Code())))
+			header.Set("Grpc-Message", encodeMessage(st.Message()))
+			c.Response().WriteHeader(http.StatusOK)
+			return nil
+		}
+	}
+}
+
+// encodeMessage percent-encodes message for the grpc-message header, as
+// the gRPC protocol requires.
+func encodeMessage(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// statusCodes maps the statuses of the expense handler and middleware to
+// gRPC codes.
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+	http.StatusInternalServerError: codes.Internal,
+}
+
+// statusError converts an error of the expense handler or middleware, an
+// echo.HTTPError for the ones meant for callers, to a gRPC status.
+func statusError(err error) error {
+	var he *echo.HTTPError
+	if !errors.As(err, &he) {
+		if ctxErr := status.FromContextError(err); ctxErr.Code() != codes.Unknown {
+			return ctxErr.Err()
+		}
+		return status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+	}
+	code, ok := statusCodes[he.Code]
+	if !ok {
+		code = codes.Unknown
+	}
+	message := fmt.Sprint(he.Message)
+	if message == "" {
+		message = http.StatusText(he.Code)
+	}
+	return status.Error(code, message)
+}
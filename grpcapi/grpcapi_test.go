@@ -0,0 +1,425 @@
+//go:build unit
+
+package grpcapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/grpcapi/expensev1"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/ratelimit"
+	"github.com/brown-kaew/assessment/tlsserver"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeExpenses keeps expenses in memory, recording the ledger and as-of
+// time they were asked for.
+type fakeExpenses struct {
+	mu       sync.Mutex
+	expenses map[int]expense.Expense
+	ledgers  []int
+	asOf     time.Time
+	pages    []expense.Page
+}
+
+func (f *fakeExpenses) CreateNewExpense(ctx context.Context, e *expense.Expense) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id, _, _ := ledger.FromContext(ctx)
+	f.ledgers = append(f.ledgers, id)
+	e.Id = len(f.expenses) + 1
+	f.expenses[e.Id] = *e
+	return nil
+}
+
+func (f *fakeExpenses) GetExpenseById(ctx context.Context, id int) (*expense.Expense, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	e, ok := f.expenses[id]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+	}
+	return &e, nil
+}
+
+func (f *fakeExpenses) UpdateExpenseById(ctx context.Context, e *expense.Expense) error {
+	if _, err := f.GetExpenseById(ctx, e.Id); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.expenses[e.Id] = *e
+	return nil
+}
+
+func (f *fakeExpenses) GetAllExpenses(ctx context.Context, page expense.Page) ([]expense.Expense, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pages = append(f.pages, page)
+	var ids []int
+	for id := range f.expenses {
+		if id > page.After {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	if page.Limit > 0 && len(ids) > page.Limit {
+		ids = ids[:page.Limit]
+	}
+	var expenses []expense.Expense
+	for _, id := range ids {
+		expenses = append(expenses, f.expenses[id])
+	}
+	return expenses, nil
+}
+
+func (f *fakeExpenses) GetExpenseByIdAsOf(ctx context.Context, id int, asOf time.Time) (*expense.Expense, error) {
+	f.mu.Lock()
+	f.asOf = asOf
+	f.mu.Unlock()
+	return f.GetExpenseById(ctx, id)
+}
+
+func (f *fakeExpenses) GetAllExpensesAsOf(ctx context.Context, asOf time.Time, page expense.Page) ([]expense.Expense, error) {
+	f.mu.Lock()
+	f.asOf = asOf
+	f.mu.Unlock()
+	return f.GetAllExpenses(ctx, page)
+}
+
+func (f *fakeExpenses) Prepare(ctx context.Context) error {
+	return nil
+}
+
+type stubKeys map[string]auth.Principal
+
+func (k stubKeys) AuthenticateKey(ctx context.Context, key string) (auth.Principal, error) {
+	principal, ok := k[key]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidKey
+	}
+	return principal, nil
+}
+
+// stubRoles makes every principal an owner of ledger 7, the only ledger.
+type stubRoles struct{}
+
+func (stubRoles) Role(ctx context.Context, ledgerId int, subject string) (ledger.Role, error) {
+	if ledgerId != 7 {
+		return "", ledger.ErrNotFound
+	}
+	return ledger.RoleOwner, nil
+}
+
+// newTestClient serves fake behind the middleware of the server, over h2c
+// on an in-memory listener, and returns a client of it.
+func newTestClient(t *testing.T, fake *fakeExpenses) expensev1.ExpenseServiceClient {
+	e := echo.New()
+	g := e.Group("")
+	g.Use(Middleware())
+	g.Use(auth.Middleware(stubKeys{
+		"reader": {Subject: "api-key:1", Scopes: []string{auth.ScopeExpensesRead}},
+		"writer": {Subject: "api-key:2", Scopes: []string{auth.ScopeExpensesRead, auth.ScopeExpensesWrite}},
+	}))
+	g.Use(ledger.Middleware(stubRoles{}))
+	NewHandler(fake, g)
+
+	listener := bufconn.Listen(1 << 20)
+	server := &http.Server{Handler: h2c.NewHandler(e, &http2.Server{})}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return expensev1.NewExpenseServiceClient(conn)
+}
+
+func withCredentials(key string, pairs ...string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), append([]string{"authorization", "ApiKey " + key}, pairs...)...)
+}
+
+func newFake(n int) *fakeExpenses {
+	fake := &fakeExpenses{expenses: map[int]expense.Expense{}}
+	for id := 1; id <= n; id++ {
+		fake.expenses[id] = expense.Expense{Id: id, Title: "apple", Amount: float64(id)}
+	}
+	return fake
+}
+
+func TestCreateGetUpdate_ShouldShareTheExpenseHandler(t *testing.T) {
+	// Arrange
+	fake := newFake(0)
+	c := newTestClient(t, fake)
+	ctx := withCredentials("writer", "x-ledger-id", "7")
+
+	// Act
+	created, createErr := c.CreateExpense(ctx, &expensev1.CreateExpenseRequest{Expense: &expensev1.Expense{
+		Title: "strawberry smoothie", Amount: 79, Tags: []string{"food", "beverage"},
+	}})
+	updated, updateErr := c.UpdateExpense(ctx, &expensev1.UpdateExpenseRequest{Expense: &expensev1.Expense{
+		Id: 1, Title: "strawberry smoothie", Amount: 89,
+	}})
+	got, getErr := c.GetExpense(ctx, &expensev1.GetExpenseRequest{Id: 1})
+
+	// Assert
+	assert.NoError(t, createErr)
+	assert.NoError(t, updateErr)
+	assert.NoError(t, getErr)
+	assert.Equal(t, int64(1), created.Expense.Id)
+	assert.Equal(t, []string{"food", "beverage"}, created.Expense.Tags)
+	assert.Equal(t, 89.0, updated.Expense.Amount)
+	assert.Equal(t, 89.0, got.Expense.Amount)
+	assert.Equal(t, []int{7}, fake.ledgers)
+}
+
+func TestGetExpense_AsOf_ShouldGetVersion(t *testing.T) {
+	// Arrange
+	fake := newFake(1)
+	c := newTestClient(t, fake)
+	asOf := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Act
+	_, err := c.GetExpense(withCredentials("reader"), &expensev1.GetExpenseRequest{Id: 1, AsOf: timestamppb.New(asOf)})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, asOf, fake.asOf)
+}
+
+func TestListExpenses_ShouldStreamEveryPage(t *testing.T) {
+	// Arrange
+	fake := newFake(250)
+	c := newTestClient(t, fake)
+
+	// Act
+	stream, err := c.ListExpenses(withCredentials("reader"), &expensev1.ListExpensesRequest{})
+	var ids []int64
+	for err == nil {
+		var resp *expensev1.ListExpensesResponse
+		if resp, err = stream.Recv(); err == nil {
+			ids = append(ids, resp.Expense.Id)
+		}
+	}
+
+	// Assert
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Len(t, ids, 250)
+	assert.IsIncreasing(t, ids)
+	assert.Equal(t, []expense.Page{{After: 0, Limit: 100}, {After: 100, Limit: 100}, {After: 200, Limit: 100}}, fake.pages)
+}
+
+func TestErrors_ShouldBeGRPCStatuses(t *testing.T) {
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		call    func(ctx context.Context, c expensev1.ExpenseServiceClient) error
+		code    codes.Code
+		message string
+	}{
+		{"expense not found", withCredentials("reader"), func(ctx context.Context, c expensev1.ExpenseServiceClient) error {
+			_, err := c.GetExpense(ctx, &expensev1.GetExpenseRequest{Id: 9})
+			return err
+		}, codes.NotFound, "Expense not found"},
+		{"missing expense", withCredentials("writer"), func(ctx context.Context, c expensev1.ExpenseServiceClient) error {
+			_, err := c.CreateExpense(ctx, &expensev1.CreateExpenseRequest{})
+			return err
+		}, codes.InvalidArgument, "expense is required"},
+		{"no credentials", context.Background(), func(ctx context.Context, c expensev1.ExpenseServiceClient) error {
+			_, err := c.GetExpense(ctx, &expensev1.GetExpenseRequest{Id: 1})
+			return err
+		}, codes.Unauthenticated, "Unauthorized"},
+		{"read key can't create", withCredentials("reader"), func(ctx context.Context, c expensev1.ExpenseServiceClient) error {
+			_, err := c.CreateExpense(ctx, &expensev1.CreateExpenseRequest{Expense: &expensev1.Expense{Title: "apple"}})
+			return err
+		}, codes.PermissionDenied, "Missing scope expenses:write"},
+		{"unknown ledger", withCredentials("reader", "x-ledger-id", "8"), func(ctx context.Context, c expensev1.ExpenseServiceClient) error {
+			stream, err := c.ListExpenses(ctx, &expensev1.ListExpensesRequest{})
+			if err != nil {
+				return err
+			}
+			_, err = stream.Recv()
+			return err
+		}, codes.NotFound, "Ledger not found"},
+	}
+	c := newTestClient(t, newFake(1))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := tt.call(tt.ctx, c)
+
+			// Assert
+			st, _ := status.FromError(err)
+			assert.Equal(t, tt.code, st.Code())
+			assert.Equal(t, tt.message, st.Message())
+		})
+	}
+}
+
+func TestStatusError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code codes.Code
+	}{
+		{"gateway timeout", echo.NewHTTPError(http.StatusGatewayTimeout, "Query timed out"), codes.DeadlineExceeded},
+		{"unmapped status", echo.NewHTTPError(http.StatusTeapot), codes.Unknown},
+		{"cancelled", context.Canceled, codes.Canceled},
+		{"other error", errors.New("connection refused"), codes.Internal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			st := status.Convert(statusError(tt.err))
+
+			// Assert
+			assert.Equal(t, tt.code, st.Code())
+		})
+	}
+}
+
+func TestEncodeMessage(t *testing.T) {
+	assert.Equal(t, "Role viewer can't write: 100%25 sure%0A", encodeMessage("Role viewer can't write: 100% sure\n"))
+}
+
+// writeSelfSigned writes a certificate for 127.0.0.1 and its key to dir, and
+// returns a pool trusting it.
+func writeSelfSigned(t *testing.T, dir string) (config.TLSConfig, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ReloadInterval: time.Second,
+	}
+	for name, block := range map[string]*pem.Block{
+		conf.CertFile: {Type: "CERTIFICATE", Bytes: der},
+		conf.KeyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDer},
+	} {
+		if err := os.WriteFile(name, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	return conf, roots
+}
+
+func TestCreateExpense_OverTLS_ShouldShareTheRESTWriteLimit(t *testing.T) {
+	// Arrange
+	tlsConf, roots := writeSelfSigned(t, t.TempDir())
+	certs, err := tlsserver.Load(tlsConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	g := e.Group("")
+	g.Use(Middleware())
+	g.Use(auth.Middleware(stubKeys{"writer": {Subject: "api-key:2", Scopes: []string{auth.ScopeExpensesWrite}}}))
+	g.Use(ratelimit.Middleware(ratelimit.NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 60},
+		Routes:  map[string]config.Limit{"POST /expenses": {Requests: 1, Per: time.Minute, Burst: 1}},
+	}, ratelimit.ClientKey, ratelimit.WithAliases(RESTRoutes())))
+	NewHandler(newFake(0), g)
+	e.TLSServer.Addr = "127.0.0.1:0"
+	e.TLSServer.TLSConfig = certs.Config()
+	go e.StartServer(e.TLSServer)
+	defer e.Close()
+	for deadline := time.Now().Add(5 * time.Second); e.TLSListenerAddr() == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e.TLSListenerAddr() == nil {
+		t.Fatal("the server didn't start listening")
+	}
+	conn, err := grpc.NewClient(e.TLSListenerAddr().String(),
+		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := expensev1.NewExpenseServiceClient(conn)
+	req := &expensev1.CreateExpenseRequest{Expense: &expensev1.Expense{Title: "apple", Amount: 10}}
+
+	// Act
+	_, created := c.CreateExpense(withCredentials("writer"), req)
+	_, limited := c.CreateExpense(withCredentials("writer"), req)
+
+	// Assert
+	assert.NoError(t, created)
+	st, _ := status.FromError(limited)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+}
+
+func TestRESTRoutes_ShouldMapEveryMethod(t *testing.T) {
+	// Act
+	routes := RESTRoutes()
+
+	// Assert
+	assert.Len(t, routes, len(Paths()))
+	for _, path := range Paths() {
+		assert.Contains(t, routes, "POST "+path)
+	}
+}
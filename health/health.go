@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/brown-kaew/assessment/migration"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusReady    = "ready"
+	StatusNotReady = "not ready"
+)
+
+const errDatabaseUnavailable = "database unavailable"
+
+type Readiness struct {
+	Status       string          `json:"status"`
+	ShuttingDown bool            `json:"shutting_down"`
+	Database     DatabaseCheck   `json:"database"`
+	Migrations   MigrationsCheck `json:"migrations"`
+	Pool         PoolCheck       `json:"pool"`
+}
+
+type DatabaseCheck struct {
+	Status    string `json:"status"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type MigrationsCheck struct {
+	Status  string `json:"status"`
+	Current int    `json:"current"`
+	Latest  int    `json:"latest"`
+	Pending []int  `json:"pending"`
+	Error   string `json:"error,omitempty"`
+}
+
+// PoolCheck reports connection pool usage. Saturation is the share of the
+// maximum open connections in use, or 0 when the pool is unbounded.
+type PoolCheck struct {
+	Open         int     `json:"open"`
+	InUse        int     `json:"in_use"`
+	Idle         int     `json:"idle"`
+	MaxOpen      int     `json:"max_open"`
+	WaitCount    int64   `json:"wait_count"`
+	WaitDuration string  `json:"wait_duration"`
+	Saturation   float64 `json:"saturation"`
+}
+
+type Handler struct {
+	db           *sql.DB
+	timeout      time.Duration
+	shuttingDown atomic.Bool
+}
+
+// NewHandler registers /livez and /readyz on e. They sit outside the
+// authenticated group so orchestrators can probe them.
+func NewHandler(db *sql.DB, e *echo.Echo, timeout time.Duration) *Handler {
+	handler := &Handler{
+		db:      db,
+		timeout: timeout,
+	}
+	e.GET("/livez", handler.livenessHandler())
+	e.GET("/readyz", handler.readinessHandler())
+	return handler
+}
+
+// ShuttingDown makes readiness fail from now on, so load balancers stop
+// routing new requests while in-flight ones drain.
+func (h *Handler) ShuttingDown() {
+	h.shuttingDown.Store(true)
+}
+
+func (h *Handler) livenessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": StatusUp})
+	}
+}
+
+func (h *Handler) readinessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		readiness := h.Check(c.Request().Context())
+		if readiness.Status != StatusReady {
+			return c.JSON(http.StatusServiceUnavailable, readiness)
+		}
+		return c.JSON(http.StatusOK, readiness)
+	}
+}
+
+// Check pings the database and reads the migration status within the
+// configured timeout. Errors are logged; the response only says that the
+// database is unavailable, since /readyz is unauthenticated.
+func (h *Handler) Check(ctx context.Context) Readiness {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	readiness := Readiness{Status: StatusReady}
+
+	start := time.Now()
+	err := h.db.PingContext(ctx)
+	readiness.Database = DatabaseCheck{Status: StatusUp, LatencyMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		readiness.Database.Status = StatusDown
+		readiness.Database.Error = errDatabaseUnavailable
+		logging.FromContext(ctx).Error("can't ping database", "error", err)
+	}
+
+	readiness.Migrations = MigrationsCheck{Status: StatusDown, Pending: []int{}}
+	if err == nil {
+		status, err := migration.CurrentStatus(ctx, h.db)
+		if err != nil {
+			readiness.Migrations.Error = errDatabaseUnavailable
+			logging.FromContext(ctx).Error("can't read migration status", "error", err)
+		} else {
+			readiness.Migrations.Current = status.Current
+			readiness.Migrations.Latest = status.Latest
+			readiness.Migrations.Pending = status.Pending
+			if status.UpToDate() {
+				readiness.Migrations.Status = StatusUp
+			}
+		}
+	}
+
+	stats := h.db.Stats()
+	readiness.Pool = PoolCheck{
+		Open:         stats.OpenConnections,
+		InUse:        stats.InUse,
+		Idle:         stats.Idle,
+		MaxOpen:      stats.MaxOpenConnections,
+		WaitCount:    stats.WaitCount,
+		WaitDuration: stats.WaitDuration.String(),
+	}
+	if stats.MaxOpenConnections > 0 {
+		readiness.Pool.Saturation = float64(stats.InUse) / float64(stats.MaxOpenConnections)
+	}
+
+	readiness.ShuttingDown = h.shuttingDown.Load()
+	if readiness.ShuttingDown || readiness.Database.Status != StatusUp || readiness.Migrations.Status != StatusUp {
+		readiness.Status = StatusNotReady
+	}
+	return readiness
+}
@@ -0,0 +1,163 @@
+//go:build unit
+
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/migration"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUp(t *testing.T) (*echo.Echo, *Handler, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	e := echo.New()
+	handler := NewHandler(db, e, time.Second)
+	return e, handler, mock, func() { db.Close() }
+}
+
+func expectMigrations(mock sqlmock.Sqlmock, versions ...int) {
+	mock.ExpectQuery("SELECT to_regclass").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	rows := sqlmock.NewRows([]string{"version"})
+	for _, v := range versions {
+		rows.AddRow(v)
+	}
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(rows)
+}
+
+func allVersions(t *testing.T) []int {
+	migrations, err := migration.All()
+	assert.NoError(t, err)
+	var versions []int
+	for _, m := range migrations {
+		versions = append(versions, m.Version)
+	}
+	return versions
+}
+
+func getReadiness(t *testing.T, e *echo.Echo) (int, Readiness) {
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var readiness Readiness
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &readiness))
+	return rec.Code, readiness
+}
+
+func TestLivez(t *testing.T) {
+	e, _, _, teardown := setUp(t)
+	defer teardown()
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/livez", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"up"}`, rec.Body.String())
+}
+
+func TestReadyz_ShouldBeReady(t *testing.T) {
+	e, _, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	versions := allVersions(t)
+	mock.ExpectPing()
+	expectMigrations(mock, versions...)
+
+	// Act
+	code, readiness := getReadiness(t, e)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, StatusReady, readiness.Status)
+	assert.Equal(t, StatusUp, readiness.Database.Status)
+	assert.Equal(t, StatusUp, readiness.Migrations.Status)
+	assert.Equal(t, versions[len(versions)-1], readiness.Migrations.Current)
+	assert.Equal(t, versions[len(versions)-1], readiness.Migrations.Latest)
+	assert.Empty(t, readiness.Migrations.Pending)
+}
+
+func TestReadyz_DatabaseDown_ShouldNotBeReady(t *testing.T) {
+	e, _, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	// Act
+	code, readiness := getReadiness(t, e)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusNotReady, readiness.Status)
+	assert.Equal(t, StatusDown, readiness.Database.Status)
+	assert.Equal(t, "database unavailable", readiness.Database.Error)
+	assert.Equal(t, StatusDown, readiness.Migrations.Status)
+}
+
+func TestReadyz_MigrationStatusError_ShouldNotLeakIt(t *testing.T) {
+	e, _, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	mock.ExpectPing()
+	mock.ExpectQuery("SELECT to_regclass").WillReturnError(errors.New(`permission denied for relation "schema_migrations"`))
+
+	// Act
+	code, readiness := getReadiness(t, e)
+
+	// Assert
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, readiness.Migrations.Status)
+	assert.Equal(t, "database unavailable", readiness.Migrations.Error)
+}
+
+func TestReadyz_PendingMigrations_ShouldNotBeReady(t *testing.T) {
+	e, _, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	versions := allVersions(t)
+	mock.ExpectPing()
+	expectMigrations(mock, versions[:2]...)
+
+	// Act
+	code, readiness := getReadiness(t, e)
+
+	// Assert
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusDown, readiness.Migrations.Status)
+	assert.Equal(t, 2, readiness.Migrations.Current)
+	assert.Equal(t, versions[2:], readiness.Migrations.Pending)
+}
+
+func TestReadyz_ShuttingDown_ShouldNotBeReady(t *testing.T) {
+	e, handler, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	mock.ExpectPing()
+	expectMigrations(mock, allVersions(t)...)
+	handler.ShuttingDown()
+
+	// Act
+	code, readiness := getReadiness(t, e)
+
+	// Assert
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, StatusNotReady, readiness.Status)
+	assert.True(t, readiness.ShuttingDown)
+	assert.Equal(t, StatusUp, readiness.Database.Status)
+}
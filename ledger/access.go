@@ -0,0 +1,155 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/labstack/echo/v4"
+)
+
+// ErrNotFound is returned by a RoleFinder for ledgers that don't exist.
+var ErrNotFound = errors.New("ledger not found")
+
+// routeActions is what every route needs to be allowed to do in the ledger
+// it works in. Routes missing here are refused with a ledger selected, so a
+// new route can't skip the check by accident.
+var routeActions = map[string]Action{
+	"GET /expenses":        ActionRead,
+	"GET /expenses/:id":    ActionRead,
+	"GET /expenses/stream": ActionRead,
+	"POST /expenses":       ActionWrite,
+	"PUT /expenses/:id":    ActionWrite,
+
+	"POST /expense.v1.ExpenseService/CreateExpense": ActionWrite,
+	"POST /expense.v1.ExpenseService/GetExpense":    ActionRead,
+	"POST /expense.v1.ExpenseService/UpdateExpense": ActionWrite,
+	"POST /expense.v1.ExpenseService/ListExpenses":  ActionRead,
+	// Mutations check for ActionWrite themselves.
+	"POST /graphql": ActionRead,
+
+	"GET /ledgers/:id/members":             ActionRead,
+	"PUT /ledgers/:id/members/:subject":    ActionManage,
+	"DELETE /ledgers/:id/members/:subject": ActionManage,
+	"GET /ledgers/:id/invitations":         ActionManage,
+	"POST /ledgers/:id/invitations":        ActionManage,
+
+	"POST /ledgers":                   ActionNone,
+	"GET /ledgers":                    ActionNone,
+	"POST /invitations/:token/accept": ActionNone,
+	"POST /webhooks":                  ActionNone,
+	"GET /webhooks":                   ActionNone,
+	"DELETE /webhooks/:id":            ActionNone,
+	"POST /api-keys":                  ActionNone,
+	"GET /api-keys":                   ActionNone,
+	"DELETE /api-keys/:id":            ActionNone,
+}
+
+// RequiredAction returns the action the route of method and path needs, and
+// false for routes the table doesn't cover.
+func RequiredAction(method string, path string) (Action, bool) {
+	action, ok := routeActions[method+" "+path]
+	return action, ok
+}
+
+// RoleFinder looks up the role of subject in a ledger.
+type RoleFinder interface {
+	// Role returns ErrNotFound if the ledger doesn't exist, and an empty
+	// role if subject is not a member.
+	Role(ctx context.Context, ledgerId int, subject string) (Role, error)
+}
+
+// Memberships finds roles in the ledger_members table.
+type Memberships struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewMemberships(db *sql.DB, conf config.Config) *Memberships {
+	return &Memberships{
+		db:           db,
+		queryTimeout: conf.QueryTimeout,
+	}
+}
+
+func (m *Memberships) Role(ctx context.Context, ledgerId int, subject string) (Role, error) {
+	ctx, cancel := database.WithTimeout(ctx, m.queryTimeout)
+	defer cancel()
+	row := m.db.QueryRowContext(ctx, `
+	SELECT COALESCE(m.role, '')
+	FROM ledgers l
+		LEFT JOIN ledger_members m ON m.ledger_id = l.id AND m.subject = $2
+	WHERE l.id = $1
+	`, ledgerId, subject)
+
+	var role Role
+	err := row.Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", database.HTTPError(ctx, err, "Cannot check ledger membership")
+	}
+	return role, nil
+}
+
+// Middleware resolves the ledger a request works in, from the :id of
+// /ledgers/:id routes or the X-Ledger-Id header elsewhere, and refuses
+// requests whose principal's role there doesn't allow the route. Admins act
+// as owners of every ledger. Ledgers the principal isn't a member of are
+// reported as not found so their ids don't leak. It must run after
+// auth.Middleware.
+func Middleware(roles RoleFinder) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			action, covered := RequiredAction(c.Request().Method, c.Path())
+			if covered && action == ActionNone {
+				return next(c)
+			}
+
+			value := c.Request().Header.Get(HeaderLedgerId)
+			if strings.HasPrefix(c.Path(), "/ledgers/:id/") {
+				value = c.Param("id")
+			}
+			if value == "" {
+				return next(c)
+			}
+			if !covered {
+				return echo.NewHTTPError(http.StatusForbidden, "Route is not available in a ledger")
+			}
+			id, err := strconv.Atoi(value)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid ledger Id")
+			}
+
+			ctx := c.Request().Context()
+			principal, _ := auth.FromContext(ctx)
+			role, err := roles.Role(ctx, id, principal.Subject)
+			if err == ErrNotFound {
+				return echo.NewHTTPError(http.StatusNotFound, "Ledger not found")
+			}
+			if err != nil {
+				return err
+			}
+			if principal.HasScope(auth.ScopeAdmin) {
+				role = RoleOwner
+			}
+			if role == "" {
+				return echo.NewHTTPError(http.StatusNotFound, "Ledger not found")
+			}
+			if !role.Allows(action) {
+				return echo.NewHTTPError(http.StatusForbidden, "Role "+string(role)+" can't "+string(action)+" in this ledger")
+			}
+
+			c.SetRequest(c.Request().WithContext(WithLedger(ctx, id, role)))
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+//go:build unit
+
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubRoles knows a single ledger, 1, and the role of each of its members.
+type stubRoles map[string]Role
+
+func (r stubRoles) Role(ctx context.Context, ledgerId int, subject string) (Role, error) {
+	if ledgerId == 500 {
+		return "", errors.New("connection refused")
+	}
+	if ledgerId != 1 {
+		return "", ErrNotFound
+	}
+	return r[subject], nil
+}
+
+func newTestServer() *echo.Echo {
+	e := echo.New()
+	withPrincipal := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := auth.Principal{Subject: c.Request().Header.Get("X-Subject")}
+			if principal.Subject == "admin" {
+				principal.Scopes = []string{auth.ScopeAdmin}
+			}
+			c.SetRequest(c.Request().WithContext(auth.WithPrincipal(c.Request().Context(), principal)))
+			return next(c)
+		}
+	}
+	g := e.Group("", withPrincipal, Middleware(stubRoles{
+		"viewer": RoleViewer,
+		"editor": RoleEditor,
+		"owner":  RoleOwner,
+	}))
+	whichLedger := func(c echo.Context) error {
+		id, role, ok := FromContext(c.Request().Context())
+		if !ok {
+			return c.String(http.StatusOK, "no ledger")
+		}
+		return c.String(http.StatusOK, fmt.Sprintf("ledger %d as %s", id, role))
+	}
+	g.GET("/expenses", whichLedger)
+	g.POST("/expenses", whichLedger)
+	g.GET("/ledgers/:id/members", whichLedger)
+	g.POST("/ledgers/:id/invitations", whichLedger)
+	g.POST("/webhooks", whichLedger)
+	g.GET("/uncovered", whichLedger)
+	return e
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		subject string
+		ledger  string
+		code    int
+		body    string
+	}{
+		{"viewer can read", http.MethodGet, "/expenses", "viewer", "1", http.StatusOK, "ledger 1 as viewer"},
+		{"viewer can't write", http.MethodPost, "/expenses", "viewer", "1", http.StatusForbidden, "Role viewer can't write in this ledger"},
+		{"editor can write", http.MethodPost, "/expenses", "editor", "1", http.StatusOK, "ledger 1 as editor"},
+		{"editor can't invite", http.MethodPost, "/ledgers/1/invitations", "editor", "", http.StatusForbidden, "Role editor can't manage in this ledger"},
+		{"owner can invite", http.MethodPost, "/ledgers/1/invitations", "owner", "", http.StatusOK, "ledger 1 as owner"},
+		{"path wins over header", http.MethodGet, "/ledgers/2/members", "owner", "1", http.StatusNotFound, "Ledger not found"},
+		{"admin acts as owner", http.MethodPost, "/ledgers/1/invitations", "admin", "", http.StatusOK, "ledger 1 as owner"},
+		{"non member can't tell the ledger exists", http.MethodGet, "/expenses", "stranger", "1", http.StatusNotFound, "Ledger not found"},
+		{"missing ledger", http.MethodGet, "/expenses", "owner", "2", http.StatusNotFound, "Ledger not found"},
+		{"invalid ledger id", http.MethodGet, "/expenses", "owner", "one", http.StatusBadRequest, "invalid ledger Id"},
+		{"no ledger selected", http.MethodPost, "/expenses", "stranger", "", http.StatusOK, "no ledger"},
+		{"route outside ledgers ignores header", http.MethodPost, "/webhooks", "viewer", "1", http.StatusOK, "no ledger"},
+		{"uncovered route fails closed", http.MethodGet, "/uncovered", "owner", "1", http.StatusForbidden, "Route is not available in a ledger"},
+		{"store failure", http.MethodGet, "/expenses", "owner", "500", http.StatusInternalServerError, "Internal Server Error"},
+	}
+	e := newTestServer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			req.Header.Set("X-Subject", tt.subject)
+			if tt.ledger != "" {
+				req.Header.Set(HeaderLedgerId, tt.ledger)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			e.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.body)
+		})
+	}
+}
+
+// TestMiddleware_EveryRoute checks every route of routeActions for every
+// kind of member, so a route added to the table is covered without a test
+// case of its own.
+func TestMiddleware_EveryRoute(t *testing.T) {
+	e := echo.New()
+	g := e.Group("", func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := auth.Principal{Subject: c.Request().Header.Get("X-Subject")}
+			c.SetRequest(c.Request().WithContext(auth.WithPrincipal(c.Request().Context(), principal)))
+			return next(c)
+		}
+	}, Middleware(stubRoles{
+		"viewer": RoleViewer,
+		"editor": RoleEditor,
+		"owner":  RoleOwner,
+	}))
+	whichLedger := func(c echo.Context) error {
+		id, role, ok := FromContext(c.Request().Context())
+		if !ok {
+			return c.String(http.StatusOK, "no ledger")
+		}
+		return c.String(http.StatusOK, fmt.Sprintf("ledger %d as %s", id, role))
+	}
+	for route := range routeActions {
+		method, path, _ := strings.Cut(route, " ")
+		g.Add(method, path, whichLedger)
+	}
+	params := strings.NewReplacer(":id", "1", ":subject", "someone", ":token", "t0ken")
+
+	for route, action := range routeActions {
+		for _, subject := range []string{"owner", "editor", "viewer", "stranger"} {
+			role := stubRoles{"viewer": RoleViewer, "editor": RoleEditor, "owner": RoleOwner}[subject]
+			code, body := http.StatusOK, "ledger 1 as "+string(role)
+			switch {
+			case action == ActionNone:
+				body = "no ledger"
+			case role == "":
+				code, body = http.StatusNotFound, "Ledger not found"
+			case !role.Allows(action):
+				code, body = http.StatusForbidden, "can't "+string(action)+" in this ledger"
+			}
+
+			t.Run(route+" as "+subject, func(t *testing.T) {
+				// Arrange
+				method, path, _ := strings.Cut(route, " ")
+				req := httptest.NewRequest(method, params.Replace(path), nil)
+				req.Header.Set("X-Subject", subject)
+				req.Header.Set(HeaderLedgerId, "1")
+				rec := httptest.NewRecorder()
+
+				// Act
+				e.ServeHTTP(rec, req)
+
+				// Assert
+				assert.Equal(t, code, rec.Code)
+				assert.Contains(t, rec.Body.String(), body)
+			})
+		}
+	}
+}
+
+func TestRole_Allows(t *testing.T) {
+	tests := []struct {
+		role   Role
+		action Action
+		want   bool
+	}{
+		{RoleViewer, ActionRead, true},
+		{RoleViewer, ActionWrite, false},
+		{RoleViewer, ActionManage, false},
+		{RoleEditor, ActionRead, true},
+		{RoleEditor, ActionWrite, true},
+		{RoleEditor, ActionManage, false},
+		{RoleOwner, ActionRead, true},
+		{RoleOwner, ActionWrite, true},
+		{RoleOwner, ActionManage, true},
+		{"", ActionRead, false},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.role)+" "+string(tt.action), func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.role.Allows(tt.action))
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/labstack/echo/v4"
+)
+
+const invitationTTL = 7 * 24 * time.Hour
+
+type Handler interface {
+	CreateLedger(ctx context.Context, ledger *Ledger, owner string) error
+	GetLedgersOf(ctx context.Context, subject string) ([]Ledger, error)
+	GetMembers(ctx context.Context, ledgerId int) ([]Member, error)
+	UpdateMemberRole(ctx context.Context, ledgerId int, member *Member) error
+	RemoveMember(ctx context.Context, ledgerId int, subject string) error
+	CreateInvitation(ctx context.Context, invitation *Invitation, invitedBy string) error
+	GetPendingInvitations(ctx context.Context, ledgerId int) ([]Invitation, error)
+	AcceptInvitation(ctx context.Context, token string, subject string) (*Ledger, error)
+}
+
+type handler struct {
+	db           *sql.DB
+	queryTimeout time.Duration
+}
+
+func NewHandler(db *sql.DB, g *echo.Group, conf config.Config) Handler {
+	handler := &handler{
+		db:           db,
+		queryTimeout: conf.QueryTimeout,
+	}
+	handler.initRoutes(g)
+	return handler
+}
+
+func (h *handler) initRoutes(g *echo.Group) {
+	g.POST("/ledgers", h.createLedgerHandler())
+	g.GET("/ledgers", h.getLedgersHandler())
+	g.GET("/ledgers/:id/members", h.getMembersHandler())
+	g.PUT("/ledgers/:id/members/:subject", h.updateMemberHandler())
+	g.DELETE("/ledgers/:id/members/:subject", h.removeMemberHandler())
+	g.GET("/ledgers/:id/invitations", h.getInvitationsHandler())
+	g.POST("/ledgers/:id/invitations", h.createInvitationHandler())
+	g.POST("/invitations/:token/accept", h.acceptInvitationHandler())
+}
+
+// subject returns the subject of the authenticated principal.
+func subject(c echo.Context) string {
+	principal, _ := auth.FromContext(c.Request().Context())
+	return principal.Subject
+}
+
+// ledgerId returns the ledger Middleware resolved for the request.
+func ledgerId(c echo.Context) int {
+	id, _, _ := FromContext(c.Request().Context())
+	return id
+}
+
+func (h *handler) createLedgerHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var ledger Ledger
+		err := c.Bind(&ledger)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if ledger.Name == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "name is required")
+		}
+
+		err = h.CreateLedger(c.Request().Context(), &ledger, subject(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, ledger)
+	}
+}
+
+func (h *handler) getLedgersHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ledgers, err := h.GetLedgersOf(c.Request().Context(), subject(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, ledgers)
+	}
+}
+
+func (h *handler) getMembersHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		members, err := h.GetMembers(c.Request().Context(), ledgerId(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, members)
+	}
+}
+
+func (h *handler) updateMemberHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var member Member
+		err := c.Bind(&member)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if !member.Role.valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "role must be owner, editor or viewer")
+		}
+		member.Subject = c.Param("subject")
+
+		err = h.UpdateMemberRole(c.Request().Context(), ledgerId(c), &member)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, member)
+	}
+}
+
+func (h *handler) removeMemberHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := h.RemoveMember(c.Request().Context(), ledgerId(c), c.Param("subject"))
+		if err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+func (h *handler) getInvitationsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		invitations, err := h.GetPendingInvitations(c.Request().Context(), ledgerId(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, invitations)
+	}
+}
+
+func (h *handler) createInvitationHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var invitation Invitation
+		err := c.Bind(&invitation)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		if !invitation.Role.valid() {
+			return echo.NewHTTPError(http.StatusBadRequest, "role must be owner, editor or viewer")
+		}
+		invitation.LedgerId = ledgerId(c)
+
+		err = h.CreateInvitation(c.Request().Context(), &invitation, subject(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+func (h *handler) acceptInvitationHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ledger, err := h.AcceptInvitation(c.Request().Context(), c.Param("token"), subject(c))
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, ledger)
+	}
+}
+
+// CreateLedger creates a ledger with owner as its first owner.
+func (h *handler) CreateLedger(ctx context.Context, ledger *Ledger, owner string) error {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRowContext(ctx, "INSERT INTO ledgers (name) VALUES ($1) RETURNING id, created_at", ledger.Name)
+	if err := row.Scan(&ledger.Id, &ledger.CreatedAt); err != nil {
+		return database.HTTPError(ctx, err, "Cannot create ledger: "+err.Error())
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO ledger_members (ledger_id, subject, role) VALUES ($1, $2, $3)", ledger.Id, owner, RoleOwner)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot create ledger: "+err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return database.HTTPError(ctx, err, "Cannot create ledger: "+err.Error())
+	}
+	ledger.Role = RoleOwner
+	return nil
+}
+
+func (h *handler) GetLedgersOf(ctx context.Context, subject string) ([]Ledger, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT l.id, l.name, m.role, l.created_at
+	FROM ledgers l
+		JOIN ledger_members m ON m.ledger_id = l.id
+	WHERE m.subject = $1
+	ORDER BY l.id
+	`, subject)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query ledgers: "+err.Error())
+	}
+	defer rows.Close()
+
+	ledgers := []Ledger{}
+	for rows.Next() {
+		var ledger Ledger
+		if err := rows.Scan(&ledger.Id, &ledger.Name, &ledger.Role, &ledger.CreatedAt); err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan ledger: "+err.Error())
+		}
+		ledgers = append(ledgers, ledger)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query ledgers: "+err.Error())
+	}
+	return ledgers, nil
+}
+
+func (h *handler) GetMembers(ctx context.Context, ledgerId int) ([]Member, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT subject, role, created_at
+	FROM ledger_members
+	WHERE ledger_id = $1
+	ORDER BY created_at, subject
+	`, ledgerId)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query members: "+err.Error())
+	}
+	defer rows.Close()
+
+	members := []Member{}
+	for rows.Next() {
+		var member Member
+		if err := rows.Scan(&member.Subject, &member.Role, &member.CreatedAt); err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan member: "+err.Error())
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query members: "+err.Error())
+	}
+	return members, nil
+}
+
+// UpdateMemberRole changes the role of an existing member. Members are only
+// added by accepting an invitation.
+func (h *handler) UpdateMemberRole(ctx context.Context, ledgerId int, member *Member) error {
+	return h.changeMember(ctx, ledgerId, member.Subject, member.Role, func(tx *sql.Tx) error {
+		row := tx.QueryRowContext(ctx, `
+		UPDATE ledger_members
+		SET role=$3
+		WHERE ledger_id=$1 AND subject=$2
+		RETURNING created_at
+		`, ledgerId, member.Subject, member.Role)
+		return row.Scan(&member.CreatedAt)
+	})
+}
+
+func (h *handler) RemoveMember(ctx context.Context, ledgerId int, subject string) error {
+	return h.changeMember(ctx, ledgerId, subject, "", func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, "DELETE FROM ledger_members WHERE ledger_id=$1 AND subject=$2", ledgerId, subject)
+		return err
+	})
+}
+
+// changeMember runs change on a member, with the ledger locked, unless it
+// would take the last owner away; a ledger nobody can manage can't be
+// recovered. role is the member's new role, empty when removing them.
+func (h *handler) changeMember(ctx context.Context, ledgerId int, subject string, role Role, change func(tx *sql.Tx) error) error {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "SELECT id FROM ledgers WHERE id=$1 FOR UPDATE", ledgerId)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot lock ledger: "+err.Error())
+	}
+	var current Role
+	var owners int
+	err = tx.QueryRowContext(ctx, `
+	SELECT role, (SELECT count(*) FROM ledger_members WHERE ledger_id=$1 AND role='owner')
+	FROM ledger_members
+	WHERE ledger_id=$1 AND subject=$2
+	`, ledgerId, subject).Scan(&current, &owners)
+	if err == sql.ErrNoRows {
+		return echo.NewHTTPError(http.StatusNotFound, "Member not found")
+	}
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot find member: "+err.Error())
+	}
+	if current == RoleOwner && role != RoleOwner && owners == 1 {
+		return echo.NewHTTPError(http.StatusConflict, "A ledger needs at least one owner")
+	}
+
+	if err := change(tx); err != nil {
+		return database.HTTPError(ctx, err, "Cannot change member: "+err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return database.HTTPError(ctx, err, "Cannot change member: "+err.Error())
+	}
+	return nil
+}
+
+// CreateInvitation creates an invitation to join with the given role. Only
+// a hash of its token is stored, so the token is returned here and never
+// again; whoever presents it can accept the invitation once.
+func (h *handler) CreateInvitation(ctx context.Context, invitation *Invitation, invitedBy string) error {
+	token, err := newToken()
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, "Cannot generate token")
+	}
+	invitation.Token = token
+
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	row := h.db.QueryRowContext(ctx, `
+	INSERT INTO
+		ledger_invitations (ledger_id, role, token_hash, invited_by, expires_at)
+	VALUES
+		($1, $2, $3, $4, now() + $5 * interval '1 millisecond')
+	RETURNING id, created_at, expires_at
+	`, invitation.LedgerId, invitation.Role, hash(token), invitedBy, invitationTTL.Milliseconds())
+	if err := row.Scan(&invitation.Id, &invitation.CreatedAt, &invitation.ExpiresAt); err != nil {
+		return database.HTTPError(ctx, err, "Cannot create invitation: "+err.Error())
+	}
+	return nil
+}
+
+func (h *handler) GetPendingInvitations(ctx context.Context, ledgerId int) ([]Invitation, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	rows, err := h.db.QueryContext(ctx, `
+	SELECT id, ledger_id, role, created_at, expires_at
+	FROM ledger_invitations
+	WHERE ledger_id = $1 AND accepted_at IS NULL AND expires_at > now()
+	ORDER BY id
+	`, ledgerId)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query invitations: "+err.Error())
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		var invitation Invitation
+		err := rows.Scan(&invitation.Id, &invitation.LedgerId, &invitation.Role, &invitation.CreatedAt, &invitation.ExpiresAt)
+		if err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan invitation: "+err.Error())
+		}
+		invitations = append(invitations, invitation)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query invitations: "+err.Error())
+	}
+	return invitations, nil
+}
+
+// AcceptInvitation makes subject a member of the invitation's ledger. A
+// subject that is already a member keeps its role.
+func (h *handler) AcceptInvitation(ctx context.Context, token string, subject string) (*Ledger, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot begin transaction")
+	}
+	defer tx.Rollback()
+
+	var ledger Ledger
+	var role Role
+	err = tx.QueryRowContext(ctx, `
+	UPDATE ledger_invitations
+	SET accepted_by=$2, accepted_at=now()
+	WHERE token_hash=$1 AND accepted_at IS NULL AND expires_at > now()
+	RETURNING ledger_id, role
+	`, hash(token), subject).Scan(&ledger.Id, &role)
+	if err == sql.ErrNoRows {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Invitation not found or expired")
+	}
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot accept invitation: "+err.Error())
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO
+		ledger_members (ledger_id, subject, role)
+	VALUES
+		($1, $2, $3)
+	ON CONFLICT (ledger_id, subject) DO NOTHING
+	`, ledger.Id, subject, role)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot accept invitation: "+err.Error())
+	}
+	err = tx.QueryRowContext(ctx, `
+	SELECT l.name, m.role, l.created_at
+	FROM ledgers l
+		JOIN ledger_members m ON m.ledger_id = l.id
+	WHERE l.id = $1 AND m.subject = $2
+	`, ledger.Id, subject).Scan(&ledger.Name, &ledger.Role, &ledger.CreatedAt)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot accept invitation: "+err.Error())
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot accept invitation: "+err.Error())
+	}
+	return &ledger, nil
+}
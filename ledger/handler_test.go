@@ -0,0 +1,174 @@
+//go:build unit
+
+package ledger
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	return db, mock, func() { db.Close() }
+}
+
+func TestCreateLedger_ShouldMakeCreatorOwner(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO ledgers").WithArgs("household").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+	mock.ExpectExec("INSERT INTO ledger_members").WithArgs(1, "api-key:1", RoleOwner).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+	l := &Ledger{Name: "household"}
+
+	// Act
+	err := handler.CreateLedger(context.Background(), l, "api-key:1")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, &Ledger{Id: 1, Name: "household", Role: RoleOwner, CreatedAt: createdAt}, l)
+}
+
+func TestRemoveMember_LastOwner_ShouldGetConflict(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT id FROM ledgers .* FOR UPDATE").WithArgs(1).WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery("SELECT role, (.+) FROM ledger_members").WithArgs(1, "api-key:1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "count"}).AddRow(RoleOwner, 1))
+	mock.ExpectRollback()
+
+	// Act
+	err := handler.RemoveMember(context.Background(), 1, "api-key:1")
+
+	// Assert
+	assert.Equal(t, echo.NewHTTPError(409, "A ledger needs at least one owner"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateMemberRole_OtherOwnerLeft_ShouldDemote(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectExec("SELECT id FROM ledgers .* FOR UPDATE").WithArgs(1).WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery("SELECT role, (.+) FROM ledger_members").WithArgs(1, "api-key:1").
+		WillReturnRows(sqlmock.NewRows([]string{"role", "count"}).AddRow(RoleOwner, 2))
+	mock.ExpectQuery("UPDATE ledger_members").WithArgs(1, "api-key:1", RoleViewer).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at"}).AddRow(createdAt))
+	mock.ExpectCommit()
+	m := &Member{Subject: "api-key:1", Role: RoleViewer}
+
+	// Act
+	err := handler.UpdateMemberRole(context.Background(), 1, m)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, createdAt, m.CreatedAt)
+}
+
+func TestCreateInvitation_ShouldOnlyStoreTokenHash(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	expiresAt := createdAt.Add(invitationTTL)
+	var stored string
+	mock.ExpectQuery("INSERT INTO ledger_invitations").
+		WithArgs(1, RoleEditor, capture(&stored), "api-key:1", invitationTTL.Milliseconds()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at", "expires_at"}).AddRow(3, createdAt, expiresAt))
+	i := &Invitation{LedgerId: 1, Role: RoleEditor}
+
+	// Act
+	err := handler.CreateInvitation(context.Background(), i, "api-key:1")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 3, i.Id)
+	assert.Regexp(t, "^inv_[0-9a-f]+$", i.Token)
+	assert.Equal(t, hash(i.Token), stored)
+	assert.Equal(t, expiresAt, i.ExpiresAt)
+}
+
+func TestAcceptInvitation_ShouldJoinLedger(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE ledger_invitations").WithArgs(hash("inv_abc"), "api-key:2").
+		WillReturnRows(sqlmock.NewRows([]string{"ledger_id", "role"}).AddRow(1, RoleEditor))
+	mock.ExpectExec("INSERT INTO ledger_members").WithArgs(1, "api-key:2", RoleEditor).
+		WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectQuery("SELECT l.name, m.role, l.created_at").WithArgs(1, "api-key:2").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "role", "created_at"}).AddRow("household", RoleEditor, createdAt))
+	mock.ExpectCommit()
+
+	// Act
+	l, err := handler.AcceptInvitation(context.Background(), "inv_abc", "api-key:2")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, &Ledger{Id: 1, Name: "household", Role: RoleEditor, CreatedAt: createdAt}, l)
+}
+
+func TestAcceptInvitation_UsedOrExpired_ShouldGetNotFound(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE ledger_invitations").WithArgs(hash("inv_abc"), "api-key:2").
+		WillReturnRows(sqlmock.NewRows([]string{"ledger_id", "role"}))
+	mock.ExpectRollback()
+
+	// Act
+	_, err := handler.AcceptInvitation(context.Background(), "inv_abc", "api-key:2")
+
+	// Assert
+	assert.Equal(t, echo.NewHTTPError(404, "Invitation not found or expired"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+// capture is an argument matcher that accepts any string and keeps it.
+type captureArg struct{ s *string }
+
+func capture(s *string) captureArg { return captureArg{s} }
+
+func (c captureArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	*c.s = s
+	return ok
+}
@@ -0,0 +1,111 @@
+package ledger
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"time"
+)
+
+// HeaderLedgerId selects the ledger an expense request works in. Without it
+// requests work on the expenses that belong to no ledger.
+const HeaderLedgerId = "X-Ledger-Id"
+
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+type Action string
+
+const (
+	// ActionNone marks routes that don't work in a ledger.
+	ActionNone   Action = ""
+	ActionRead   Action = "read"
+	ActionWrite  Action = "write"
+	ActionManage Action = "manage"
+)
+
+// Allows reports whether members with role may perform action: viewers
+// read, editors also write, and owners also manage members and invitations.
+func (r Role) Allows(action Action) bool {
+	switch action {
+	case ActionRead:
+		return r == RoleViewer || r == RoleEditor || r == RoleOwner
+	case ActionWrite:
+		return r == RoleEditor || r == RoleOwner
+	case ActionManage:
+		return r == RoleOwner
+	}
+	return false
+}
+
+func (r Role) valid() bool {
+	return r == RoleOwner || r == RoleEditor || r == RoleViewer
+}
+
+type Ledger struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Role      Role      `json:"role,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Member struct {
+	Subject   string    `json:"subject"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Invitation struct {
+	Id        int       `json:"id"`
+	LedgerId  int       `json:"ledger_id"`
+	Role      Role      `json:"role"`
+	Token     string    `json:"token,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type contextKey struct{}
+
+type access struct {
+	ledgerId int
+	role     Role
+}
+
+// WithLedger returns a copy of ctx working in ledger id as role.
+func WithLedger(ctx context.Context, id int, role Role) context.Context {
+	return context.WithValue(ctx, contextKey{}, access{ledgerId: id, role: role})
+}
+
+// FromContext returns the ledger the request ctx belongs to works in.
+func FromContext(ctx context.Context) (id int, role Role, ok bool) {
+	a, ok := ctx.Value(contextKey{}).(access)
+	return a.ledgerId, a.role, ok
+}
+
+// IdArg returns the ledger of ctx as a query argument, NULL when the
+// request works outside of ledgers. Compare it with IS NOT DISTINCT FROM so
+// NULL matches expenses without a ledger.
+func IdArg(ctx context.Context) sql.NullInt64 {
+	id, _, ok := FromContext(ctx)
+	return sql.NullInt64{Int64: int64(id), Valid: ok}
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "inv_" + hex.EncodeToString(b), nil
+}
+
+func hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,39 @@
+//go:build unit
+
+package ledger_test
+
+import (
+	"testing"
+
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/graphqlapi"
+	"github.com/brown-kaew/assessment/grpcapi"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/webhook"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequiredAction_ShouldCoverEveryRoute(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	g := e.Group("")
+	conf := config.Config{}
+	expenses := expense.NewHandler(nil, g, conf)
+	grpcapi.NewHandler(expenses, g)
+	graphqlapi.NewHandler(nil, expenses, g, conf)
+	expense.NewStreamHandler(nil, nil, g, conf)
+	webhook.NewHandler(nil, g, conf)
+	apikey.NewHandler(nil, g, conf)
+	ledger.NewHandler(nil, g, conf)
+
+	for _, route := range e.Routes() {
+		// Act
+		_, ok := ledger.RequiredAction(route.Method, route.Path)
+
+		// Assert
+		assert.True(t, ok, "%s %s has no ledger action", route.Method, route.Path)
+	}
+}
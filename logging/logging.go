@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// New returns a logger writing to stdout in the format and at the level set
+// in conf. Unknown values fall back to JSON at info level.
+func New(conf config.Config) *slog.Logger {
+	return newLogger(os.Stdout, conf)
+}
+
+func newLogger(w io.Writer, conf config.Config) *slog.Logger {
+	opts := &slog.HandlerOptions{Level: parseLevel(conf.LogLevel)}
+	if strings.EqualFold(conf.LogFormat, "text") {
+		return slog.New(slog.NewTextHandler(w, opts))
+	}
+	return slog.New(slog.NewJSONHandler(w, opts))
+}
+
+func parseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// WithLogger returns a copy of ctx carrying logger.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the request scoped logger in ctx, or the default logger
+// when there is none.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Middleware stores a logger tagged with the request id, and the trace id when
+// the request is traced, in the request context and logs every request once it
+// completes. It must run after middleware.RequestID.
+func Middleware(logger *slog.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+			requestLogger := logger.With("request_id", c.Response().Header().Get(echo.HeaderXRequestID))
+			if span := trace.SpanContextFromContext(req.Context()); span.IsValid() {
+				requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+			}
+			c.SetRequest(req.WithContext(WithLogger(req.Context(), requestLogger)))
+
+			err := next(c)
+			if err != nil {
+				// Let echo write the error response so the logged status is final.
+				c.Error(err)
+			}
+
+			status := c.Response().Status
+			attrs := []slog.Attr{
+				slog.String("method", req.Method),
+				slog.String("uri", req.RequestURI),
+				slog.String("route", c.Path()),
+				slog.Int("status", status),
+				slog.Int64("latency_ms", time.Since(start).Milliseconds()),
+				slog.String("remote_ip", c.RealIP()),
+				slog.Int64("bytes_out", c.Response().Size),
+			}
+			if err != nil {
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+
+			level := slog.LevelInfo
+			switch {
+			case status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			}
+			requestLogger.LogAttrs(c.Request().Context(), level, "request", attrs...)
+			return nil
+		}
+	}
+}
+
+// RecoverLogger logs panics caught by middleware.Recover.
+func RecoverLogger(c echo.Context, err error, stack []byte) error {
+	FromContext(c.Request().Context()).Error("panic recovered", "error", err.Error(), "stack", string(stack))
+	return err
+}
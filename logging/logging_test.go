@@ -0,0 +1,62 @@
+//go:build unit
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_ShouldLogRequestWithRequestId(t *testing.T) {
+	// Arrange
+	var out bytes.Buffer
+	logger := newLogger(&out, config.Config{LogLevel: "debug", LogFormat: "json"})
+	e := echo.New()
+	e.Use(middleware.RequestID())
+	e.Use(Middleware(logger))
+	e.GET("/expenses/:id", func(c echo.Context) error {
+		FromContext(c.Request().Context()).Debug("db query")
+		return echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/expenses/1", nil)
+	req.Header.Set(echo.HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	if assert.Len(t, lines, 2) {
+		var query, request map[string]interface{}
+		assert.NoError(t, json.Unmarshal(lines[0], &query))
+		assert.NoError(t, json.Unmarshal(lines[1], &request))
+		assert.Equal(t, "db query", query["msg"])
+		assert.Equal(t, "req-1", query["request_id"])
+		assert.Equal(t, "request", request["msg"])
+		assert.Equal(t, "WARN", request["level"])
+		assert.Equal(t, "req-1", request["request_id"])
+		assert.Equal(t, "/expenses/:id", request["route"])
+		assert.Equal(t, float64(http.StatusNotFound), request["status"])
+	}
+}
+
+func TestNew_ShouldFallBackToInfo(t *testing.T) {
+	var out bytes.Buffer
+	logger := newLogger(&out, config.Config{LogLevel: "loud", LogFormat: "text"})
+
+	logger.Debug("hidden")
+	logger.Info("shown")
+
+	assert.NotContains(t, out.String(), "hidden")
+	assert.Contains(t, out.String(), "msg=shown")
+}
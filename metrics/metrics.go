@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "expenses"
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	expensesCreated = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "created_total",
+		Help:      "Number of expenses created.",
+	})
+
+	amountByTag = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "amount_created_total",
+		Help:      "Sum of the amount of created expenses by tag, other for tags that aren't tracked.",
+	}, []string{"tag"})
+
+	// trackedTags are the tags amountByTag has a series for. Tags are free
+	// text, so labelling every one would grow the series without bound.
+	trackedTags atomic.Pointer[map[string]bool]
+)
+
+// OtherTag is the tag label amounts of untracked tags are added to.
+const OtherTag = "other"
+
+// TrackTags sets the tags the created amount is broken down by; amounts of
+// any other tag are added to OtherTag.
+func TrackTags(tags []string) {
+	tracked := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tracked[tag] = true
+	}
+	trackedTags.Store(&tracked)
+}
+
+// NewRegistry returns a registry with the HTTP and business metrics, the
+// connection pool stats of db and the usual Go runtime and process metrics.
+func NewRegistry(db *sql.DB) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		collectors.NewDBStatsCollector(db, "expenses"),
+		httpRequests,
+		httpDuration,
+		expensesCreated,
+		amountByTag,
+	)
+	return registry
+}
+
+// NewServer returns a server exposing registry at /metrics on addr, kept apart
+// from the API port so it can stay private to the cluster.
+func NewServer(addr string, registry *prometheus.Registry) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry}))
+	return &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// Middleware records the count and latency of requests per route. Errors are
+// not written to the response yet when it runs, so their status is taken from
+// the error itself.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			status := c.Response().Status
+			if err != nil {
+				status = http.StatusInternalServerError
+				if he, ok := err.(*echo.HTTPError); ok {
+					status = he.Code
+				}
+			}
+			method := c.Request().Method
+			route := c.Path()
+			httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+			httpDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// ExpenseCreated records a committed expense. Its amount is added once to
+// OtherTag however many untracked tags it has.
+func ExpenseCreated(amount float64, tags []string) {
+	expensesCreated.Inc()
+	var tracked map[string]bool
+	if t := trackedTags.Load(); t != nil {
+		tracked = *t
+	}
+	other := false
+	for _, tag := range tags {
+		if tracked[tag] {
+			amountByTag.WithLabelValues(tag).Add(amount)
+		} else {
+			other = true
+		}
+	}
+	if other {
+		amountByTag.WithLabelValues(OtherTag).Add(amount)
+	}
+}
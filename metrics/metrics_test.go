@@ -0,0 +1,98 @@
+//go:build unit
+
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_ShouldCountRequestsPerRoute(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	g := e.Group("")
+	g.Use(Middleware())
+	g.GET("/expenses/:id", func(c echo.Context) error {
+		if c.Param("id") == "999" {
+			return echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+		}
+		return c.JSON(http.StatusOK, "OK")
+	})
+	found := httpRequests.WithLabelValues(http.MethodGet, "/expenses/:id", "200")
+	notFound := httpRequests.WithLabelValues(http.MethodGet, "/expenses/:id", "404")
+	foundBefore, notFoundBefore := testutil.ToFloat64(found), testutil.ToFloat64(notFound)
+
+	// Act
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/expenses/1", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/expenses/2", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/expenses/999", nil))
+
+	// Assert
+	assert.Equal(t, foundBefore+2, testutil.ToFloat64(found))
+	assert.Equal(t, notFoundBefore+1, testutil.ToFloat64(notFound))
+}
+
+func TestExpenseCreated_ShouldAddAmountPerTag(t *testing.T) {
+	// Arrange
+	TrackTags([]string{"food", "beverage"})
+	createdBefore := testutil.ToFloat64(expensesCreated)
+	foodBefore := testutil.ToFloat64(amountByTag.WithLabelValues("food"))
+	beverageBefore := testutil.ToFloat64(amountByTag.WithLabelValues("beverage"))
+
+	// Act
+	ExpenseCreated(79, []string{"food", "beverage"})
+	ExpenseCreated(5, []string{"food"})
+
+	// Assert
+	assert.Equal(t, createdBefore+2, testutil.ToFloat64(expensesCreated))
+	assert.Equal(t, foodBefore+84, testutil.ToFloat64(amountByTag.WithLabelValues("food")))
+	assert.Equal(t, beverageBefore+79, testutil.ToFloat64(amountByTag.WithLabelValues("beverage")))
+}
+
+func TestExpenseCreated_UntrackedTags_ShouldAddToOtherOnce(t *testing.T) {
+	// Arrange
+	TrackTags([]string{"food"})
+	foodBefore := testutil.ToFloat64(amountByTag.WithLabelValues("food"))
+	otherBefore := testutil.ToFloat64(amountByTag.WithLabelValues(OtherTag))
+	series := testutil.CollectAndCount(amountByTag)
+
+	// Act
+	ExpenseCreated(100, []string{"food", "gift for mum", "xmas 2026"})
+
+	// Assert
+	assert.Equal(t, foodBefore+100, testutil.ToFloat64(amountByTag.WithLabelValues("food")))
+	assert.Equal(t, otherBefore+100, testutil.ToFloat64(amountByTag.WithLabelValues(OtherTag)))
+	assert.Equal(t, series, testutil.CollectAndCount(amountByTag))
+}
+
+func TestServer_ShouldExposeMetrics(t *testing.T) {
+	db, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	server := httptest.NewServer(NewServer(":0", NewRegistry(db)).Handler)
+	defer server.Close()
+	ExpenseCreated(1, nil)
+
+	// Act
+	resp, err := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	// Assert
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "go_sql_open_connections{db_name=\"expenses\"}")
+	assert.Contains(t, string(body), "expenses_created_total")
+}
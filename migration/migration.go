@@ -0,0 +1,181 @@
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockId is the advisory lock held while migrating so replicas starting
+// together don't apply the same migration twice.
+const lockId = 2565
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+}
+
+type Status struct {
+	Current int   `json:"current"`
+	Latest  int   `json:"latest"`
+	Pending []int `json:"pending"`
+}
+
+// UpToDate reports whether every known migration has been applied.
+func (s Status) UpToDate() bool {
+	return len(s.Pending) == 0
+}
+
+// All returns the embedded migrations ordered by version. Files are named
+// <version>_<name>.sql.
+func All() ([]Migration, error) {
+	entries, err := fs.ReadDir(files, "sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	for _, entry := range entries {
+		version, name, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), "_")
+		v, err := strconv.Atoi(version)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("invalid migration file name %q", entry.Name())
+		}
+		up, err := files.ReadFile(path.Join("sql", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, Migration{Version: v, Name: name, Up: string(up)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Up applies every pending migration, each in its own transaction.
+func Up(ctx context.Context, db *sql.DB) error {
+	migrations, err := All()
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockId); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockId)
+
+	if err := createTable(ctx, conn); err != nil {
+		return err
+	}
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] {
+			continue
+		}
+		if err := apply(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+func apply(ctx context.Context, conn *sql.Conn, m Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, m.Up); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CurrentStatus compares the applied migrations with the embedded ones.
+func CurrentStatus(ctx context.Context, db *sql.DB) (Status, error) {
+	migrations, err := All()
+	if err != nil {
+		return Status{}, err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return Status{}, err
+	}
+	defer conn.Close()
+
+	var exists bool
+	err = conn.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil {
+		return Status{}, err
+	}
+	applied := map[int]bool{}
+	if exists {
+		if applied, err = appliedVersions(ctx, conn); err != nil {
+			return Status{}, err
+		}
+	}
+
+	status := Status{Pending: []int{}}
+	for _, m := range migrations {
+		status.Latest = m.Version
+		if applied[m.Version] {
+			status.Current = m.Version
+		} else {
+			status.Pending = append(status.Pending, m.Version)
+		}
+	}
+	return status, nil
+}
+
+func createTable(ctx context.Context, conn *sql.Conn) error {
+	_, err := conn.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	return err
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]bool{}
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
@@ -0,0 +1,55 @@
+//go:build unit
+
+package migration
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAll_ShouldBeOrderedAndContiguous(t *testing.T) {
+	migrations, err := All()
+
+	assert.NoError(t, err)
+	for i, m := range migrations {
+		assert.Equal(t, i+1, m.Version)
+		assert.NotEmpty(t, m.Name)
+		assert.NotEmpty(t, m.Up)
+	}
+}
+
+func TestUp_ShouldApplyOnlyPendingMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	migrations, err := All()
+	assert.NoError(t, err)
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(lockId).WillReturnResult(driver.ResultNoRows)
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(driver.ResultNoRows)
+	applied := sqlmock.NewRows([]string{"version"})
+	for _, m := range migrations[:len(migrations)-1] {
+		applied.AddRow(m.Version)
+	}
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(applied)
+	last := migrations[len(migrations)-1]
+	mock.ExpectBegin()
+	mock.ExpectExec(".+").WillReturnResult(driver.ResultNoRows)
+	mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(last.Version, last.Name).WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(lockId).WillReturnResult(driver.ResultNoRows)
+
+	// Act
+	err = Up(context.Background(), db)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS expense_versions (
+	expense_id INT NOT NULL REFERENCES expenses(id),
+	version INT NOT NULL,
+	title TEXT,
+	amount FLOAT,
+	note TEXT,
+	tags TEXT[],
+	valid_from TIMESTAMPTZ NOT NULL,
+	valid_to TIMESTAMPTZ,
+	PRIMARY KEY (expense_id, version)
+);
+
+INSERT INTO
+	expense_versions (expense_id, version, title, amount, note, tags, valid_from)
+SELECT
+	id, 1, title, amount, note, tags, now()
+FROM expenses e
+WHERE NOT EXISTS (SELECT 1 FROM expense_versions v WHERE v.expense_id = e.id);
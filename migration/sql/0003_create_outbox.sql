@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_type TEXT NOT NULL,
+	expense_id INT NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	dispatched_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE dispatched_at IS NULL;
+
+CREATE OR REPLACE FUNCTION notify_expense_event() RETURNS trigger AS $$
+BEGIN
+	PERFORM pg_notify('expense_events', NEW.id::text);
+	RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS outbox_notify ON outbox;
+CREATE TRIGGER outbox_notify AFTER INSERT ON outbox
+	FOR EACH ROW EXECUTE FUNCTION notify_expense_event();
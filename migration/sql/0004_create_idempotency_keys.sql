@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	request_hash TEXT NOT NULL,
+	status_code INT NOT NULL,
+	response_body BYTEA NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL
+);
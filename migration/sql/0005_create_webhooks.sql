@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS webhooks (
+	id SERIAL PRIMARY KEY,
+	url TEXT NOT NULL,
+	secret TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id BIGSERIAL PRIMARY KEY,
+	webhook_id INT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	event_id BIGINT NOT NULL REFERENCES outbox(id),
+	attempts INT NOT NULL DEFAULT 0,
+	next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_error TEXT,
+	delivered_at TIMESTAMPTZ,
+	failed_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx
+	ON webhook_deliveries (next_attempt_at) WHERE delivered_at IS NULL AND failed_at IS NULL;
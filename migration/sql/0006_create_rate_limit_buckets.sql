@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+	key TEXT PRIMARY KEY,
+	tokens DOUBLE PRECISION NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
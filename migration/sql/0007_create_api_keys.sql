@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	key_hash TEXT NOT NULL UNIQUE,
+	scopes TEXT[] NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	last_used_at TIMESTAMPTZ
+);
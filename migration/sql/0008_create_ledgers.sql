@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS ledgers (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS ledger_members (
+	ledger_id INT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+	subject TEXT NOT NULL,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	PRIMARY KEY (ledger_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS ledger_members_subject_idx ON ledger_members (subject);
+
+CREATE TABLE IF NOT EXISTS ledger_invitations (
+	id SERIAL PRIMARY KEY,
+	ledger_id INT NOT NULL REFERENCES ledgers(id) ON DELETE CASCADE,
+	role TEXT NOT NULL CHECK (role IN ('owner', 'editor', 'viewer')),
+	token_hash TEXT NOT NULL UNIQUE,
+	invited_by TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	expires_at TIMESTAMPTZ NOT NULL,
+	accepted_by TEXT,
+	accepted_at TIMESTAMPTZ
+);
+
+-- Expenses without a ledger stay where they were: visible to any client with
+-- the expenses scopes when no ledger is selected.
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS ledger_id INT REFERENCES ledgers(id);
+
+CREATE INDEX IF NOT EXISTS expenses_ledger_idx ON expenses (ledger_id);
@@ -0,0 +1,3 @@
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS txid BIGINT NOT NULL DEFAULT txid_current();
+
+CREATE INDEX IF NOT EXISTS outbox_txid_idx ON outbox (txid, id);
@@ -0,0 +1,5 @@
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS subject TEXT NOT NULL DEFAULT '';
+ALTER TABLE idempotency_keys ADD COLUMN IF NOT EXISTS ledger_id INT NOT NULL DEFAULT 0;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT IF EXISTS idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (subject, ledger_id, key);
@@ -0,0 +1,70 @@
+package openapi
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI 3 document describing every route of the API.
+func Spec() []byte {
+	return spec
+}
+
+// swaggerUIDist is the exact Swagger UI release /docs loads its assets from.
+// It is pinned, and the page's Content-Security-Policy allows scripts from
+// that release only, so a new upload to the CDN can't change the page.
+const swaggerUIDist = "https://unpkg.com/swagger-ui-dist@5.17.14/"
+
+// swaggerInit starts Swagger UI on /openapi.json.
+const swaggerInit = `
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    };
+  `
+
+// swaggerUI renders /openapi.json with Swagger UI from a CDN, so the page
+// works without bundling its assets.
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Expenses API</title>
+  <link rel="stylesheet" href="` + swaggerUIDist + `swagger-ui.css" crossorigin referrerpolicy="no-referrer">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="` + swaggerUIDist + `swagger-ui-bundle.js" crossorigin referrerpolicy="no-referrer"></script>
+  <script>` + swaggerInit + `</script>
+</body>
+</html>
+`
+
+// docsPolicy only lets /docs run the pinned Swagger UI and its own inline
+// script, and fetch from this server.
+var docsPolicy = func() string {
+	sum := sha256.Sum256([]byte(swaggerInit))
+	return "default-src 'none'; " +
+		"script-src " + swaggerUIDist + " 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src " + swaggerUIDist + " 'unsafe-inline'; " +
+		"img-src 'self' data:; " +
+		"connect-src 'self'"
+}()
+
+// NewHandler registers /openapi.json and the /docs page on e. Like the
+// health probes they sit outside the authenticated group.
+func NewHandler(e *echo.Echo) {
+	e.GET("/openapi.json", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, spec)
+	})
+	e.GET("/docs", func(c echo.Context) error {
+		c.Response().Header().Set("Content-Security-Policy", docsPolicy)
+		return c.HTML(http.StatusOK, swaggerUI)
+	})
+}
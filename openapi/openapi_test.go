@@ -0,0 +1,150 @@
+//go:build unit
+
+package openapi_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/brown-kaew/assessment/graphqlapi"
+	"github.com/brown-kaew/assessment/grpcapi"
+	"github.com/brown-kaew/assessment/health"
+	"github.com/brown-kaew/assessment/ledger"
+	"github.com/brown-kaew/assessment/openapi"
+	"github.com/brown-kaew/assessment/webhook"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func loadSpec(t *testing.T) *openapi3.T {
+	doc, err := openapi.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// newServer registers every route the server does.
+func newServer() *echo.Echo {
+	e := echo.New()
+	conf := config.Config{}
+	health.NewHandler(nil, e, time.Second)
+	openapi.NewHandler(e)
+	g := e.Group("")
+	expenses := expense.NewHandler(nil, g, conf)
+	grpcapi.NewHandler(expenses, g)
+	graphqlapi.NewHandler(nil, expenses, g, conf)
+	expense.NewStreamHandler(nil, nil, g, conf)
+	webhook.NewHandler(nil, g, conf)
+	apikey.NewHandler(nil, g, conf)
+	ledger.NewHandler(nil, g, conf)
+	return e
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func TestLoad_ShouldValidateSpec(t *testing.T) {
+	// Act
+	doc, err := openapi.Load()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+}
+
+func TestSpec_ShouldDescribeEveryRoute(t *testing.T) {
+	// Arrange
+	doc := loadSpec(t)
+	e := newServer()
+
+	grpcPaths := map[string]bool{}
+	for _, path := range grpcapi.Paths() {
+		// gRPC methods are described by proto/ instead.
+		grpcPaths[path] = true
+	}
+
+	for _, route := range e.Routes() {
+		if grpcPaths[route.Path] {
+			continue
+		}
+
+		// Act
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		item := doc.Paths.Value(path)
+
+		// Assert
+		if assert.NotNil(t, item, "%s is missing from the spec", path) {
+			assert.NotNil(t, item.GetOperation(route.Method), "%s %s is missing from the spec", route.Method, path)
+		}
+	}
+}
+
+func TestSpec_SchemasShouldMatchTypes(t *testing.T) {
+	tests := []struct {
+		schema string
+		value  any
+	}{
+		{"Expense", expense.Expense{}},
+		{"Event", expense.Event{}},
+		{"Ledger", ledger.Ledger{}},
+		{"Member", ledger.Member{}},
+		{"Invitation", ledger.Invitation{}},
+		{"Subscription", webhook.Subscription{}},
+		{"ApiKey", apikey.ApiKey{}},
+		{"Readiness", health.Readiness{}},
+	}
+	doc := loadSpec(t)
+	for _, tt := range tests {
+		t.Run(tt.schema, func(t *testing.T) {
+			// Arrange
+			var want []string
+			typ := reflect.TypeOf(tt.value)
+			for i := 0; i < typ.NumField(); i++ {
+				name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+				want = append(want, name)
+			}
+			sort.Strings(want)
+
+			// Act
+			var got []string
+			for name := range doc.Components.Schemas[tt.schema].Value.Properties {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+
+			// Assert
+			assert.Equal(t, want, got)
+		})
+	}
+}
+
+func TestNewHandler_ShouldServeSpecAndDocs(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	openapi.NewHandler(e)
+	spec := httptest.NewRecorder()
+	docs := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(spec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	e.ServeHTTP(docs, httptest.NewRequest(http.MethodGet, "/docs", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, spec.Code)
+	assert.Equal(t, echo.MIMEApplicationJSON, spec.Header().Get(echo.HeaderContentType))
+	assert.JSONEq(t, string(openapi.Spec()), spec.Body.String())
+	assert.Equal(t, http.StatusOK, docs.Code)
+	assert.Contains(t, docs.Body.String(), `url: "/openapi.json"`)
+	assert.NotContains(t, docs.Body.String(), "swagger-ui-dist@5/")
+	assert.Contains(t, docs.Header().Get("Content-Security-Policy"), "script-src https://unpkg.com/swagger-ui-dist@5.17.14/ 'sha256-")
+}
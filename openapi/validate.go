@@ -0,0 +1,210 @@
+package openapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/labstack/echo/v4"
+)
+
+// Load parses Spec and checks that it is a valid OpenAPI document.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// FieldError is one way a request, or a response, doesn't match the spec. In
+// is body, path, query or header; Field is the parameter name, or a JSON
+// pointer into the body.
+type FieldError struct {
+	In     string `json:"in"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ValidationError is the body of the 400 responses to requests that don't
+// match the spec.
+type ValidationError struct {
+	Message string       `json:"message"`
+	Errors  []FieldError `json:"errors"`
+}
+
+type Options struct {
+	// ValidateResponses buffers every response and replaces those that
+	// don't match the spec with a 500. It is meant for tests; event streams
+	// are never buffered.
+	ValidateResponses bool
+}
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// Middleware rejects requests whose parameters, query string or body don't
+// match the operation doc describes for their route, with a 400 listing every
+// mismatch. Routes doc doesn't describe are let through. Credentials are
+// checked by auth.Middleware, not here.
+func Middleware(doc *openapi3.T, opts Options) echo.MiddlewareFunc {
+	filterOptions := &openapi3filter.Options{
+		MultiError:                 true,
+		ExcludeReadOnlyValidations: true,
+		AuthenticationFunc:         openapi3filter.NoopAuthenticationFunc,
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			path := pathParam.ReplaceAllString(c.Path(), "{$1}")
+			item := doc.Paths.Value(path)
+			if item == nil {
+				return next(c)
+			}
+			operation := item.GetOperation(c.Request().Method)
+			if operation == nil {
+				return next(c)
+			}
+
+			params := map[string]string{}
+			for i, name := range c.ParamNames() {
+				params[name] = c.ParamValues()[i]
+			}
+			input := &openapi3filter.RequestValidationInput{
+				Request:    c.Request(),
+				PathParams: params,
+				Route: &routers.Route{
+					Spec:      doc,
+					Path:      path,
+					PathItem:  item,
+					Method:    c.Request().Method,
+					Operation: operation,
+				},
+				Options: filterOptions,
+			}
+			if err := openapi3filter.ValidateRequest(c.Request().Context(), input); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, ValidationError{
+					Message: "Request doesn't match the API contract",
+					Errors:  fieldErrors(err),
+				})
+			}
+
+			if !opts.ValidateResponses || streams(operation) {
+				return next(c)
+			}
+			return validateResponse(c, next, input)
+		}
+	}
+}
+
+// streams reports whether operation responds with an event stream, which
+// can't be buffered.
+func streams(operation *openapi3.Operation) bool {
+	for _, response := range operation.Responses.Map() {
+		if response.Value != nil && response.Value.Content.Get("text/event-stream") != nil {
+			return true
+		}
+	}
+	return false
+}
+
+type bufferedWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) Header() http.Header         { return w.header }
+func (w *bufferedWriter) Write(b []byte) (int, error) { return w.body.Write(b) }
+func (w *bufferedWriter) WriteHeader(status int)      { w.status = status }
+
+func validateResponse(c echo.Context, next echo.HandlerFunc, input *openapi3filter.RequestValidationInput) error {
+	original := c.Response().Writer
+	buffered := &bufferedWriter{header: original.Header(), status: http.StatusOK}
+	c.Response().Writer = buffered
+	err := next(c)
+	if err != nil {
+		// Render the error now so it is validated like any other response.
+		c.Error(err)
+	}
+	c.Response().Writer = original
+
+	responseInput := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 buffered.status,
+		Header:                 buffered.header,
+		Options:                input.Options,
+	}
+	responseInput.SetBodyBytes(buffered.body.Bytes())
+	if err := openapi3filter.ValidateResponse(c.Request().Context(), responseInput); err != nil {
+		body, _ := json.Marshal(ValidationError{
+			Message: "Response doesn't match the API contract",
+			Errors:  fieldErrors(err),
+		})
+		original.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		original.Header().Del(echo.HeaderContentLength)
+		original.WriteHeader(http.StatusInternalServerError)
+		original.Write(body)
+		c.Response().Status = http.StatusInternalServerError
+		return nil
+	}
+	original.WriteHeader(buffered.status)
+	original.Write(buffered.body.Bytes())
+	return nil
+}
+
+// fieldErrors flattens the errors of openapi3filter into one FieldError per
+// mismatch.
+func fieldErrors(err error) []FieldError {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		var errs []FieldError
+		for _, e := range err {
+			errs = append(errs, fieldErrors(e)...)
+		}
+		return errs
+	case *openapi3filter.RequestError:
+		in, field := "body", ""
+		if err.Parameter != nil {
+			in, field = err.Parameter.In, err.Parameter.Name
+		}
+		return causes(in, field, err.Reason, err.Err)
+	case *openapi3filter.ResponseError:
+		return causes("body", "", err.Reason, err.Err)
+	}
+	return []FieldError{{In: "body", Reason: err.Error()}}
+}
+
+// causes lists the schema errors in err, which fail the value of field. For
+// the body, they are located by JSON pointer instead.
+func causes(in string, field string, reason string, err error) []FieldError {
+	switch err := err.(type) {
+	case openapi3.MultiError:
+		var errs []FieldError
+		for _, e := range err {
+			errs = append(errs, causes(in, field, reason, e)...)
+		}
+		return errs
+	case *openapi3.SchemaError:
+		if in == "body" {
+			if pointer := err.JSONPointer(); len(pointer) > 0 {
+				field = "/" + strings.Join(pointer, "/")
+			}
+		}
+		return []FieldError{{In: in, Field: field, Reason: err.Reason}}
+	case nil:
+		return []FieldError{{In: in, Field: field, Reason: reason}}
+	}
+	if reason != "" {
+		reason += ": "
+	}
+	return []FieldError{{In: in, Field: field, Reason: reason + err.Error()}}
+}
@@ -0,0 +1,143 @@
+//go:build unit
+
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestServer(t *testing.T, opts Options, getExpense echo.HandlerFunc) *echo.Echo {
+	doc, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	g := e.Group("", Middleware(doc, opts))
+	echoBody := func(c echo.Context) error {
+		var body map[string]any
+		if err := c.Bind(&body); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, body)
+	}
+	g.POST("/expenses", echoBody)
+	g.PUT("/expenses/:id", echoBody)
+	g.GET("/expenses/:id", getExpense)
+	g.GET("/undocumented", func(c echo.Context) error { return c.String(http.StatusOK, "ok") })
+	return e
+}
+
+func getValidExpense(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]any{"id": 1, "title": "strawberry smoothie", "amount": 79})
+}
+
+func TestMiddleware_InvalidRequests_ShouldGetBadRequest(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		ledger string
+		body   string
+		want   FieldError
+	}{
+		{"wrong body type", http.MethodPost, "/expenses", "", `{"title":"strawberry smoothie","amount":"79 bath"}`,
+			FieldError{In: "body", Field: "/amount", Reason: "value must be a number"}},
+		{"missing property", http.MethodPost, "/expenses", "", `{"amount":79}`,
+			FieldError{In: "body", Field: "/title", Reason: `property "title" is missing`}},
+		{"wrong tag type", http.MethodPut, "/expenses/1", "", `{"title":"strawberry smoothie","amount":79,"tags":[1]}`,
+			FieldError{In: "body", Field: "/tags/0", Reason: "value must be a string"}},
+		{"invalid path parameter", http.MethodGet, "/expenses/abc", "", ``,
+			FieldError{In: "path", Field: "id", Reason: "value abc: an invalid integer: invalid syntax"}},
+		{"invalid header", http.MethodGet, "/expenses/1", "household", ``,
+			FieldError{In: "header", Field: "X-Ledger-Id", Reason: "value household: an invalid integer: invalid syntax"}},
+	}
+	e := newTestServer(t, Options{}, getValidExpense)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			if tt.ledger != "" {
+				req.Header.Set("X-Ledger-Id", tt.ledger)
+			}
+			rec := httptest.NewRecorder()
+
+			// Act
+			e.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			var got ValidationError
+			if assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got)) {
+				assert.Equal(t, "Request doesn't match the API contract", got.Message)
+				assert.Contains(t, got.Errors, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware_ValidRequest_ShouldReachHandlerWithBody(t *testing.T) {
+	// Arrange
+	e := newTestServer(t, Options{}, getValidExpense)
+	body := `{"id":7,"title":"strawberry smoothie","amount":79,"tags":["food"]}`
+	req := httptest.NewRequest(http.MethodPut, "/expenses/1", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.JSONEq(t, body, rec.Body.String())
+}
+
+func TestMiddleware_UndocumentedRoute_ShouldPass(t *testing.T) {
+	// Arrange
+	e := newTestServer(t, Options{}, getValidExpense)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/undocumented", nil))
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestMiddleware_ValidateResponses(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		code    int
+		body    string
+	}{
+		{"matching response", getValidExpense, http.StatusOK, `"title":"strawberry smoothie"`},
+		{"error response", func(c echo.Context) error {
+			return echo.NewHTTPError(http.StatusNotFound, "Expense not found")
+		}, http.StatusNotFound, `{"message":"Expense not found"}`},
+		{"mismatching response", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]any{"id": 1, "title": "strawberry smoothie", "amount": "79"})
+		}, http.StatusInternalServerError, `"Response doesn't match the API contract"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			e := newTestServer(t, Options{ValidateResponses: true}, tt.handler)
+			rec := httptest.NewRecorder()
+
+			// Act
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/expenses/1", nil))
+
+			// Assert
+			assert.Equal(t, tt.code, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.body)
+		})
+	}
+}
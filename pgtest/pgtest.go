@@ -0,0 +1,207 @@
+// Package pgtest gives each integration test a database of its own: a
+// fresh schema in the Postgres of DATABASE_URL, migrated, and dropped when
+// the test ends. Tests using it can run in parallel.
+//
+// When DATABASE_URL is unset or unreachable, pgtest falls back to a
+// Postgres of its own, started once per test binary from binaries cached in
+// ~/.embedded-postgres-go, which are downloaded the first time. Packages
+// using it stop it by running their tests with Main. When that fails too,
+// tests using pgtest fail, so a missing database can't pass as a green run;
+// set PGTEST_SKIP_WITHOUT_DB=1 to skip them instead.
+package pgtest
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/apikey"
+	"github.com/brown-kaew/assessment/app"
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/lib/pq"
+)
+
+// skipWithoutDB names the environment variable that skips, rather than
+// fails, the tests New can't give a database.
+const skipWithoutDB = "PGTEST_SKIP_WITHOUT_DB"
+
+// server is the Postgres schemas are created in, connected to once per
+// test binary.
+var server struct {
+	once sync.Once
+	conf config.Config
+	db   *sql.DB
+	err  error
+}
+
+func connect() (config.Config, *sql.DB, error) {
+	server.once.Do(func() {
+		conf, err := config.Load(nil)
+		if err == nil {
+			if server.db, err = open(conf.DatabaseUrl); err == nil {
+				server.conf = conf
+				return
+			}
+		} else {
+			conf = config.Default()
+		}
+
+		url, embeddedErr := startEmbedded()
+		if embeddedErr != nil {
+			server.err = fmt.Errorf("%w, and can't start an embedded Postgres: %v", err, embeddedErr)
+			return
+		}
+		conf.DatabaseUrl = url
+		server.conf = conf
+		server.db, server.err = open(url)
+	})
+	return server.conf, server.db, server.err
+}
+
+func open(url string) (*sql.DB, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// New creates a schema for t, migrates it and returns the configuration
+// of DATABASE_URL with its connections confined to the schema, and a
+// connection to it. Both the schema and the connection are gone when t
+// ends.
+func New(t testing.TB) (config.Config, *sql.DB) {
+	t.Helper()
+	conf, admin, err := connect()
+	if err != nil {
+		noDatabase(t, err)
+	}
+
+	schema := "test_" + randomHex(8)
+	if _, err := admin.Exec("CREATE SCHEMA " + pq.QuoteIdentifier(schema)); err != nil {
+		t.Fatalf("pgtest: can't create schema %s: %v", schema, err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec("DROP SCHEMA " + pq.QuoteIdentifier(schema) + " CASCADE"); err != nil {
+			t.Errorf("pgtest: can't drop schema %s: %v", schema, err)
+		}
+	})
+
+	conf.DatabaseUrl, err = withSearchPath(conf.DatabaseUrl, schema)
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+	db, err := expense.OpenDB(conf)
+	if err != nil {
+		t.Fatalf("pgtest: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return conf, db
+}
+
+// noDatabase ends t for want of the Postgres connect failed to reach with
+// err: it fails, unless PGTEST_SKIP_WITHOUT_DB=1 skips it.
+func noDatabase(t testing.TB, err error) {
+	t.Helper()
+	if os.Getenv(skipWithoutDB) == "1" {
+		t.Skipf("pgtest: no Postgres to test against: %v", err)
+		return
+	}
+	t.Fatalf("pgtest: no Postgres to test against, set %s=1 to skip: %v", skipWithoutDB, err)
+}
+
+// withSearchPath sets the schema every connection of dsn starts in. lib/pq
+// passes unknown parameters on to Postgres as settings.
+func withSearchPath(dsn string, schema string) (string, error) {
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema, nil
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// AdminKey creates an API key with the admin scope in db, as the
+// create-api-key command does for a new deployment, and returns the
+// Authorization header that authenticates with it.
+func AdminKey(t testing.TB, db *sql.DB) string {
+	t.Helper()
+	key := apikey.ApiKey{Name: "pgtest admin", Scopes: []string{auth.ScopeAdmin}}
+	if err := apikey.Create(context.Background(), db, &key); err != nil {
+		t.Fatalf("pgtest: can't create an admin key: %v", err)
+	}
+	return auth.SchemeApiKey + " " + key.Key
+}
+
+// StartApp runs the whole API for t on a database of its own, as New makes
+// them, and on ports of its own. The returned configuration has the port
+// the API listens on. The app is shut down when t ends.
+func StartApp(t testing.TB, opts ...app.Option) (config.Config, *app.App) {
+	t.Helper()
+	conf, _ := New(t)
+	conf.Port = ":0"
+	conf.MetricsPort = ":0"
+	conf.ShutdownDrain = 0
+
+	a, err := app.New(conf, opts...)
+	if err != nil {
+		t.Fatalf("pgtest: can't start the app: %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := a.Shutdown(ctx); err != nil {
+			t.Errorf("pgtest: can't shut down the app: %v", err)
+		}
+	})
+	failed := make(chan error, 1)
+	go func() {
+		failed <- a.Run(context.Background())
+	}()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for a.Addr() == nil {
+		select {
+		case err := <-failed:
+			t.Fatalf("pgtest: the app stopped: %v", err)
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pgtest: the app didn't start listening")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, port, _ := net.SplitHostPort(a.Addr().String())
+	conf.Port = ":" + port
+	return conf, a
+}
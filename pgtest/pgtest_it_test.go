@@ -0,0 +1,42 @@
+//go:build integration
+
+package pgtest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(Main(m))
+}
+
+func TestNew_ShouldIsolateEachTestAndDropItsSchema(t *testing.T) {
+	t.Parallel()
+
+	// Arrange
+	var schema string
+	t.Run("first", func(t *testing.T) {
+		_, db := New(t)
+		_, err := db.Exec("INSERT INTO expenses (title, amount, note, tags) VALUES ('apple', 10, '', '{}')")
+		assert.NoError(t, err)
+		assert.NoError(t, db.QueryRow("SELECT current_schema()").Scan(&schema))
+	})
+
+	// Act
+	_, db := New(t)
+
+	// Assert
+	var count int
+	assert.NoError(t, db.QueryRow("SELECT COUNT(*) FROM expenses").Scan(&count))
+	assert.Equal(t, 0, count)
+	_, _, err := connect()
+	assert.NoError(t, err)
+	var exists bool
+	assert.NoError(t, server.db.QueryRowContext(context.Background(),
+		"SELECT EXISTS (SELECT 1 FROM pg_namespace WHERE nspname = $1)", schema).Scan(&exists))
+	assert.False(t, exists, "schema %s should be dropped", schema)
+}
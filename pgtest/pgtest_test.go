@@ -0,0 +1,79 @@
+//go:build unit
+
+package pgtest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithSearchPath(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"postgresql://root:root@db/sanbox-db?sslmode=disable", "postgresql://root:root@db/sanbox-db?search_path=test_1&sslmode=disable"},
+		{"host=db dbname=expenses", "host=db dbname=expenses search_path=test_1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.dsn, func(t *testing.T) {
+			// Act
+			got, err := withSearchPath(tt.dsn, "test_1")
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+// endingTB records how a test was ended instead of ending it.
+type endingTB struct {
+	testing.TB
+	skipped string
+	failed  string
+}
+
+func (t *endingTB) Helper() {}
+
+func (t *endingTB) Skipf(format string, args ...any) {
+	t.skipped = fmt.Sprintf(format, args...)
+}
+
+func (t *endingTB) Fatalf(format string, args ...any) {
+	t.failed = fmt.Sprintf(format, args...)
+}
+
+func TestNoDatabase(t *testing.T) {
+	tests := []struct {
+		name        string
+		skip        string
+		wantSkipped bool
+	}{
+		{"unset", "", false},
+		{"skip", "1", true},
+		{"other value", "true", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			t.Setenv(skipWithoutDB, tt.skip)
+			tb := &endingTB{}
+
+			// Act
+			noDatabase(tb, errors.New("connection refused"))
+
+			// Assert
+			if tt.wantSkipped {
+				assert.Equal(t, "pgtest: no Postgres to test against: connection refused", tb.skipped)
+				assert.Empty(t, tb.failed)
+			} else {
+				assert.Equal(t, "pgtest: no Postgres to test against, set PGTEST_SKIP_WITHOUT_DB=1 to skip: connection refused", tb.failed)
+				assert.Empty(t, tb.skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   config.Limit
+}
+
+// MemoryStore keeps buckets in process. Each replica counts on its own, so a
+// client spread over n replicas gets up to n times its limit.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: map[string]*bucket{},
+		now:     time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit config.Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	tokens := refill(b.tokens, now.Sub(b.updated), limit)
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	b.tokens, b.updated, b.limit = tokens, now, limit
+	return newResult(tokens, allowed, limit), nil
+}
+
+// sweep drops buckets that have refilled completely; a missing bucket starts
+// full, so they carry no state.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if refill(b.tokens, now.Sub(b.updated), b.limit) >= float64(b.limit.Burst) {
+			delete(s.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build unit
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStore(now *time.Time) *MemoryStore {
+	store := NewMemoryStore()
+	store.now = func() time.Time { return *now }
+	return store
+}
+
+func TestMemoryStore_ShouldAllowBurstThenRefill(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := newTestStore(&now)
+	limit := config.Limit{Requests: 60, Per: time.Minute, Burst: 2}
+
+	// Act
+	first, _ := store.Take(context.Background(), "client", limit)
+	second, _ := store.Take(context.Background(), "client", limit)
+	third, _ := store.Take(context.Background(), "client", limit)
+	now = now.Add(time.Second)
+	refilled, _ := store.Take(context.Background(), "client", limit)
+
+	// Assert
+	assert.True(t, first.Allowed)
+	assert.Equal(t, 1, first.Remaining)
+	assert.True(t, second.Allowed)
+	assert.Equal(t, 0, second.Remaining)
+	assert.Equal(t, 2*time.Second, second.Reset)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, time.Second, third.RetryAfter)
+	assert.True(t, refilled.Allowed)
+}
+
+func TestMemoryStore_ShouldKeepClientsApart(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := newTestStore(&now)
+	limit := config.Limit{Requests: 1, Per: time.Hour, Burst: 1}
+
+	// Act
+	a, _ := store.Take(context.Background(), "a", limit)
+	b, _ := store.Take(context.Background(), "b", limit)
+
+	// Assert
+	assert.True(t, a.Allowed)
+	assert.True(t, b.Allowed)
+}
+
+func TestMemoryStore_ShouldSweepFullBuckets(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	store := newTestStore(&now)
+	limit := config.Limit{Requests: 60, Per: time.Minute, Burst: 10}
+	store.Take(context.Background(), "idle", limit)
+
+	// Act
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "busy", limit)
+
+	// Assert
+	assert.NotContains(t, store.buckets, "idle")
+	assert.Contains(t, store.buckets, "busy")
+}
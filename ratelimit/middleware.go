@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/logging"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderLimit     = "RateLimit-Limit"
+	HeaderRemaining = "RateLimit-Remaining"
+	HeaderReset     = "RateLimit-Reset"
+)
+
+// KeyFunc identifies the client a request counts against.
+type KeyFunc func(c echo.Context) string
+
+// ClientKey identifies clients by the principal auth.Middleware
+// authenticated; Middleware with it goes after auth.Middleware.
+func ClientKey(c echo.Context) string {
+	principal, _ := auth.FromContext(c.Request().Context())
+	return principal.Subject
+}
+
+// IPKey identifies clients by the address of their connection, for limiting
+// them before they authenticate. X-Forwarded-For is ignored, since any
+// client can set it.
+func IPKey(c echo.Context) string {
+	return "ip:" + echo.ExtractIPDirect()(c.Request())
+}
+
+type options struct {
+	aliases map[string]string
+}
+
+// Option customizes Middleware.
+type Option func(*options)
+
+// WithAliases counts the routes keyed in aliases against the bucket of the
+// route they map to, e.g. a gRPC method against the REST route doing the
+// same work, so a client can't get around a route's limit by switching
+// protocols.
+func WithAliases(aliases map[string]string) Option {
+	return func(o *options) {
+		o.aliases = aliases
+	}
+}
+
+// Middleware limits every client to the token bucket configured for the
+// route, answering 429 once it is empty. Every response carries the
+// RateLimit-* headers. If store fails the request is let through; an outage
+// of the limiter shouldn't become an outage of the API. Handlers doing more
+// than one route's work in a request charge the rest with Take.
+func Middleware(store Store, conf config.RateLimit, key KeyFunc, opts ...Option) echo.MiddlewareFunc {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			l := limiter{store: store, conf: conf, key: key(c)}
+			ctx := context.WithValue(c.Request().Context(), limiterKey{}, l)
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			route := c.Request().Method + " " + c.Path()
+			if alias, ok := o.aliases[route]; ok {
+				route = alias
+			}
+			limit, result, err := l.take(ctx, route)
+			if err != nil {
+				logging.FromContext(ctx).Error("can't check rate limit", "error", err)
+				return next(c)
+			}
+			if limit.Requests == 0 {
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderLimit, strconv.Itoa(limit.Burst))
+			header.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderReset, ceilSeconds(result.Reset))
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, ceilSeconds(result.RetryAfter))
+				return errLimited
+			}
+			return next(c)
+		}
+	}
+}
+
+var errLimited = echo.NewHTTPError(http.StatusTooManyRequests, "Rate limit exceeded")
+
+// limiter is the client and buckets Middleware limited a request with.
+type limiter struct {
+	store Store
+	conf  config.RateLimit
+	key   string
+}
+
+type limiterKey struct{}
+
+// take takes a token from the client's bucket for route. A zero limit
+// returned means the route isn't limited.
+func (l limiter) take(ctx context.Context, route string) (config.Limit, Result, error) {
+	limit, ok := l.conf.Routes[route]
+	if !ok {
+		limit, route = l.conf.Default, "*"
+	}
+	if limit.Requests == 0 {
+		return limit, Result{Allowed: true}, nil
+	}
+	result, err := l.store.Take(ctx, l.key+" "+route, limit)
+	return limit, result, err
+}
+
+// Take charges the client Middleware limited ctx's request for with one
+// request to route, e.g. "POST /expenses" for each expense a batch creates,
+// and returns a 429 error once its bucket is empty. Like Middleware, it lets
+// the request through when the store fails.
+func Take(ctx context.Context, route string) error {
+	l, ok := ctx.Value(limiterKey{}).(limiter)
+	if !ok {
+		return nil
+	}
+	_, result, err := l.take(ctx, route)
+	if err != nil {
+		logging.FromContext(ctx).Error("can't check rate limit", "error", err)
+		return nil
+	}
+	if !result.Allowed {
+		return errLimited
+	}
+	return nil
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
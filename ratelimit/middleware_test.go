@@ -0,0 +1,214 @@
+//go:build unit
+
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit config.Limit) (Result, error) {
+	return Result{}, errors.New("connection refused")
+}
+
+// authenticate stands in for auth.Middleware, authenticating every request
+// as the subject in its Authorization header.
+func authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		subject := c.Request().Header.Get(echo.HeaderAuthorization)
+		c.SetRequest(c.Request().WithContext(auth.WithPrincipal(c.Request().Context(), auth.Principal{Subject: subject})))
+		return next(c)
+	}
+}
+
+func newTestServer(store Store, conf config.RateLimit) *echo.Echo {
+	e := echo.New()
+	g := e.Group("", authenticate, Middleware(store, conf, ClientKey))
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g.POST("/expenses", ok)
+	g.GET("/expenses", ok)
+	g.GET("/expenses/:id", ok)
+	return e
+}
+
+func serve(e *echo.Echo, method string, target string, auth string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set(echo.HeaderAuthorization, auth)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMiddleware_ShouldSetHeadersAndRejectWhenEmpty(t *testing.T) {
+	// Arrange
+	e := newTestServer(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 1},
+	})
+
+	// Act
+	first := serve(e, http.MethodGet, "/expenses", "alice")
+	second := serve(e, http.MethodGet, "/expenses", "alice")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "1", first.Header().Get(HeaderLimit))
+	assert.Equal(t, "0", first.Header().Get(HeaderRemaining))
+	assert.Equal(t, "1", first.Header().Get(HeaderReset))
+	assert.Equal(t, http.StatusTooManyRequests, second.Code)
+	assert.Equal(t, "1", second.Header().Get(echo.HeaderRetryAfter))
+	assert.Contains(t, second.Body.String(), "Rate limit exceeded")
+}
+
+func TestMiddleware_RouteLimit_ShouldHaveItsOwnBucket(t *testing.T) {
+	// Arrange
+	e := newTestServer(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 5},
+		Routes: map[string]config.Limit{
+			"POST /expenses": {Requests: 1, Per: time.Minute, Burst: 1},
+		},
+	})
+
+	// Act
+	created := serve(e, http.MethodPost, "/expenses", "alice")
+	limited := serve(e, http.MethodPost, "/expenses", "alice")
+	other := serve(e, http.MethodGet, "/expenses/1", "alice")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, created.Code)
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, http.StatusOK, other.Code)
+	assert.Equal(t, "4", other.Header().Get(HeaderRemaining))
+}
+
+func TestMiddleware_ShouldLimitEachClientSeparately(t *testing.T) {
+	// Arrange
+	e := newTestServer(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 1, Per: time.Minute, Burst: 1},
+	})
+
+	// Act
+	alice := serve(e, http.MethodGet, "/expenses", "alice")
+	bob := serve(e, http.MethodGet, "/expenses", "bob")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, alice.Code)
+	assert.Equal(t, http.StatusOK, bob.Code)
+}
+
+func TestMiddleware_ZeroRequests_ShouldNotLimit(t *testing.T) {
+	// Arrange
+	e := newTestServer(NewMemoryStore(), config.RateLimit{})
+
+	// Act
+	rec := serve(e, http.MethodGet, "/expenses", "alice")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderLimit))
+}
+
+func TestMiddleware_StoreError_ShouldLetRequestThrough(t *testing.T) {
+	// Arrange
+	e := newTestServer(failingStore{}, config.RateLimit{
+		Default: config.Limit{Requests: 1, Per: time.Minute, Burst: 1},
+	})
+
+	// Act
+	rec := serve(e, http.MethodGet, "/expenses", "alice")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestMiddleware_Alias_ShouldShareTheBucketOfItsRoute(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g := e.Group("", authenticate, Middleware(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 5},
+		Routes: map[string]config.Limit{
+			"POST /expenses": {Requests: 1, Per: time.Minute, Burst: 1},
+		},
+	}, ClientKey, WithAliases(map[string]string{"POST /rpc/CreateExpense": "POST /expenses"})))
+	g.POST("/expenses", ok)
+	g.POST("/rpc/CreateExpense", ok)
+
+	// Act
+	created := serve(e, http.MethodPost, "/expenses", "alice")
+	limited := serve(e, http.MethodPost, "/rpc/CreateExpense", "alice")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, created.Code)
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+}
+
+func TestMiddleware_IPKey_ShouldIgnoreForwardedFor(t *testing.T) {
+	// Arrange
+	e := echo.New()
+	e.Use(Middleware(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 1, Per: time.Minute, Burst: 1},
+	}, IPKey))
+	e.GET("/expenses", func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	serveFrom := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/expenses", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// Act
+	first := serveFrom("198.51.100.1")
+	second := serveFrom("198.51.100.2")
+
+	// Assert
+	assert.Equal(t, http.StatusOK, first)
+	assert.Equal(t, http.StatusTooManyRequests, second)
+}
+
+func TestTake_ShouldChargeTheClientOfTheRequest(t *testing.T) {
+	// Arrange
+	var taken []error
+	e := echo.New()
+	g := e.Group("", authenticate, Middleware(NewMemoryStore(), config.RateLimit{
+		Default: config.Limit{Requests: 60, Per: time.Minute, Burst: 5},
+		Routes: map[string]config.Limit{
+			"POST /expenses": {Requests: 1, Per: time.Minute, Burst: 1},
+		},
+	}, ClientKey))
+	g.POST("/batch", func(c echo.Context) error {
+		for i := 0; i < 2; i++ {
+			taken = append(taken, Take(c.Request().Context(), "POST /expenses"))
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	// Act
+	serve(e, http.MethodPost, "/batch", "alice")
+
+	// Assert
+	if assert.Len(t, taken, 2) {
+		assert.NoError(t, taken[0])
+		assert.Equal(t, errLimited, taken[1])
+	}
+}
+
+func TestTake_WithoutMiddleware_ShouldNotLimit(t *testing.T) {
+	// Act
+	err := Take(context.Background(), "POST /expenses")
+
+	// Assert
+	assert.NoError(t, err)
+}
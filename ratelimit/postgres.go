@@ -0,0 +1,57 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/brown-kaew/assessment/config"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so every
+// replica draws from the same bucket. Time is taken from the database clock
+// so replicas with skewed clocks agree on the refill.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit config.Limit) (Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	// The upsert refills the bucket and locks its row until commit.
+	var tokens float64
+	err = tx.QueryRowContext(ctx, `
+	INSERT INTO
+		rate_limit_buckets AS b (key, tokens, updated_at)
+	VALUES
+		($1, $2, now())
+	ON CONFLICT (key) DO UPDATE
+	SET
+		tokens=LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at) * $3),
+		updated_at=now()
+	RETURNING tokens
+	`, key, limit.Burst, rate(limit)).Scan(&tokens)
+	if err != nil {
+		return Result{}, err
+	}
+
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+		_, err = tx.ExecContext(ctx, "UPDATE rate_limit_buckets SET tokens=$2 WHERE key=$1", key, tokens)
+		if err != nil {
+			return Result{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Result{}, err
+	}
+	return newResult(tokens, allowed, limit), nil
+}
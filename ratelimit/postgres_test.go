@@ -0,0 +1,65 @@
+//go:build unit
+
+package ratelimit
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostgresStore_ShouldTakeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+	limit := config.Limit{Requests: 60, Per: time.Minute, Burst: 10}
+
+	// Arrange
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO rate_limit_buckets").WithArgs("client", 10, 1.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(3.5))
+	mock.ExpectExec("UPDATE rate_limit_buckets").WithArgs("client", 2.5).WillReturnResult(driver.RowsAffected(1))
+	mock.ExpectCommit()
+
+	// Act
+	result, err := store.Take(context.Background(), "client", limit)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+}
+
+func TestPostgresStore_EmptyBucket_ShouldNotTakeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+	store := NewPostgresStore(db)
+	limit := config.Limit{Requests: 60, Per: time.Minute, Burst: 10}
+
+	// Arrange
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO rate_limit_buckets").WithArgs("client", 10, 1.0).
+		WillReturnRows(sqlmock.NewRows([]string{"tokens"}).AddRow(0.25))
+	mock.ExpectCommit()
+
+	// Act
+	result, err := store.Take(context.Background(), "client", limit)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 750*time.Millisecond, result.RetryAfter)
+}
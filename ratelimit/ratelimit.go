@@ -0,0 +1,61 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+)
+
+// Store keeps one token bucket per key.
+type Store interface {
+	// Take refills the bucket for key at the rate of limit, then takes a
+	// token from it if there is one.
+	Take(ctx context.Context, key string, limit config.Limit) (Result, error)
+}
+
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket.
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next token, when none was left.
+	RetryAfter time.Duration
+}
+
+// NewStore returns the store named in conf.
+func NewStore(conf config.RateLimit, db *sql.DB) Store {
+	if conf.Store == "postgres" {
+		return NewPostgresStore(db)
+	}
+	return NewMemoryStore()
+}
+
+// rate is the number of tokens added to a bucket per second.
+func rate(limit config.Limit) float64 {
+	return float64(limit.Requests) / limit.Per.Seconds()
+}
+
+func refill(tokens float64, elapsed time.Duration, limit config.Limit) float64 {
+	return math.Min(float64(limit.Burst), tokens+elapsed.Seconds()*rate(limit))
+}
+
+func newResult(tokens float64, allowed bool, limit config.Limit) Result {
+	r := rate(limit)
+	result := Result{
+		Allowed:   allowed,
+		Remaining: int(tokens),
+		Reset:     seconds((float64(limit.Burst) - tokens) / r),
+	}
+	if !allowed {
+		result.RetryAfter = seconds((1 - tokens) / r)
+	}
+	return result
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
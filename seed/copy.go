@@ -0,0 +1,82 @@
+package seed
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// Insert adds expenses, each with its first version valid from At, in one
+// transaction and sets their ids. Rows go in with COPY, which is far faster
+// than an INSERT per expense. No events are published for them.
+func Insert(ctx context.Context, db *sql.DB, expenses []Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// COPY can't return the ids it assigns, so they are taken from the
+	// sequence up front.
+	rows, err := tx.QueryContext(ctx, `
+	SELECT nextval(pg_get_serial_sequence('expenses', 'id'))
+	FROM generate_series(1, $1)
+	`, len(expenses))
+	if err != nil {
+		return err
+	}
+	for i := 0; rows.Next(); i++ {
+		if err := rows.Scan(&expenses[i].Id); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	err = copyIn(ctx, tx, pq.CopyIn("expenses", "id", "title", "amount", "note", "tags", "ledger_id"), expenses, func(e Expense) []any {
+		return []any{e.Id, e.Title, e.Amount, e.Note, pq.Array(e.Tags), e.LedgerId}
+	})
+	if err != nil {
+		return err
+	}
+	err = copyIn(ctx, tx, pq.CopyIn("expense_versions", "expense_id", "version", "title", "amount", "note", "tags", "valid_from"), expenses, func(e Expense) []any {
+		return []any{e.Id, 1, e.Title, e.Amount, e.Note, pq.Array(e.Tags), e.At}
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func copyIn(ctx context.Context, tx *sql.Tx, query string, expenses []Expense, row func(Expense) []any) error {
+	stmt, err := tx.PrepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, e := range expenses {
+		if _, err := stmt.ExecContext(ctx, row(e)...); err != nil {
+			return err
+		}
+	}
+	// Executing without arguments ends the COPY.
+	_, err = stmt.ExecContext(ctx)
+	return err
+}
+
+// Populate generates the expenses of opts and inserts them, for demos and
+// tests that need a realistic database.
+func Populate(ctx context.Context, db *sql.DB, opts Options) ([]Expense, error) {
+	expenses := Generate(opts)
+	if err := Insert(ctx, db, expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
@@ -0,0 +1,157 @@
+// Package seed generates realistic expenses for demos, load tests and
+// tests, and inserts expenses in bulk with COPY.
+package seed
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/brown-kaew/assessment/expense"
+)
+
+// Expense is an expense to insert, spent At, in the ledger LedgerId or in
+// none.
+type Expense struct {
+	expense.Expense
+	LedgerId *int
+	At       time.Time
+}
+
+// Options sets what Generate makes. The same options always make the same
+// expenses.
+type Options struct {
+	Seed     int64
+	Count    int
+	LedgerId *int
+	// Start is when the first expense may be spent; Days how many days
+	// they are spread over. They default to 2024-01-01 and 365.
+	Start time.Time
+	Days  int
+}
+
+// category is a kind of expense, its titles, tags and the range of its
+// amounts in baht.
+type category struct {
+	weight   int
+	titles   []string
+	tags     []string
+	min, max float64
+	notes    []string
+}
+
+var categories = []category{
+	{
+		weight: 30,
+		titles: []string{"pad thai", "som tam", "khao man gai", "boat noodles", "green curry", "mango sticky rice", "grilled pork skewers", "fried rice", "tom yum goong", "khao soi"},
+		tags:   []string{"food"},
+		min:    40, max: 250,
+		notes: []string{"street food", "lunch with colleagues", "night market", "delivery"},
+	},
+	{
+		weight: 20,
+		titles: []string{"iced coffee", "thai milk tea", "strawberry smoothie", "coconut water", "bubble tea", "americano"},
+		tags:   []string{"food", "beverage"},
+		min:    25, max: 120,
+		notes: []string{"night market promotion discount 10 bath", "morning coffee", "buy 1 get 1"},
+	},
+	{
+		weight: 15,
+		titles: []string{"BTS fare", "MRT fare", "taxi", "motorbike taxi", "Grab ride", "fuel"},
+		tags:   []string{"transport"},
+		min:    15, max: 600,
+		notes: []string{"to the office", "late night ride home", "airport"},
+	},
+	{
+		weight: 12,
+		titles: []string{"groceries", "rice 5 kg", "eggs", "fresh fruit", "toiletries", "laundry detergent"},
+		tags:   []string{"household"},
+		min:    60, max: 1500,
+		notes: []string{"weekly shopping", "7-Eleven", "Big C"},
+	},
+	{
+		weight: 8,
+		titles: []string{"electricity bill", "water bill", "internet", "mobile plan"},
+		tags:   []string{"utilities", "bills"},
+		min:    200, max: 2500,
+		notes: []string{"monthly", "autopay"},
+	},
+	{
+		weight: 7,
+		titles: []string{"cinema ticket", "concert ticket", "streaming subscription", "karaoke", "board game cafe"},
+		tags:   []string{"entertainment"},
+		min:    100, max: 3000,
+		notes: []string{"with friends", "weekend"},
+	},
+	{
+		weight: 5,
+		titles: []string{"pharmacy", "dentist", "gym membership", "thai massage"},
+		tags:   []string{"health"},
+		min:    150, max: 4000,
+		notes: []string{"check up", "monthly membership"},
+	},
+	{
+		weight: 3,
+		titles: []string{"rent", "condo common fee"},
+		tags:   []string{"home", "bills"},
+		min:    3000, max: 18000,
+		notes: []string{"monthly"},
+	},
+}
+
+// Generate makes opts.Count expenses, oldest first. Amounts follow a
+// log-uniform distribution within the range of their category, so small
+// expenses are the most common, as they are in practice.
+func Generate(opts Options) []Expense {
+	start, days := opts.Start, opts.Days
+	if start.IsZero() {
+		start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if days <= 0 {
+		days = 365
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+	total := 0
+	for _, c := range categories {
+		total += c.weight
+	}
+
+	expenses := make([]Expense, opts.Count)
+	for i := range expenses {
+		c := pick(r, total)
+		e := expense.Expense{
+			Title:  c.titles[r.Intn(len(c.titles))],
+			Amount: amount(r, c.min, c.max),
+			Tags:   append([]string(nil), c.tags...),
+		}
+		if r.Intn(3) == 0 {
+			e.Note = c.notes[r.Intn(len(c.notes))]
+		}
+		at := start.Add(time.Duration(r.Int63n(int64(days) * int64(24*time.Hour))))
+		expenses[i] = Expense{Expense: e, LedgerId: opts.LedgerId, At: at.Truncate(time.Second)}
+	}
+	sort.SliceStable(expenses, func(i, j int) bool { return expenses[i].At.Before(expenses[j].At) })
+	return expenses
+}
+
+func pick(r *rand.Rand, total int) category {
+	n := r.Intn(total)
+	for _, c := range categories {
+		if n < c.weight {
+			return c
+		}
+		n -= c.weight
+	}
+	return categories[len(categories)-1]
+}
+
+// amount is log-uniform between min and max, in whole baht below 100 and
+// to the satang above.
+func amount(r *rand.Rand, min, max float64) float64 {
+	a := math.Exp(math.Log(min) + r.Float64()*(math.Log(max)-math.Log(min)))
+	if a < 100 {
+		return math.Round(a)
+	}
+	return math.Round(a*100) / 100
+}
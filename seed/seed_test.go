@@ -0,0 +1,95 @@
+//go:build unit
+
+package seed
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerate_SameSeed_ShouldMakeSameExpenses(t *testing.T) {
+	// Act
+	first := Generate(Options{Seed: 42, Count: 50})
+	second := Generate(Options{Seed: 42, Count: 50})
+	other := Generate(Options{Seed: 43, Count: 50})
+
+	// Assert
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, first, other)
+}
+
+func TestGenerate_ShouldSpreadRealisticExpensesOverDays(t *testing.T) {
+	// Arrange
+	start := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	ledger := 7
+
+	// Act
+	expenses := Generate(Options{Seed: 1, Count: 500, LedgerId: &ledger, Start: start, Days: 31})
+
+	// Assert
+	assert.Len(t, expenses, 500)
+	for i, e := range expenses {
+		assert.NotEmpty(t, e.Title)
+		assert.NotEmpty(t, e.Tags)
+		assert.GreaterOrEqual(t, e.Amount, 15.0)
+		assert.LessOrEqual(t, e.Amount, 18000.0)
+		assert.Equal(t, &ledger, e.LedgerId)
+		assert.False(t, e.At.Before(start))
+		assert.True(t, e.At.Before(start.AddDate(0, 0, 31)))
+		if i > 0 {
+			assert.False(t, e.At.Before(expenses[i-1].At), "expenses should be oldest first")
+		}
+	}
+}
+
+func TestGenerate_ShouldMakeSmallExpensesMostCommon(t *testing.T) {
+	// Act
+	expenses := Generate(Options{Seed: 7, Count: 1000})
+
+	// Assert
+	small := 0
+	for _, e := range expenses {
+		if e.Amount < 500 {
+			small++
+		}
+	}
+	assert.Greater(t, small, 600)
+}
+
+func TestInsert_ShouldCopyExpensesAndVersions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	// Arrange
+	at := time.Date(2024, 2, 1, 12, 0, 0, 0, time.UTC)
+	expenses := []Expense{
+		{Expense: expense.Expense{Title: "pad thai", Amount: 60, Tags: []string{"food"}}, At: at},
+	}
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT nextval").WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(5))
+	copyExpenses := mock.ExpectPrepare(`COPY "expenses" \("id", "title", "amount", "note", "tags", "ledger_id"\) FROM STDIN`)
+	copyExpenses.ExpectExec().WithArgs(5, "pad thai", 60.0, "", `{"food"}`, nil).WillReturnResult(driver.RowsAffected(1))
+	copyExpenses.ExpectExec().WithArgs().WillReturnResult(driver.RowsAffected(0))
+	copyVersions := mock.ExpectPrepare(`COPY "expense_versions" \("expense_id", "version", "title", "amount", "note", "tags", "valid_from"\) FROM STDIN`)
+	copyVersions.ExpectExec().WithArgs(5, 1, "pad thai", 60.0, "", `{"food"}`, at).WillReturnResult(driver.RowsAffected(1))
+	copyVersions.ExpectExec().WithArgs().WillReturnResult(driver.RowsAffected(0))
+	mock.ExpectCommit()
+
+	// Act
+	err = Insert(context.Background(), db, expenses)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 5, expenses[0].Id)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
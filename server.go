@@ -3,55 +3,62 @@ package main
 import (
 	"context"
 	"fmt"
-	"net/http"
+	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
-	"github.com/brown-kaew/assessment/config"
-	"github.com/brown-kaew/assessment/expense"
-	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
-	"github.com/labstack/gommon/log"
+	"github.com/brown-kaew/assessment/app"
+	"github.com/brown-kaew/assessment/logging"
 )
 
+// main runs the subcommand named by the first argument, serve when there is
+// none so the server starts as it always has.
 func main() {
-	banner()
-	conf := config.New()
-	database, closeDB := expense.InitDB(conf)
-	defer closeDB()
-
-	e := echo.New()
-	e.HideBanner = true
-	e.Logger.SetLevel(log.INFO)
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-
-	e.GET("/health", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, "OK")
-	})
-
-	g := e.Group("")
-	g.Use(config.HardCodeAuth)
-	expense.NewHandler(database, g)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		serve(args)
+	case "config":
+		configCommand(args)
+	default:
+		adminCommand(command, args)
+	}
+}
 
-	go func() {
-		if err := e.Start(conf.Port); err != nil && err != http.ErrServerClosed { // Start server
-			e.Logger.Fatal("shutting down the server")
-		}
-	}()
+func serve(args []string) {
+	conf := loadConfig(args)
+	banner()
+	logger := logging.New(conf)
+	slog.SetDefault(logger)
+	a, err := app.New(conf)
+	if err != nil {
+		logger.Error("can't start the server", "error", err)
+		os.Exit(1)
+	}
 
-	shutdown := make(chan os.Signal, 1)
-	signal.Notify(shutdown, os.Interrupt, syscall.SIGTERM)
-	<-shutdown
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	runErr := a.Run(ctx)
+	if runErr != nil {
+		logger.Error("shutting down the server", "error", runErr)
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), conf.ShutdownDrain+10*time.Second)
 	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+	if err := a.Shutdown(shutdownCtx); err != nil {
+		logger.Error("can't shut down cleanly", "error", err)
+		os.Exit(1)
+	}
+	if runErr != nil {
+		os.Exit(1)
 	}
 
-	e.Logger.Info("Server stopped")
+	logger.Info("Server stopped")
 }
 
 func banner() {
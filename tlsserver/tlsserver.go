@@ -0,0 +1,182 @@
+package tlsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+)
+
+// Certificates holds the server certificate and client CAs read from the
+// files in the configuration, and rereads them when they change.
+type Certificates struct {
+	conf config.TLSConfig
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  []time.Time
+}
+
+// Load reads the certificate, key and client CA files.
+func Load(conf config.TLSConfig) (*Certificates, error) {
+	c := &Certificates{conf: conf}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload rereads the files if any of them changed since they were last read,
+// and reports whether it did. On error the certificates in use are kept.
+func (c *Certificates) Reload() (bool, error) {
+	modTimes, err := c.stat()
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := equalTimes(modTimes, c.modTimes)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.conf.CertFile, c.conf.KeyFile)
+	if err != nil {
+		return false, fmt.Errorf("tls certificate: %w", err)
+	}
+	var clientCAs *x509.CertPool
+	if c.conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.conf.ClientCAFile)
+		if err != nil {
+			return false, fmt.Errorf("tls client ca: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, fmt.Errorf("tls client ca: no certificates in %s", c.conf.ClientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.modTimes = modTimes
+	return true, nil
+}
+
+func (c *Certificates) stat() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, name := range []string{c.conf.CertFile, c.conf.KeyFile, c.conf.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+func equalTimes(a []time.Time, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Watch reloads the files every ReloadInterval until ctx is cancelled. A
+// certificate being rewritten can fail to load half way through; it is
+// logged and retried on the next tick.
+func (c *Certificates) Watch(ctx context.Context) {
+	ticker := time.NewTicker(c.conf.ReloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		reloaded, err := c.Reload()
+		if err != nil {
+			slog.Error("can't reload tls certificates", "error", err)
+		} else if reloaded {
+			slog.Info("reloaded tls certificates")
+		}
+	}
+}
+
+// Config returns a TLS configuration that serves the current certificates on
+// every new connection. Its NextProtos are what makes net/http serve HTTP/2
+// on a listener it doesn't create itself, as echo's StartServer does.
+func (c *Certificates) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+				ClientCAs:    c.clientCAs,
+				ClientAuth:   clientAuth(c.conf.ClientAuth),
+				// h2 is needed by gRPC clients.
+				NextProtos: []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+func clientAuth(mode string) tls.ClientAuthType {
+	switch strings.ToLower(mode) {
+	case "optional":
+		return tls.VerifyClientCertIfGiven
+	case "require":
+		return tls.RequireAndVerifyClientCert
+	}
+	return tls.NoClientCert
+}
+
+// Redirect answers every request with a permanent redirect to the same url
+// over HTTPS on the port of addr. 308 keeps the method and body of
+// non-GET requests.
+func Redirect(addr string) http.Handler {
+	_, port, _ := net.SplitHostPort(addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// NewRedirectServer serves Redirect to the API on addr on RedirectPort.
+func NewRedirectServer(conf config.TLSConfig, addr string) *http.Server {
+	return &http.Server{
+		Addr:              conf.RedirectPort,
+		Handler:           Redirect(addr),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
@@ -0,0 +1,280 @@
+//go:build unit
+
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/brown-kaew/assessment/auth"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for name signed by parent, or self-signed CA
+// when parent is nil.
+func issue(t *testing.T, name string, serial int64, parent *issued) issued {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"Acme"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return issued{cert: cert, key: key}
+}
+
+func (i issued) write(t *testing.T, certFile string, keyFile string) {
+	writePEM(t, certFile, "CERTIFICATE", i.cert.Raw)
+	der, err := x509.MarshalECPrivateKey(i.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePEM(t, keyFile, "EC PRIVATE KEY", der)
+}
+
+func (i issued) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{i.cert.Raw}, PrivateKey: i.key, Leaf: i.cert}
+}
+
+func writePEM(t *testing.T, name string, blockType string, der []byte) {
+	if err := os.WriteFile(name, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func servedSerial(t *testing.T, c *Certificates) int64 {
+	conf, err := c.Config().GetConfigForClient(&tls.ClientHelloInfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestReload_ChangedFiles_ShouldServeNewCertificate(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	conf := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientAuth:     "none",
+		ReloadInterval: time.Second,
+	}
+	ca := issue(t, "ca", 1, nil)
+	issue(t, "localhost", 2, &ca).write(t, conf.CertFile, conf.KeyFile)
+	certs, err := Load(conf)
+	assert.NoError(t, err)
+	unchanged, err := certs.Reload()
+	assert.NoError(t, err)
+
+	issue(t, "localhost", 3, &ca).write(t, conf.CertFile, conf.KeyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(conf.CertFile, later, later)
+
+	// Act
+	reloaded, err := certs.Reload()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.False(t, unchanged)
+	assert.True(t, reloaded)
+	assert.Equal(t, int64(3), servedSerial(t, certs))
+}
+
+func TestReload_BrokenFiles_ShouldKeepServingOldCertificate(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	conf := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientAuth:     "none",
+		ReloadInterval: time.Second,
+	}
+	ca := issue(t, "ca", 1, nil)
+	issue(t, "localhost", 2, &ca).write(t, conf.CertFile, conf.KeyFile)
+	certs, err := Load(conf)
+	assert.NoError(t, err)
+
+	os.WriteFile(conf.CertFile, []byte("half written"), 0o600)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(conf.CertFile, later, later)
+
+	// Act
+	reloaded, err := certs.Reload()
+
+	// Assert
+	assert.Error(t, err)
+	assert.False(t, reloaded)
+	assert.Equal(t, int64(2), servedSerial(t, certs))
+}
+
+func TestConfig_RequiredClientCertificate_ShouldIdentifyClient(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	conf := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		ClientAuth:     "require",
+		ReloadInterval: time.Second,
+	}
+	ca := issue(t, "ca", 1, nil)
+	writePEM(t, conf.ClientCAFile, "CERTIFICATE", ca.cert.Raw)
+	issue(t, "localhost", 2, &ca).write(t, conf.CertFile, conf.KeyFile)
+	client := issue(t, "reporting", 3, &ca)
+	certs, err := Load(conf)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	g := e.Group("", auth.ClientCertificate(map[string][]string{"CN=reporting,O=Acme": {auth.ScopeExpensesRead}}))
+	g.GET("/whoami", func(c echo.Context) error {
+		principal, _ := auth.FromContext(c.Request().Context())
+		return c.String(http.StatusOK, principal.Subject)
+	})
+	server := httptest.NewUnstartedServer(e)
+	server.TLS = certs.Config()
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      roots,
+		Certificates: []tls.Certificate{client.tlsCertificate()},
+	}}}
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+
+	// Act
+	resp, err := withCert.Get(server.URL + "/whoami")
+	_, refused := withoutCert.Get(server.URL + "/whoami")
+
+	// Assert
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "cert:CN=reporting,O=Acme", string(body))
+	}
+	assert.Error(t, refused)
+}
+
+func TestConfig_EchoTLSServer_ShouldServeHTTP2(t *testing.T) {
+	// Arrange
+	dir := t.TempDir()
+	conf := config.TLSConfig{
+		CertFile:       filepath.Join(dir, "tls.crt"),
+		KeyFile:        filepath.Join(dir, "tls.key"),
+		ReloadInterval: time.Second,
+	}
+	ca := issue(t, "ca", 1, nil)
+	issue(t, "localhost", 2, &ca).write(t, conf.CertFile, conf.KeyFile)
+	certs, err := Load(conf)
+	assert.NoError(t, err)
+
+	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+	e.GET("/proto", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().Proto)
+	})
+	e.TLSServer.Addr = "127.0.0.1:0"
+	e.TLSServer.TLSConfig = certs.Config()
+	go e.StartServer(e.TLSServer)
+	defer e.Close()
+	for deadline := time.Now().Add(5 * time.Second); e.TLSListenerAddr() == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if e.TLSListenerAddr() == nil {
+		t.Fatal("the server didn't start listening")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: roots},
+		ForceAttemptHTTP2: true,
+	}}
+
+	// Act
+	resp, err := client.Get("https://" + e.TLSListenerAddr().String() + "/proto")
+
+	// Assert
+	if assert.NoError(t, err) {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "HTTP/2.0", string(body))
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	tests := []struct {
+		name   string
+		addr   string
+		target string
+		want   string
+	}{
+		{"keeps path and query", ":2565", "http://expenses.example.com:8080/expenses?as_of=now", "https://expenses.example.com:2565/expenses?as_of=now"},
+		{"omits default port", ":443", "http://expenses.example.com/expenses", "https://expenses.example.com/expenses"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			req := httptest.NewRequest(http.MethodPost, tt.target, nil)
+			rec := httptest.NewRecorder()
+
+			// Act
+			Redirect(tt.addr).ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusPermanentRedirect, rec.Code)
+			assert.Equal(t, tt.want, rec.Header().Get("Location"))
+		})
+	}
+}
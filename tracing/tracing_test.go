@@ -0,0 +1,57 @@
+//go:build unit
+
+package tracing
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestInit_UnknownExporter_ShouldFail(t *testing.T) {
+	_, err := Init(context.Background(), config.Config{TraceExporter: "zipkin"})
+
+	assert.EqualError(t, err, `unknown trace exporter "zipkin"`)
+}
+
+func TestInit_Stdout(t *testing.T) {
+	shutdown, err := Init(context.Background(), config.Config{TraceExporter: "stdout"})
+
+	assert.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestMiddleware_ShouldContinueIncomingTrace(t *testing.T) {
+	// Arrange
+	_, err := Init(context.Background(), config.Config{TraceExporter: "none"})
+	assert.NoError(t, err)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	e := echo.New()
+	e.Use(otelecho.Middleware(ServiceName))
+	e.GET("/expenses", func(c echo.Context) error {
+		return c.JSON(http.StatusOK, []string{})
+	})
+	req := httptest.NewRequest(http.MethodGet, "/expenses", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	// Act
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	// Assert
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		assert.Equal(t, "/expenses", spans[0].Name())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+		assert.Equal(t, "00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	}
+}
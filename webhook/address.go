@@ -0,0 +1,62 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+var errPrivateAddress = errors.New("host must not be loopback, link-local or private")
+
+// publicIP reports whether ip may receive deliveries. Loopback, link-local,
+// private, multicast and unspecified addresses are refused so a subscription
+// can't make the server call itself or its neighbours.
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// checkHost resolves host with lookup and fails unless every address is
+// public.
+func checkHost(ctx context.Context, lookup func(ctx context.Context, network, host string) ([]net.IP, error), host string) error {
+	ips, err := lookup(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return errPrivateAddress
+		}
+	}
+	return nil
+}
+
+// dialPublic refuses connections to addresses that aren't public. It checks
+// the address actually dialled, so a host that resolved to a public address
+// when subscribing and to a private one later, or a redirect, is still caught.
+func dialPublic(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// newClient returns the client posting deliveries. It doesn't use a proxy,
+// which would be dialled instead of the subscriber.
+func newClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   dialPublic,
+	}).DialContext
+	return &http.Client{Timeout: 10 * time.Second, Transport: transport}
+}
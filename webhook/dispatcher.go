@@ -0,0 +1,266 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/lib/pq"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultMaxAttempts  = 8
+	defaultBaseBackoff  = 5 * time.Second
+	defaultMaxBackoff   = time.Hour
+	defaultLease        = 5 * time.Minute
+	deliveryBatchSize   = 20
+)
+
+// Dispatcher moves events from the outbox to webhook subscribers. Each outbox
+// event is fanned out into one delivery per subscription, and every delivery
+// is retried with exponential backoff until it succeeds or runs out of
+// attempts. Deliveries are leased with SKIP LOCKED so several replicas can run
+// a dispatcher against the same database.
+type Dispatcher struct {
+	db           *sql.DB
+	client       *http.Client
+	PollInterval time.Duration
+	MaxAttempts  int
+	BaseBackoff  time.Duration
+	MaxBackoff   time.Duration
+	// Lease is how long a claimed batch is kept from other dispatchers. It
+	// must outlast posting a whole batch.
+	Lease time.Duration
+}
+
+func NewDispatcher(db *sql.DB) *Dispatcher {
+	return &Dispatcher{
+		db:           db,
+		client:       newClient(),
+		PollInterval: defaultPollInterval,
+		MaxAttempts:  defaultMaxAttempts,
+		BaseBackoff:  defaultBaseBackoff,
+		MaxBackoff:   defaultMaxBackoff,
+		Lease:        defaultLease,
+	}
+}
+
+// Run dispatches until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.fanOut(ctx); err != nil {
+			slog.Error("can't fan out webhook events", "error", err)
+		}
+		if err := d.deliver(ctx); err != nil {
+			slog.Error("can't deliver webhook events", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// fanOut marks pending outbox events as dispatched and creates a delivery for
+// every subscription in a single statement.
+func (d *Dispatcher) fanOut(ctx context.Context) error {
+	_, err := d.db.ExecContext(ctx, `
+	WITH events AS (
+		UPDATE outbox
+		SET dispatched_at=now()
+		WHERE id IN (
+			SELECT id FROM outbox
+			WHERE dispatched_at IS NULL
+			ORDER BY id
+			LIMIT 100
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id
+	)
+	INSERT INTO
+		webhook_deliveries (webhook_id, event_id)
+	SELECT w.id, e.id
+	FROM events e CROSS JOIN webhooks w
+	`)
+	return err
+}
+
+type delivery struct {
+	id       int64
+	attempts int
+	url      string
+	secret   string
+	event    expense.Event
+}
+
+// deliver claims a batch of due deliveries, posts them, and records each
+// result on its own. No transaction is open while posting, so a slow
+// subscriber holds no locks, and a failure to record one result doesn't undo
+// the others and send them again.
+func (d *Dispatcher) deliver(ctx context.Context) error {
+	deliveries, err := d.claim(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Results are recorded even when the dispatcher is stopped mid batch.
+	recordCtx := context.WithoutCancel(ctx)
+	var errs []error
+	for i, dl := range deliveries {
+		err := d.post(ctx, dl)
+		if err != nil && ctx.Err() != nil {
+			// Shutting down; hand the rest back for the next run.
+			errs = append(errs, d.release(recordCtx, deliveries[i:]))
+			break
+		}
+		if err := d.record(recordCtx, dl, err); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// claim leases a batch of due deliveries, in a statement of its own, so no
+// other dispatcher picks them up until the lease expires. A dispatcher that
+// dies mid batch leaves its deliveries to be retried once it does.
+func (d *Dispatcher) claim(ctx context.Context) ([]delivery, error) {
+	rows, err := d.db.QueryContext(ctx, `
+	UPDATE webhook_deliveries d
+	SET locked_until=now() + $2 * interval '1 millisecond'
+	FROM webhooks w, outbox o
+	WHERE w.id = d.webhook_id AND o.id = d.event_id AND d.id IN (
+		SELECT id FROM webhook_deliveries
+		WHERE delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= now()
+			AND (locked_until IS NULL OR locked_until <= now())
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING d.id, d.attempts, w.url, w.secret, o.id, o.event_type, o.expense_id, o.payload, o.created_at
+	`, deliveryBatchSize, d.Lease.Milliseconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []delivery
+	for rows.Next() {
+		var dl delivery
+		var payload []byte
+		err = rows.Scan(&dl.id, &dl.attempts, &dl.url, &dl.secret,
+			&dl.event.Id, &dl.event.Type, &dl.event.ExpenseId, &payload, &dl.event.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		dl.event.Data = payload
+		deliveries = append(deliveries, dl)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].id < deliveries[j].id })
+	return deliveries, nil
+}
+
+// record stores the outcome of posting dl, postErr being nil on success, and
+// releases its lease.
+func (d *Dispatcher) record(ctx context.Context, dl delivery, postErr error) error {
+	var err error
+	attempts := dl.attempts + 1
+	switch {
+	case postErr == nil:
+		_, err = d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts=attempts + 1, last_error=NULL, delivered_at=now(), locked_until=NULL
+		WHERE id=$1
+		`, dl.id)
+	case attempts >= d.MaxAttempts:
+		_, err = d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts=$2, last_error=$3, failed_at=now(), locked_until=NULL
+		WHERE id=$1
+		`, dl.id, attempts, postErr.Error())
+	default:
+		_, err = d.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries
+		SET attempts=$2, last_error=$3, next_attempt_at=now() + $4 * interval '1 millisecond', locked_until=NULL
+		WHERE id=$1
+		`, dl.id, attempts, postErr.Error(), d.backoff(attempts).Milliseconds())
+	}
+	if err != nil {
+		return fmt.Errorf("can't record delivery %d: %w", dl.id, err)
+	}
+	return nil
+}
+
+// release gives up the lease of deliveries that weren't posted.
+func (d *Dispatcher) release(ctx context.Context, deliveries []delivery) error {
+	ids := make([]int64, len(deliveries))
+	for i, dl := range deliveries {
+		ids[i] = dl.id
+	}
+	_, err := d.db.ExecContext(ctx, `
+	UPDATE webhook_deliveries
+	SET locked_until=NULL
+	WHERE id = ANY($1)
+	`, pq.Array(ids))
+	return err
+}
+
+// backoff returns the delay before the next attempt after the given number of
+// failed attempts: BaseBackoff doubled per attempt, capped at MaxBackoff.
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= d.MaxBackoff {
+			return d.MaxBackoff
+		}
+	}
+	return delay
+}
+
+func (d *Dispatcher) post(ctx context.Context, dl delivery) error {
+	body, err := json.Marshal(dl.event)
+	if err != nil {
+		return err
+	}
+	timestamp := time.Now().Unix()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventId, strconv.FormatInt(dl.event.Id, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(dl.secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+//go:build unit
+
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/expense"
+	"github.com/stretchr/testify/assert"
+)
+
+var deliveryColumns = []string{"id", "attempts", "url", "secret", "event_id", "event_type", "expense_id", "payload", "created_at"}
+
+// newTestDispatcher posts with the client of server, which may be dialled
+// although it listens on loopback.
+func newTestDispatcher(db *sql.DB, server *httptest.Server) *Dispatcher {
+	dispatcher := NewDispatcher(db)
+	dispatcher.client = server.Client()
+	return dispatcher
+}
+
+func TestDeliver_ShouldPostSignedEvent(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	var received expense.Event
+	var verified bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+		verified = Verify("s3cret", timestamp, body, r.Header.Get(HeaderSignature))
+		json.Unmarshal(body, &received)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, 0, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{"id":1,"title":"MaMa"}`, createdAt))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=attempts \\+ 1, last_error=NULL, delivered_at=now\\(\\), locked_until=NULL").
+		WithArgs(10).WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	err := newTestDispatcher(db, server).deliver(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, verified)
+	assert.Equal(t, int64(7), received.Id)
+	assert.Equal(t, expense.EventExpenseCreated, received.Type)
+	assert.JSONEq(t, `{"id":1,"title":"MaMa"}`, string(received.Data))
+}
+
+func TestDeliver_Failure_ShouldScheduleRetry(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(db, server)
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, 2, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{}`, time.Now()))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=\\$2, last_error=\\$3, next_attempt_at").
+		WithArgs(10, 3, "unexpected status 503", dispatcher.backoff(3).Milliseconds()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	err := dispatcher.deliver(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliver_PrivateAddress_ShouldNotPost(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	var posted bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted = true
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	dispatcher := NewDispatcher(db)
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, 2, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{}`, time.Now()))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=\\$2, last_error=\\$3, next_attempt_at").
+		WithArgs(10, 3, sqlmock.AnyArg(), dispatcher.backoff(3).Milliseconds()).
+		WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	err := dispatcher.deliver(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.False(t, posted)
+}
+
+func TestDeliver_OutOfAttempts_ShouldMarkFailed(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	dispatcher := newTestDispatcher(db, server)
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, dispatcher.MaxAttempts-1, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{}`, time.Now()))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=\\$2, last_error=\\$3, failed_at=now\\(\\), locked_until=NULL").
+		WithArgs(10, dispatcher.MaxAttempts, "unexpected status 500").
+		WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	err := dispatcher.deliver(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliver_RecordFailure_ShouldStillPostAndRecordTheRest(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	posted := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posted++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, 0, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{}`, time.Now()).
+			AddRow(11, 0, server.URL, "s3cret", 8, expense.EventExpenseUpdated, 1, `{}`, time.Now()))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=attempts \\+ 1").
+		WithArgs(10).WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec("UPDATE webhook_deliveries SET attempts=attempts \\+ 1").
+		WithArgs(11).WillReturnResult(driver.RowsAffected(1))
+
+	// Act
+	err := newTestDispatcher(db, server).deliver(context.Background())
+
+	// Assert
+	assert.ErrorContains(t, err, "can't record delivery 10")
+	assert.Equal(t, 2, posted)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDeliver_Stopped_ShouldReleaseUnpostedDeliveries(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	mock.ExpectQuery("UPDATE webhook_deliveries d SET locked_until=(.+) RETURNING").
+		WillReturnRows(sqlmock.NewRows(deliveryColumns).
+			AddRow(10, 0, server.URL, "s3cret", 7, expense.EventExpenseCreated, 1, `{}`, time.Now()).
+			AddRow(11, 0, server.URL, "s3cret", 8, expense.EventExpenseUpdated, 1, `{}`, time.Now()))
+	mock.ExpectExec("UPDATE webhook_deliveries SET locked_until=NULL WHERE id = ANY").
+		WithArgs(`{10,11}`).WillReturnResult(driver.RowsAffected(2))
+
+	// Act
+	err := newTestDispatcher(db, server).deliver(ctx)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestBackoff(t *testing.T) {
+	dispatcher := &Dispatcher{BaseBackoff: time.Second, MaxBackoff: time.Minute}
+
+	assert.Equal(t, time.Second, dispatcher.backoff(1))
+	assert.Equal(t, 2*time.Second, dispatcher.backoff(2))
+	assert.Equal(t, 32*time.Second, dispatcher.backoff(6))
+	assert.Equal(t, time.Minute, dispatcher.backoff(7))
+	assert.Equal(t, time.Minute, dispatcher.backoff(20))
+}
@@ -0,0 +1,193 @@
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/brown-kaew/assessment/config"
+	"github.com/brown-kaew/assessment/database"
+	"github.com/labstack/echo/v4"
+)
+
+type Handler interface {
+	CreateSubscription(ctx context.Context, subscription *Subscription) error
+	GetAllSubscriptions(ctx context.Context) ([]Subscription, error)
+	DeleteSubscriptionById(ctx context.Context, id int) error
+	Prepare(ctx context.Context) error
+}
+
+const getAllSubscriptionsSQL = "SELECT id, url, created_at FROM webhooks ORDER BY id"
+
+type handler struct {
+	db           *sql.DB
+	stmts        *database.Statements
+	queryTimeout time.Duration
+	lookupIP     func(ctx context.Context, network, host string) ([]net.IP, error)
+}
+
+func NewHandler(db *sql.DB, g *echo.Group, conf config.Config) Handler {
+	handler := &handler{
+		db:           db,
+		stmts:        database.NewStatements(db),
+		queryTimeout: conf.QueryTimeout,
+		lookupIP:     net.DefaultResolver.LookupIP,
+	}
+	handler.initRoutes(g)
+	return handler
+}
+
+func (h *handler) initRoutes(g *echo.Group) {
+	g.POST("/webhooks", h.createSubscriptionHandler())
+	g.GET("/webhooks", h.getAllSubscriptionsHandler())
+	g.DELETE("/webhooks/:id", h.deleteSubscriptionHandler())
+}
+
+// createSubscriptionHandler subscribes a url to the events of every ledger;
+// subscriptions aren't scoped to one, which is why managing them needs the
+// admin scope. The url's host must resolve to public addresses only, and
+// deliveries check the address again when they connect.
+func (h *handler) createSubscriptionHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var subscription Subscription
+		err := c.Bind(&subscription)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		u, err := url.Parse(subscription.Url)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid url, expected an absolute http(s) url")
+		}
+		if err := checkHost(c.Request().Context(), h.lookupIP, u.Hostname()); err != nil {
+			if errors.Is(err, errPrivateAddress) {
+				return echo.NewHTTPError(http.StatusBadRequest, "invalid url, "+err.Error())
+			}
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid url, can't resolve host")
+		}
+
+		err = h.CreateSubscription(c.Request().Context(), &subscription)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, subscription)
+	}
+}
+
+func (h *handler) getAllSubscriptionsHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		subscriptions, err := h.GetAllSubscriptions(c.Request().Context())
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, subscriptions)
+	}
+}
+
+func (h *handler) deleteSubscriptionHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "invalid Id")
+		}
+		err = h.DeleteSubscriptionById(c.Request().Context(), id)
+		if err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusNoContent)
+	}
+}
+
+// CreateSubscription stores a new subscription. A secret is generated when the
+// caller does not provide one; it is only ever returned here.
+func (h *handler) CreateSubscription(ctx context.Context, subscription *Subscription) error {
+	if subscription.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, "Cannot generate secret")
+		}
+		subscription.Secret = secret
+	}
+
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	sql := `
+	INSERT INTO
+		webhooks (url, secret)
+	VALUES
+		($1, $2)
+	RETURNING id, created_at;
+	`
+	row := h.db.QueryRowContext(ctx, sql, subscription.Url, subscription.Secret)
+
+	if err := row.Scan(&subscription.Id, &subscription.CreatedAt); err != nil {
+		return database.HTTPError(ctx, err, "")
+	}
+	return nil
+}
+
+func (h *handler) GetAllSubscriptions(ctx context.Context) ([]Subscription, error) {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	stmt, err := h.stmts.Prepare(ctx, getAllSubscriptionsSQL)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Cannot prepare statment")
+	}
+
+	rows, err := stmt.QueryContext(ctx)
+	if err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all webhooks: "+err.Error())
+	}
+	defer rows.Close()
+
+	subscriptions := []Subscription{}
+	for rows.Next() {
+		var subscription Subscription
+		err = rows.Scan(&subscription.Id, &subscription.Url, &subscription.CreatedAt)
+		if err != nil {
+			return nil, database.HTTPError(ctx, err, "Can't scan webhook: "+err.Error())
+		}
+		subscriptions = append(subscriptions, subscription)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, database.HTTPError(ctx, err, "Can't query all webhooks: "+err.Error())
+	}
+	return subscriptions, nil
+}
+
+func (h *handler) DeleteSubscriptionById(ctx context.Context, id int) error {
+	ctx, cancel := database.WithTimeout(ctx, h.queryTimeout)
+	defer cancel()
+	res, err := h.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id=$1", id)
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot delete webhook: "+err.Error())
+	}
+
+	row, err := res.RowsAffected()
+	if err != nil {
+		return database.HTTPError(ctx, err, "Cannot delete webhook: "+err.Error())
+	}
+	if row == 0 {
+		return echo.NewHTTPError(http.StatusNotFound, "Webhook not found")
+	}
+	return nil
+}
+
+// Prepare prepares the statements the handler reuses.
+func (h *handler) Prepare(ctx context.Context) error {
+	return h.stmts.PrepareAll(ctx, getAllSubscriptionsSQL)
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
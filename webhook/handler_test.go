@@ -0,0 +1,154 @@
+//go:build unit
+
+package webhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/brown-kaew/assessment/config"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func setUp(t *testing.T) (*sql.DB, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	return db, mock, func() { db.Close() }
+}
+
+func TestCreateSubscription_ShouldGenerateSecret(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery("INSERT INTO webhooks").WithArgs("https://ledger.example.com/hooks", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, createdAt))
+	s := &Subscription{Url: "https://ledger.example.com/hooks"}
+
+	// Act
+	err := handler.CreateSubscription(context.Background(), s)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, 1, s.Id)
+	assert.Len(t, s.Secret, 64)
+	assert.Equal(t, createdAt, s.CreatedAt)
+}
+
+func TestGetAllSubscriptions_ShouldNotExposeSecret(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	createdAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectPrepare("SELECT id, url, created_at FROM webhooks.*").ExpectQuery().
+		WillReturnRows(sqlmock.NewRows([]string{"id", "url", "created_at"}).
+			AddRow(1, "https://ledger.example.com/hooks", createdAt))
+
+	// Act
+	subscriptions, err := handler.GetAllSubscriptions(context.Background())
+
+	// Assert
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, []Subscription{{Id: 1, Url: "https://ledger.example.com/hooks", CreatedAt: createdAt}}, subscriptions)
+}
+
+func TestDeleteSubscriptionById_NoIdIsFound_ShouldGetNotFound(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	handler := NewHandler(db, echo.New().Group(""), config.Config{})
+
+	// Arrange
+	mock.ExpectExec("DELETE FROM webhooks").WithArgs(999).WillReturnResult(driver.RowsAffected(0))
+
+	// Act
+	err := handler.DeleteSubscriptionById(context.Background(), 999)
+
+	// Assert
+	assert.Equal(t, echo.NewHTTPError(404, "Webhook not found"), err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateSubscriptionHandler_ShouldRejectPrivateHosts(t *testing.T) {
+	tests := []struct {
+		name    string
+		url     string
+		resolve []net.IP
+		err     error
+		want    string
+	}{
+		{"loopback", "http://localhost:8080/hooks", []net.IP{net.ParseIP("127.0.0.1")}, nil, "invalid url, host must not be loopback, link-local or private"},
+		{"metadata", "http://169.254.169.254/latest", []net.IP{net.ParseIP("169.254.169.254")}, nil, "invalid url, host must not be loopback, link-local or private"},
+		{"private", "https://intranet.example.com", []net.IP{net.ParseIP("203.0.113.7"), net.ParseIP("10.0.0.7")}, nil, "invalid url, host must not be loopback, link-local or private"},
+		{"ipv6 loopback", "http://[::1]/hooks", []net.IP{net.ParseIP("::1")}, nil, "invalid url, host must not be loopback, link-local or private"},
+		{"unresolvable", "https://nowhere.invalid", nil, errors.New("no such host"), "invalid url, can't resolve host"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, teardown := setUp(t)
+			defer teardown()
+			e := echo.New()
+			h := NewHandler(db, e.Group(""), config.Config{}).(*handler)
+
+			// Arrange
+			var looked string
+			h.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+				looked = host
+				return tt.resolve, tt.err
+			}
+			req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"`+tt.url+`"}`))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			rec := httptest.NewRecorder()
+
+			// Act
+			e.ServeHTTP(rec, req)
+
+			// Assert
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+			assert.Contains(t, rec.Body.String(), tt.want)
+			assert.NotEmpty(t, looked)
+			assert.NoError(t, mock.ExpectationsWereMet())
+		})
+	}
+}
+
+func TestCreateSubscriptionHandler_PublicHost_ShouldCreate(t *testing.T) {
+	db, mock, teardown := setUp(t)
+	defer teardown()
+	e := echo.New()
+	h := NewHandler(db, e.Group(""), config.Config{}).(*handler)
+
+	// Arrange
+	h.lookupIP = func(ctx context.Context, network, host string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("203.0.113.7")}, nil
+	}
+	mock.ExpectQuery("INSERT INTO webhooks").WithArgs("https://ledger.example.com/hooks", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(1, time.Now()))
+	req := httptest.NewRequest(http.MethodPost, "/webhooks", strings.NewReader(`{"url":"https://ledger.example.com/hooks"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	// Act
+	e.ServeHTTP(rec, req)
+
+	// Assert
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}